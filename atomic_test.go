@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func mkAtomicDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "envtemplate-atomic")
+	assert.Nil(t, err)
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func assertDirEntries(t *testing.T, dir string, want ...string) {
+	infos, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.Name())
+	}
+	assert.DeepEqual(t, got, want)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, cleanup := mkAtomicDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "out.conf")
+	assert.Nil(t, writeFileAtomic(filename, []byte("one"), 0640))
+
+	got, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, string(got), "one")
+
+	info, err := os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0640))
+
+	assert.Nil(t, writeFileAtomic(filename, []byte("two"), 0600))
+
+	got, err = ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, string(got), "two")
+
+	info, err = os.Stat(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+
+	assertDirEntries(t, dir, "out.conf")
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	dir, cleanup := mkAtomicDir(t)
+	defer cleanup()
+
+	target := filepath.Join(dir, "target.conf")
+	link := filepath.Join(dir, "link.conf")
+	assert.Nil(t, ioutil.WriteFile(target, []byte("old"), 0644))
+	assert.Nil(t, os.Symlink(target, link))
+
+	assert.Nil(t, writeFileAtomic(link, []byte("new"), 0644))
+
+	got, err := ioutil.ReadFile(target)
+	assert.Nil(t, err)
+	assert.Equal(t, string(got), "new")
+
+	info, err := os.Lstat(link)
+	assert.Nil(t, err)
+	assert.True(t, info.Mode()&os.ModeSymlink != 0)
+}
+
+func TestWriteFileAtomicMissingDir(t *testing.T) {
+	dir, cleanup := mkAtomicDir(t)
+	defer cleanup()
+
+	err := writeFileAtomic(filepath.Join(dir, "missing", "out.conf"), []byte("x"), 0644)
+	assert.NonNil(t, err)
+	assertDirEntries(t, dir)
+}
+
+func TestSameContents(t *testing.T) {
+	dir, cleanup := mkAtomicDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(dir, "out.conf")
+
+	same, err := sameContents(filename, []byte("x"))
+	assert.Nil(t, err)
+	assert.False(t, same)
+
+	assert.Nil(t, ioutil.WriteFile(filename, []byte("contents"), 0644))
+
+	same, err = sameContents(filename, []byte("contents"))
+	assert.Nil(t, err)
+	assert.True(t, same)
+
+	same, err = sameContents(filename, []byte("contents\n"))
+	assert.Nil(t, err)
+	assert.False(t, same)
+
+	_, err = sameContents(dir, []byte("x"))
+	assert.NonNil(t, err)
+}
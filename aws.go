@@ -0,0 +1,540 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/turbinelabs/envtemplate/envtemplate"
+)
+
+// metadataTimeout bounds the requests made to the instance metadata
+// services of cloud providers, which are unreachable elsewhere.
+const metadataTimeout = time.Second
+
+const (
+	defaultIMDSEndpoint = "http://169.254.169.254"
+	ecsCredentialsHost  = "http://169.254.170.2"
+)
+
+// awsService describes an AWS service that uses the JSON protocol.
+type awsService struct {
+	// name is the endpoint prefix and signing name, e.g. "ssm"
+	name string
+	// endpointID selects $AWS_ENDPOINT_URL_<endpointID>, which overrides
+	// the endpoint of the service
+	endpointID string
+	// targetPrefix is prepended to operation names in X-Amz-Target
+	targetPrefix string
+}
+
+// stsService is the AWS Security Token Service, which uses the query
+// protocol rather than the JSON protocol.
+var stsService = awsService{"sts", "STS", ""}
+
+// unsupportedProfileKeys are settings of AWS profiles that select credential
+// sources envtemplate cannot use. A profile using them fails rather than
+// falling back to another source, such as the instance role.
+var unsupportedProfileKeys = []string{
+	"source_profile",
+	"credential_source",
+	"credential_process",
+	"sso_session",
+	"sso_start_url",
+	"sso_account_id",
+}
+
+// awsCredentials are the keys used to sign requests to AWS.
+type awsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+// awsCall invokes the named operation of svc with the JSON encoding of in
+// as its input, and decodes the result into out. The region and credentials
+// are found as they are by the AWS command line tools.
+func (r *runner) awsCall(svc awsService, op string, in, out interface{}) error {
+	region, err := r.findAWSRegion()
+	if err != nil {
+		return err
+	}
+
+	creds, err := r.awsCredentials()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, r.awsEndpoint(svc, region), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", svc.targetPrefix+"."+op)
+	signAWS(req, body, creds, region, svc.name, r.now())
+
+	return r.getJSON(req, out)
+}
+
+func (r *runner) awsEndpoint(svc awsService, region string) string {
+	if endpoint, ok := r.awsEndpointOverride(svc); ok {
+		return endpoint
+	}
+	return "https://" + svc.name + "." + region + ".amazonaws.com/"
+}
+
+// awsEndpointOverride returns the endpoint of svc given by the environment,
+// if any.
+func (r *runner) awsEndpointOverride(svc awsService) (string, bool) {
+	for _, name := range []string{"AWS_ENDPOINT_URL_" + svc.endpointID, "AWS_ENDPOINT_URL"} {
+		if url, ok := r.os.LookupEnv(name); ok && url != "" {
+			return strings.TrimRight(url, "/") + "/", true
+		}
+	}
+	return "", false
+}
+
+// awsErrorType returns the type of the AWS error returned by awsCall, such
+// as "ParameterNotFound", or the empty string if err is not an AWS error.
+func awsErrorType(err error) string {
+	herr, ok := err.(httpError)
+	if !ok {
+		return ""
+	}
+
+	var body struct {
+		Type string `json:"__type"`
+	}
+	if json.Unmarshal(herr.body, &body) != nil {
+		return ""
+	}
+	// the type may be qualified, as in "com.amazon.coral.service#Error"
+	return body.Type[strings.LastIndex(body.Type, "#")+1:]
+}
+
+func (r *runner) awsProfile() string {
+	if profile, ok := r.os.LookupEnv("AWS_PROFILE"); ok && profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+// findAWSRegion returns the region given by --aws-region, $AWS_REGION or
+// $AWS_DEFAULT_REGION, or configured for the current profile in
+// ~/.aws/config.
+func (r *runner) findAWSRegion() (string, error) {
+	if r.awsRegion != "" {
+		return r.awsRegion, nil
+	}
+
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region, ok := r.os.LookupEnv(name); ok && region != "" {
+			return region, nil
+		}
+	}
+
+	config, err := r.readAWSFile("AWS_CONFIG_FILE", "~/.aws/config")
+	if err != nil {
+		return "", err
+	}
+
+	profile := r.awsProfile()
+	section := "profile " + profile
+	if profile == "default" {
+		section = profile
+	}
+	if region := config[section]["region"]; region != "" {
+		return region, nil
+	}
+	return "", fmt.Errorf("no AWS region: set --aws-region or $AWS_REGION, or configure a region for profile %q", profile)
+}
+
+// awsCredentials returns the credentials found, in order, in the
+// environment, from a web identity token named by the environment, in the
+// current profile of the shared credentials and config files, from the ECS
+// container credentials endpoint, or from the EC2 instance metadata service.
+// A profile that assumes a role from another source, or uses
+// credential_process or SSO, is an error. They are found at most once.
+func (r *runner) awsCredentials() (*awsCredentials, error) {
+	if r.awsCreds == nil {
+		creds, err := r.findAWSCredentials()
+		if err != nil {
+			return nil, err
+		}
+		r.awsCreds = creds
+	}
+	return r.awsCreds, nil
+}
+
+func (r *runner) findAWSCredentials() (*awsCredentials, error) {
+	if id, ok := r.os.LookupEnv("AWS_ACCESS_KEY_ID"); ok && id != "" {
+		secret, _ := r.os.LookupEnv("AWS_SECRET_ACCESS_KEY")
+		if secret == "" {
+			return nil, fmt.Errorf("$AWS_ACCESS_KEY_ID is set, but $AWS_SECRET_ACCESS_KEY is not")
+		}
+		token, _ := r.os.LookupEnv("AWS_SESSION_TOKEN")
+		return &awsCredentials{id, secret, token}, nil
+	}
+
+	if tokenFile, ok := r.os.LookupEnv("AWS_WEB_IDENTITY_TOKEN_FILE"); ok && tokenFile != "" {
+		role, _ := r.os.LookupEnv("AWS_ROLE_ARN")
+		if role == "" {
+			return nil, fmt.Errorf("$AWS_WEB_IDENTITY_TOKEN_FILE is set, but $AWS_ROLE_ARN is not")
+		}
+		session, _ := r.os.LookupEnv("AWS_ROLE_SESSION_NAME")
+		return r.webIdentityCredentials(role, tokenFile, session)
+	}
+
+	profile := r.awsProfile()
+	settings, err := r.awsProfileSettings(profile)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range unsupportedProfileKeys {
+		if settings[key] != "" {
+			return nil, fmt.Errorf("AWS profile %q uses %s, which is not supported", profile, key)
+		}
+	}
+	if role := settings["role_arn"]; role != "" {
+		tokenFile := settings["web_identity_token_file"]
+		if tokenFile == "" {
+			return nil, fmt.Errorf("AWS profile %q uses role_arn without web_identity_token_file, which is not supported", profile)
+		}
+		return r.webIdentityCredentials(role, tokenFile, settings["role_session_name"])
+	}
+	if settings["aws_access_key_id"] != "" {
+		return &awsCredentials{
+			settings["aws_access_key_id"],
+			settings["aws_secret_access_key"],
+			settings["aws_session_token"],
+		}, nil
+	}
+
+	if uri, ok := r.os.LookupEnv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); ok && uri != "" {
+		return r.containerCredentials(ecsCredentialsHost + uri)
+	}
+	if uri, ok := r.os.LookupEnv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); ok && uri != "" {
+		return r.containerCredentials(uri)
+	}
+
+	if disabled, _ := r.os.LookupEnv("AWS_EC2_METADATA_DISABLED"); !strings.EqualFold(disabled, "true") {
+		creds, err := r.instanceCredentials()
+		if err == nil {
+			return creds, nil
+		}
+		return nil, fmt.Errorf("no AWS credentials found: %s", err)
+	}
+	return nil, fmt.Errorf("no AWS credentials found")
+}
+
+// awsProfileSettings returns the settings of the named profile from the
+// config file, overridden by those from the shared credentials file.
+func (r *runner) awsProfileSettings(profile string) (map[string]string, error) {
+	config, err := r.readAWSFile("AWS_CONFIG_FILE", "~/.aws/config")
+	if err != nil {
+		return nil, err
+	}
+	creds, err := r.readAWSFile("AWS_SHARED_CREDENTIALS_FILE", "~/.aws/credentials")
+	if err != nil {
+		return nil, err
+	}
+
+	section := "profile " + profile
+	if profile == "default" {
+		section = profile
+	}
+	settings := map[string]string{}
+	for k, v := range config[section] {
+		settings[k] = v
+	}
+	for k, v := range creds[profile] {
+		settings[k] = v
+	}
+	return settings, nil
+}
+
+// webIdentityCredentials exchanges the OIDC token in tokenFile for
+// credentials for role using STS AssumeRoleWithWebIdentity, as used by IAM
+// roles for service accounts on EKS. The request is not signed.
+func (r *runner) webIdentityCredentials(role, tokenFile, session string) (*awsCredentials, error) {
+	token, err := ioutil.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read web identity token: %s", err)
+	}
+	if session == "" {
+		session = fmt.Sprintf("envtemplate-%d", r.now().UnixNano())
+	}
+
+	// STS is also available globally, so a region is not required
+	endpoint, ok := r.awsEndpointOverride(stsService)
+	if !ok {
+		endpoint = "https://sts.amazonaws.com/"
+		if region, err := r.findAWSRegion(); err == nil {
+			endpoint = r.awsEndpoint(stsService, region)
+		}
+	}
+
+	form := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {session},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := r.fetch(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not assume role %s with web identity: %s", role, err)
+	}
+
+	var resp struct {
+		Credentials struct {
+			AccessKeyID     string `xml:"AccessKeyId"`
+			SecretAccessKey string `xml:"SecretAccessKey"`
+			SessionToken    string `xml:"SessionToken"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("could not assume role %s with web identity: %s", role, err)
+	}
+	creds := resp.Credentials
+	if creds.AccessKeyID == "" {
+		return nil, fmt.Errorf("could not assume role %s with web identity: no credentials returned", role)
+	}
+	return &awsCredentials{creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken}, nil
+}
+
+func (r *runner) containerCredentials(url string) (*awsCredentials, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token, ok := r.os.LookupEnv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); ok && token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	creds := &awsCredentials{}
+	if err := r.getJSON(req, creds); err != nil {
+		return nil, fmt.Errorf("could not read container credentials: %s", err)
+	}
+	return creds, nil
+}
+
+// instanceCredentials returns the credentials of the role of the EC2
+// instance profile, using version 2 of the instance metadata service.
+func (r *runner) instanceCredentials() (*awsCredentials, error) {
+	endpoint := defaultIMDSEndpoint
+	if e, ok := r.os.LookupEnv("AWS_EC2_METADATA_SERVICE_ENDPOINT"); ok && e != "" {
+		endpoint = strings.TrimRight(e, "/")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+	defer cancel()
+
+	request := func(method, path, token string) (*http.Request, error) {
+		req, err := http.NewRequest(method, endpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+		} else {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+		return req.WithContext(ctx), nil
+	}
+
+	req, err := request(http.MethodPut, "/latest/api/token", "")
+	if err != nil {
+		return nil, err
+	}
+	token, err := r.fetch(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not read instance metadata: %s", err)
+	}
+
+	const credsPath = "/latest/meta-data/iam/security-credentials/"
+	if req, err = request(http.MethodGet, credsPath, string(token)); err != nil {
+		return nil, err
+	}
+	roles, err := r.fetch(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not read instance metadata: %s", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, fmt.Errorf("instance has no IAM role")
+	}
+
+	if req, err = request(http.MethodGet, credsPath+role, string(token)); err != nil {
+		return nil, err
+	}
+	creds := &awsCredentials{}
+	if err := r.getJSON(req, creds); err != nil {
+		return nil, fmt.Errorf("could not read instance credentials: %s", err)
+	}
+	return creds, nil
+}
+
+// readAWSFile parses the AWS configuration file named by envVar, or
+// defaultPath. A missing file is treated as empty.
+func (r *runner) readAWSFile(envVar, defaultPath string) (map[string]map[string]string, error) {
+	path, ok := r.os.LookupEnv(envVar)
+	if !ok || path == "" {
+		var err error
+		if path, err = envtemplate.ExpandHome(defaultPath, r.os); err != nil {
+			return nil, nil
+		}
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseINI(data), nil
+}
+
+// parseINI parses the INI format of AWS configuration files, returning the
+// keys and values of each section.
+func parseINI(data []byte) map[string]map[string]string {
+	sections := map[string]map[string]string{}
+	var section map[string]string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+
+		case line[0] == '[' && line[len(line)-1] == ']':
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if section = sections[name]; section == nil {
+				section = map[string]string{}
+				sections[name] = section
+			}
+
+		case section != nil:
+			if i := strings.Index(line, "="); i >= 0 {
+				section[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	return sections
+}
+
+// signAWS adds the headers that authenticate req using AWS Signature
+// Version 4. Existing headers of req are signed.
+func signAWS(
+	req *http.Request,
+	body []byte,
+	creds *awsCredentials,
+	region string,
+	service string,
+	now time.Time,
+) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.Token != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.Token)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := &bytes.Buffer{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	bodyHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join(
+		[]string{
+			req.Method,
+			path,
+			strings.Replace(req.URL.Query().Encode(), "+", "%20", -1),
+			canonicalHeaders.String(),
+			signedHeaders,
+			hex.EncodeToString(bodyHash[:]),
+		},
+		"\n",
+	)
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + creds.SecretAccessKey)
+	for _, s := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID,
+		scope,
+		signedHeaders,
+		hex.EncodeToString(hmacSHA256(key, stringToSign)),
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,390 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+func TestSignAWS(t *testing.T) {
+	// the get-vanilla case of the AWS Signature Version 4 test suite
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	assert.Nil(t, err)
+
+	creds := &awsCredentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	signAWS(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, req.Header.Get("X-Amz-Date"), "20150830T123600Z")
+	assert.Equal(
+		t,
+		req.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+			"SignedHeaders=host;x-amz-date, "+
+			"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+	)
+}
+
+func TestSignAWSSessionToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://ssm.us-west-2.amazonaws.com/", nil)
+	assert.Nil(t, err)
+	req.Header.Set("X-Amz-Target", "AmazonSSM.GetParameter")
+
+	creds := &awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", Token: "token"}
+	signAWS(req, []byte("{}"), creds, "us-west-2", "ssm", time.Now())
+
+	assert.Equal(t, req.Header.Get("X-Amz-Security-Token"), "token")
+	assert.StringContains(
+		t,
+		req.Header.Get("Authorization"),
+		"SignedHeaders=host;x-amz-date;x-amz-security-token;x-amz-target, ",
+	)
+}
+
+func TestParseINI(t *testing.T) {
+	got := parseINI([]byte(`
+ignored = value
+# comment
+[default]
+aws_access_key_id = AKID
+; comment
+aws_secret_access_key=secret=
+
+[profile dev]
+region = eu-west-1
+`))
+	assert.DeepEqual(t, got, map[string]map[string]string{
+		"default":     {"aws_access_key_id": "AKID", "aws_secret_access_key": "secret="},
+		"profile dev": {"region": "eu-west-1"},
+	})
+}
+
+func TestAWSRegion(t *testing.T) {
+	config, removeConfig := tempfile.Write(t, "[default]\nregion = us-west-1\n[profile dev]\nregion = eu-west-1\n")
+	defer removeConfig()
+
+	for _, tc := range []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{"AWS_REGION": "ap-south-1", "AWS_DEFAULT_REGION": "us-east-2"}, "ap-south-1"},
+		{map[string]string{"AWS_DEFAULT_REGION": "us-east-2"}, "us-east-2"},
+		{map[string]string{"AWS_CONFIG_FILE": config}, "us-west-1"},
+		{map[string]string{"AWS_CONFIG_FILE": config, "AWS_PROFILE": "dev"}, "eu-west-1"},
+	} {
+		r, finish := mkEnvRunner(t, tc.env)
+		got, err := r.findAWSRegion()
+		assert.Nil(t, err)
+		assert.Equal(t, got, tc.want)
+		finish()
+	}
+
+	r, finish := mkEnvRunner(t, map[string]string{"AWS_CONFIG_FILE": config, "AWS_PROFILE": "prod"})
+	defer finish()
+	_, err := r.findAWSRegion()
+	assert.ErrorContains(t, err, `no AWS region: set --aws-region or $AWS_REGION, or configure a region for profile "prod"`)
+
+	r.awsRegion = "sa-east-1"
+	got, err := r.findAWSRegion()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "sa-east-1")
+}
+
+func TestAWSCredentialsEnv(t *testing.T) {
+	r, finish := mkEnvRunner(t, map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_SESSION_TOKEN":     "token",
+	})
+	defer finish()
+
+	got, err := r.awsCredentials()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &awsCredentials{"AKID", "secret", "token"})
+
+	r, finish = mkEnvRunner(t, map[string]string{"AWS_ACCESS_KEY_ID": "AKID"})
+	defer finish()
+
+	_, err = r.awsCredentials()
+	assert.ErrorContains(t, err, "$AWS_SECRET_ACCESS_KEY is not")
+}
+
+func TestAWSCredentialsFile(t *testing.T) {
+	file, removeFile := tempfile.Write(
+		t,
+		"[default]\naws_access_key_id = AKID\naws_secret_access_key = secret\n"+
+			"[dev]\naws_access_key_id = DEVKEY\naws_secret_access_key = devsecret\naws_session_token = token\n",
+	)
+	defer removeFile()
+
+	r, finish := mkEnvRunner(t, map[string]string{"AWS_SHARED_CREDENTIALS_FILE": file})
+	defer finish()
+
+	got, err := r.awsCredentials()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &awsCredentials{"AKID", "secret", ""})
+
+	r, finish = mkEnvRunner(t, map[string]string{"AWS_SHARED_CREDENTIALS_FILE": file, "AWS_PROFILE": "dev"})
+	defer finish()
+
+	got, err = r.awsCredentials()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &awsCredentials{"DEVKEY", "devsecret", "token"})
+}
+
+func mkSTSServer(t *testing.T, wantRole, wantSession string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		assert.Nil(t, req.ParseForm())
+		assert.Equal(t, req.Header.Get("Authorization"), "")
+		assert.Equal(t, req.PostForm.Get("Action"), "AssumeRoleWithWebIdentity")
+		assert.Equal(t, req.PostForm.Get("RoleArn"), wantRole)
+		assert.Equal(t, req.PostForm.Get("WebIdentityToken"), "oidc-token")
+		if wantSession != "" {
+			assert.Equal(t, req.PostForm.Get("RoleSessionName"), wantSession)
+		} else {
+			assert.True(t, strings.HasPrefix(req.PostForm.Get("RoleSessionName"), "envtemplate-"))
+		}
+		fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>rolesecret</SecretAccessKey>
+      <SessionToken>roletoken</SessionToken>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`)
+	}))
+}
+
+func TestAWSCredentialsWebIdentity(t *testing.T) {
+	tokenFile, removeTokenFile := tempfile.Write(t, "oidc-token\n")
+	defer removeTokenFile()
+
+	server := mkSTSServer(t, "arn:aws:iam::123456789012:role/pod", "web")
+	defer server.Close()
+
+	// takes precedence over the shared credentials file and instance role
+	file, removeFile := tempfile.Write(t, "[default]\naws_access_key_id = AKID\naws_secret_access_key = secret\n")
+	defer removeFile()
+
+	r, finish := mkEnvRunner(t, map[string]string{
+		"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile,
+		"AWS_ROLE_ARN":                "arn:aws:iam::123456789012:role/pod",
+		"AWS_ROLE_SESSION_NAME":       "web",
+		"AWS_ENDPOINT_URL_STS":        server.URL,
+		"AWS_SHARED_CREDENTIALS_FILE": file,
+	})
+	defer finish()
+
+	got, err := r.awsCredentials()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &awsCredentials{"ASIAROLE", "rolesecret", "roletoken"})
+
+	r, finish = mkEnvRunner(t, map[string]string{"AWS_WEB_IDENTITY_TOKEN_FILE": tokenFile})
+	defer finish()
+
+	_, err = r.awsCredentials()
+	assert.ErrorContains(t, err, "$AWS_ROLE_ARN is not")
+}
+
+func TestAWSCredentialsWebIdentityProfile(t *testing.T) {
+	tokenFile, removeTokenFile := tempfile.Write(t, "oidc-token")
+	defer removeTokenFile()
+
+	server := mkSTSServer(t, "arn:aws:iam::123456789012:role/ci", "")
+	defer server.Close()
+
+	config, removeConfig := tempfile.Write(
+		t,
+		"[profile ci]\nrole_arn = arn:aws:iam::123456789012:role/ci\nweb_identity_token_file = "+tokenFile+"\n",
+	)
+	defer removeConfig()
+
+	r, finish := mkEnvRunner(t, map[string]string{
+		"AWS_PROFILE":                 "ci",
+		"AWS_CONFIG_FILE":             config,
+		"AWS_SHARED_CREDENTIALS_FILE": "/nonexistent",
+		"AWS_ENDPOINT_URL":            server.URL + "/",
+	})
+	defer finish()
+
+	got, err := r.awsCredentials()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &awsCredentials{"ASIAROLE", "rolesecret", "roletoken"})
+}
+
+func TestAWSCredentialsConfigFile(t *testing.T) {
+	config, removeConfig := tempfile.Write(t, "[profile dev]\naws_access_key_id = DEVKEY\naws_secret_access_key = devsecret\n")
+	defer removeConfig()
+
+	r, finish := mkEnvRunner(t, map[string]string{
+		"AWS_PROFILE":                 "dev",
+		"AWS_CONFIG_FILE":             config,
+		"AWS_SHARED_CREDENTIALS_FILE": "/nonexistent",
+	})
+	defer finish()
+
+	got, err := r.awsCredentials()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &awsCredentials{"DEVKEY", "devsecret", ""})
+}
+
+func TestAWSCredentialsUnsupportedProfile(t *testing.T) {
+	// the instance role must not be used in place of the profile's
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("unexpected instance metadata request: %s", req.URL)
+	}))
+	defer imds.Close()
+
+	for profile, want := range map[string]string{
+		"assume":  `AWS profile "assume" uses source_profile, which is not supported`,
+		"source":  `AWS profile "source" uses credential_source, which is not supported`,
+		"process": `AWS profile "process" uses credential_process, which is not supported`,
+		"sso":     `AWS profile "sso" uses sso_start_url, which is not supported`,
+		"session": `AWS profile "session" uses sso_session, which is not supported`,
+		"role":    `AWS profile "role" uses role_arn without web_identity_token_file, which is not supported`,
+	} {
+		config, removeConfig := tempfile.Write(t, `
+[profile assume]
+role_arn = arn:aws:iam::123456789012:role/admin
+source_profile = default
+[profile source]
+role_arn = arn:aws:iam::123456789012:role/admin
+credential_source = Ec2InstanceMetadata
+[profile process]
+credential_process = /usr/local/bin/creds
+[profile sso]
+sso_start_url = https://example.awsapps.com/start
+sso_account_id = 123456789012
+[profile session]
+sso_session = corp
+[profile role]
+role_arn = arn:aws:iam::123456789012:role/admin
+`)
+		defer removeConfig()
+
+		creds, removeCreds := tempfile.Write(
+			t,
+			"["+profile+"]\naws_access_key_id = AKID\naws_secret_access_key = secret\n",
+		)
+		defer removeCreds()
+
+		r, finish := mkEnvRunner(t, map[string]string{
+			"AWS_PROFILE":                       profile,
+			"AWS_CONFIG_FILE":                   config,
+			"AWS_SHARED_CREDENTIALS_FILE":       creds,
+			"AWS_EC2_METADATA_SERVICE_ENDPOINT": imds.URL,
+		})
+		defer finish()
+
+		_, err := r.awsCredentials()
+		assert.ErrorContains(t, err, want)
+	}
+}
+
+func TestAWSCredentialsContainer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/creds" || req.Header.Get("Authorization") != "auth" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"AccessKeyId": "AKID", "SecretAccessKey": "secret", "Token": "token"}`)
+	}))
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE":        "/nonexistent",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI": server.URL + "/creds",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN":  "auth",
+	})
+	defer finish()
+
+	got, err := r.awsCredentials()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &awsCredentials{"AKID", "secret", "token"})
+}
+
+func TestAWSCredentialsInstance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == http.MethodPut && req.URL.Path == "/latest/api/token" {
+			fmt.Fprint(w, "imds-token")
+			return
+		}
+		if req.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "web-role\n")
+		case "/latest/meta-data/iam/security-credentials/web-role":
+			fmt.Fprint(w, `{"Code": "Success", "AccessKeyId": "AKID", "SecretAccessKey": "secret", "Token": "token"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE":       "/nonexistent",
+		"AWS_EC2_METADATA_SERVICE_ENDPOINT": server.URL + "/",
+	})
+	defer finish()
+
+	got, err := r.awsCredentials()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, &awsCredentials{"AKID", "secret", "token"})
+
+	// found once
+	server.Close()
+	got, err = r.awsCredentials()
+	assert.Nil(t, err)
+	assert.Equal(t, got.AccessKeyID, "AKID")
+}
+
+func TestAWSCredentialsNone(t *testing.T) {
+	r, finish := mkEnvRunner(t, map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE": "/nonexistent",
+		"AWS_EC2_METADATA_DISABLED":   "true",
+	})
+	defer finish()
+
+	_, err := r.awsCredentials()
+	assert.ErrorContains(t, err, "no AWS credentials found")
+}
+
+func TestAWSErrorType(t *testing.T) {
+	assert.Equal(t, awsErrorType(nil), "")
+	assert.Equal(t, awsErrorType(fmt.Errorf("boom")), "")
+	assert.Equal(t, awsErrorType(httpError{body: []byte("<html>")}), "")
+	assert.Equal(t, awsErrorType(httpError{body: []byte(`{"__type": "ParameterNotFound"}`)}), "ParameterNotFound")
+	assert.Equal(
+		t,
+		awsErrorType(httpError{body: []byte(`{"__type": "com.amazon.coral.service#AccessDeniedException"}`)}),
+		"AccessDeniedException",
+	)
+}
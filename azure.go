@@ -0,0 +1,192 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultAzureAuthorityHost = "https://login.microsoftonline.com"
+	azureKeyVaultResource     = "https://vault.azure.net"
+	azureKeyVaultAPIVersion   = "7.4"
+)
+
+// azureSecret returns the current value of the named secret in an Azure Key
+// Vault. The vault is given by name, or by URL for vaults outside the public
+// Azure cloud. Each secret is fetched at most once.
+func (r *runner) azureSecret(vault, name string) (string, error) {
+	vaultURL := vault
+	if !strings.Contains(vault, "://") {
+		vaultURL = "https://" + vault + ".vault.azure.net"
+	}
+	secretURL := strings.TrimRight(vaultURL, "/") + "/secrets/" + url.PathEscape(name)
+
+	if secret, ok := r.azureSecrets[secretURL]; ok {
+		return secret, nil
+	}
+
+	secret, err := r.getAzureSecret(secretURL)
+	if err != nil {
+		return "", fmt.Errorf("azureSecret: %s", err)
+	}
+	r.azureSecrets[secretURL] = secret
+	return secret, nil
+}
+
+func (r *runner) getAzureSecret(secretURL string) (string, error) {
+	token, err := r.azureAccessToken()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, secretURL+"?api-version="+azureKeyVaultAPIVersion, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Value string `json:"value"`
+	}
+	if err := r.getJSON(req, &resp); err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
+
+// azureAccessToken returns a Key Vault access token for the service
+// principal given by $AZURE_TENANT_ID, $AZURE_CLIENT_ID and
+// $AZURE_CLIENT_SECRET, for the workload identity given by
+// $AZURE_FEDERATED_TOKEN_FILE, or for the managed identity of the host,
+// selected by $AZURE_CLIENT_ID if set. The token is found at most once.
+func (r *runner) azureAccessToken() (string, error) {
+	if r.azureToken == "" {
+		token, err := r.findAzureAccessToken()
+		if err != nil {
+			return "", err
+		}
+		r.azureToken = token
+	}
+	return r.azureToken, nil
+}
+
+func (r *runner) findAzureAccessToken() (string, error) {
+	tenant, _ := r.os.LookupEnv("AZURE_TENANT_ID")
+	clientID, _ := r.os.LookupEnv("AZURE_CLIENT_ID")
+
+	if secret, ok := r.os.LookupEnv("AZURE_CLIENT_SECRET"); ok && secret != "" {
+		form := url.Values{}
+		form.Set("client_secret", secret)
+		return r.azureClientToken(tenant, clientID, form)
+	}
+
+	if tokenFile, ok := r.os.LookupEnv("AZURE_FEDERATED_TOKEN_FILE"); ok && tokenFile != "" {
+		assertion, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			return "", err
+		}
+		form := url.Values{}
+		form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+		form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+		return r.azureClientToken(tenant, clientID, form)
+	}
+
+	token, err := r.azureManagedIdentityToken(clientID)
+	if err != nil {
+		return "", fmt.Errorf("no Azure credentials found: %s", err)
+	}
+	return token, nil
+}
+
+// azureClientToken requests a token for the application with the given
+// tenant and client IDs, authenticated by the credentials in form.
+func (r *runner) azureClientToken(tenant, clientID string, form url.Values) (string, error) {
+	if tenant == "" || clientID == "" {
+		return "", fmt.Errorf("$AZURE_TENANT_ID and $AZURE_CLIENT_ID must be set")
+	}
+
+	authority, ok := r.os.LookupEnv("AZURE_AUTHORITY_HOST")
+	if !ok || authority == "" {
+		authority = defaultAzureAuthorityHost
+	}
+
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", clientID)
+	form.Set("scope", azureKeyVaultResource+"/.default")
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		strings.TrimRight(authority, "/")+"/"+url.PathEscape(tenant)+"/oauth2/v2.0/token",
+		strings.NewReader(form.Encode()),
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r.getAccessToken(req)
+}
+
+// azureManagedIdentityToken requests a token for the managed identity of
+// the Azure VM or App Service. The instance metadata service may be
+// overridden with $AZURE_POD_IDENTITY_AUTHORITY_HOST.
+func (r *runner) azureManagedIdentityToken(clientID string) (string, error) {
+	query := url.Values{}
+	query.Set("resource", azureKeyVaultResource)
+	if clientID != "" {
+		query.Set("client_id", clientID)
+	}
+
+	var (
+		req *http.Request
+		err error
+	)
+	if endpoint, ok := r.os.LookupEnv("IDENTITY_ENDPOINT"); ok && endpoint != "" {
+		// App Service and Azure Functions
+		query.Set("api-version", "2019-08-01")
+		if req, err = http.NewRequest(http.MethodGet, endpoint+"?"+query.Encode(), nil); err != nil {
+			return "", err
+		}
+		identityHeader, _ := r.os.LookupEnv("IDENTITY_HEADER")
+		req.Header.Set("X-IDENTITY-HEADER", identityHeader)
+		return r.getAccessToken(req)
+	}
+
+	host, ok := r.os.LookupEnv("AZURE_POD_IDENTITY_AUTHORITY_HOST")
+	if !ok || host == "" {
+		host = defaultIMDSEndpoint
+	}
+	query.Set("api-version", "2018-02-01")
+	req, err = http.NewRequest(
+		http.MethodGet,
+		strings.TrimRight(host, "/")+"/metadata/identity/oauth2/token?"+query.Encode(),
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+
+	ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+	defer cancel()
+	return r.getAccessToken(req.WithContext(ctx))
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// mkAzureServer returns a server acting as the Azure AD token endpoint, the
+// instance metadata service and a Key Vault, which serves the given secrets
+// to requests bearing a token it issued, and a count of the requests it has
+// received.
+func mkAzureServer(t *testing.T, secrets map[string]string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		switch req.URL.Path {
+		case "/tenant/oauth2/v2.0/token":
+			assert.Nil(t, req.ParseForm())
+			assert.Equal(t, req.Form.Get("grant_type"), "client_credentials")
+			assert.Equal(t, req.Form.Get("client_id"), "client")
+			assert.Equal(t, req.Form.Get("scope"), "https://vault.azure.net/.default")
+			switch {
+			case req.Form.Get("client_secret") == "secret":
+				fmt.Fprint(w, `{"access_token": "sp-token"}`)
+			case req.Form.Get("client_assertion") == "federated":
+				fmt.Fprint(w, `{"access_token": "wi-token"}`)
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+
+		case "/metadata/identity/oauth2/token":
+			assert.Equal(t, req.Header.Get("Metadata"), "true")
+			assert.Equal(t, req.URL.Query().Get("resource"), "https://vault.azure.net")
+			assert.Equal(t, req.URL.Query().Get("client_id"), "user-assigned")
+			fmt.Fprint(w, `{"access_token": "mi-token"}`)
+
+		case "/identity":
+			assert.Equal(t, req.Header.Get("X-IDENTITY-HEADER"), "header")
+			fmt.Fprint(w, `{"access_token": "app-token"}`)
+
+		default:
+			switch req.Header.Get("Authorization") {
+			case "Bearer sp-token", "Bearer wi-token", "Bearer mi-token", "Bearer app-token":
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			assert.Equal(t, req.URL.Query().Get("api-version"), azureKeyVaultAPIVersion)
+			secret, ok := secrets[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error": {"code": "SecretNotFound"}}`)
+				return
+			}
+			fmt.Fprintf(w, `{"value": %q}`, secret)
+		}
+	}))
+	return server, &requests
+}
+
+// testAzureSecret tests fetching secrets with the environment returned by
+// env, given the URL of the test server.
+func testAzureSecret(t *testing.T, env func(serverURL string) map[string]string) {
+	server, requests := mkAzureServer(t, map[string]string{
+		"/secrets/db-password": "hunter2",
+		"/secrets/db-user":     "admin",
+	})
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, env(server.URL))
+	defer finish()
+
+	got, err := r.azureSecret(server.URL, "db-password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	got, err = r.azureSecret(server.URL+"/", "db-user")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "admin")
+
+	got, err = r.azureSecret(server.URL, "db-password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	// one token request, and one request for each secret
+	assert.Equal(t, *requests, 3)
+}
+
+func TestAzureSecretServicePrincipal(t *testing.T) {
+	testAzureSecret(t, func(serverURL string) map[string]string {
+		return map[string]string{
+			"AZURE_TENANT_ID":      "tenant",
+			"AZURE_CLIENT_ID":      "client",
+			"AZURE_CLIENT_SECRET":  "secret",
+			"AZURE_AUTHORITY_HOST": serverURL,
+		}
+	})
+}
+
+func TestAzureSecretWorkloadIdentity(t *testing.T) {
+	tokenFile, removeTokenFile := writeNamedTempFile(t, "token", "federated\n")
+	defer removeTokenFile()
+
+	testAzureSecret(t, func(serverURL string) map[string]string {
+		return map[string]string{
+			"AZURE_TENANT_ID":            "tenant",
+			"AZURE_CLIENT_ID":            "client",
+			"AZURE_FEDERATED_TOKEN_FILE": tokenFile,
+			"AZURE_AUTHORITY_HOST":       serverURL,
+		}
+	})
+}
+
+func TestAzureSecretManagedIdentity(t *testing.T) {
+	testAzureSecret(t, func(serverURL string) map[string]string {
+		return map[string]string{
+			"AZURE_CLIENT_ID":                   "user-assigned",
+			"AZURE_POD_IDENTITY_AUTHORITY_HOST": serverURL,
+		}
+	})
+}
+
+func TestAzureSecretAppService(t *testing.T) {
+	testAzureSecret(t, func(serverURL string) map[string]string {
+		return map[string]string{
+			"IDENTITY_ENDPOINT": serverURL + "/identity",
+			"IDENTITY_HEADER":   "header",
+		}
+	})
+}
+
+func TestAzureSecretErrors(t *testing.T) {
+	server, _ := mkAzureServer(t, nil)
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{"AZURE_CLIENT_SECRET": "secret"})
+	defer finish()
+
+	_, err := r.azureSecret(server.URL, "db-password")
+	assert.ErrorContains(t, err, "azureSecret: $AZURE_TENANT_ID and $AZURE_CLIENT_ID must be set")
+
+	r, finish = mkEnvRunner(t, map[string]string{
+		"AZURE_TENANT_ID":      "tenant",
+		"AZURE_CLIENT_ID":      "client",
+		"AZURE_CLIENT_SECRET":  "secret",
+		"AZURE_AUTHORITY_HOST": server.URL,
+	})
+	defer finish()
+
+	_, err = r.azureSecret(server.URL, "missing")
+	assert.ErrorContains(t, err, "azureSecret: GET /secrets/missing returned 404 Not Found")
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/turbinelabs/cli/command"
+)
+
+// inputError marks an error caused by invalid template input, which is
+// reported as bad input rather than as a failure to render.
+type inputError struct {
+	error
+}
+
+// toCmdErr converts an error returned by processFile into a CmdErr.
+func toCmdErr(cmd *command.Cmd, err error) command.CmdErr {
+	if _, ok := err.(inputError); ok {
+		return cmd.BadInput(err)
+	}
+	return cmd.Error(err)
+}
+
+// fileError prefixes err with the name of the file that caused it,
+// preserving whether it is an inputError.
+func fileError(filename string, err error) error {
+	wrapped := fmt.Errorf("%s: %s", filename, err)
+	if _, ok := err.(inputError); ok {
+		return inputError{wrapped}
+	}
+	return wrapped
+}
+
+// batchFile is an input file and the output file it is rendered or, if
+// verbatim, copied to.
+type batchFile struct {
+	in       string
+	out      string
+	verbatim bool
+}
+
+// isBatchInput returns true if in names a directory or is a glob pattern,
+// rather than a single input file.
+func isBatchInput(in string) (bool, error) {
+	if in == "" {
+		return false, nil
+	}
+	if hasGlobMeta(in) {
+		return true, nil
+	}
+
+	info, err := os.Stat(in)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// reported when the file is read
+			return false, nil
+		}
+		return false, err
+	}
+	return info.IsDir(), nil
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// globBase returns the leading directories of pattern that contain no glob
+// metacharacters. Output filenames are relative to this directory.
+func globBase(pattern string) string {
+	dir := filepath.Dir(pattern)
+	for hasGlobMeta(dir) {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// defaultTemplateSuffix is the suffix of the files rendered by --in-dir
+// when --strip-suffix is not given.
+const defaultTemplateSuffix = ".tmpl"
+
+// useDirs configures batch rendering of --in-dir into --out-dir, which is
+// equivalent to --in and --out, except that only files ending in
+// --strip-suffix are rendered.
+func (r *runner) useDirs() error {
+	switch {
+	case r.inDir == "" && r.outDir == "":
+		return nil
+	case r.inDir == "":
+		return errors.New("--out-dir requires --in-dir")
+	case r.outDir == "":
+		return errors.New("--in-dir requires --out-dir")
+	case r.in != "" || r.out != "":
+		return errors.New("--in-dir and --out-dir may not be combined with --in or --out")
+	}
+
+	info, err := os.Stat(r.inDir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("--in-dir %q is not a directory", r.inDir)
+	}
+
+	r.in, r.out = r.inDir, r.outDir
+	if r.stripSuffix == "" {
+		r.stripSuffix = defaultTemplateSuffix
+	}
+	r.templatesOnly = true
+	return nil
+}
+
+// batchFiles returns the files matched by --in, paired with their output
+// files beneath --out.
+func (r *runner) batchFiles() ([]batchFile, error) {
+	var (
+		base  string
+		paths []string
+	)
+
+	if hasGlobMeta(r.in) {
+		matches, err := filepath.Glob(r.in)
+		if err != nil {
+			return nil, inputError{fmt.Errorf("invalid --in pattern %q: %s", r.in, err)}
+		}
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if info.Mode().IsRegular() {
+				paths = append(paths, match)
+			}
+		}
+		base = globBase(r.in)
+	} else {
+		err := filepath.Walk(r.in, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		base = r.in
+	}
+
+	files := make([]batchFile, 0, len(paths))
+	for _, path := range paths {
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return nil, err
+		}
+		if r.templatesOnly && (rel == r.stripSuffix || !strings.HasSuffix(rel, r.stripSuffix)) {
+			continue
+		}
+		verbatim, err := r.isVerbatim(rel)
+		if err != nil {
+			return nil, err
+		}
+		if r.stripSuffix != "" && rel != r.stripSuffix {
+			rel = strings.TrimSuffix(rel, r.stripSuffix)
+		}
+		files = append(files, batchFile{in: path, out: filepath.Join(r.out, rel), verbatim: verbatim})
+	}
+	return files, nil
+}
+
+// isVerbatim returns true if the file at the relative path rel should be
+// copied rather than rendered, according to --include-pattern and
+// --exclude-pattern.
+func (r *runner) isVerbatim(rel string) (bool, error) {
+	if len(r.includePatterns.Strings) > 0 {
+		included, err := matchesAny(r.includePatterns.Strings, rel)
+		if err != nil || !included {
+			return true, err
+		}
+	}
+	return matchesAny(r.excludePatterns.Strings, rel)
+}
+
+// matchesAny returns true if rel matches any of the given glob patterns.
+// Patterns without a slash are matched against the file name alone.
+func matchesAny(patterns []string, rel string) (bool, error) {
+	rel = filepath.ToSlash(rel)
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return false, inputError{fmt.Errorf("invalid pattern %q: %s", pattern, err)}
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// runBatch renders each file matched by --in into the --out directory,
+// reusing funcs and data for every file. Unless --keep-going is set, it
+// stops at the first file that fails.
+func (r *runner) runBatch(
+	cmd *command.Cmd,
+	funcs template.FuncMap,
+	data interface{},
+) command.CmdErr {
+	if r.out == "" && !r.lint {
+		return cmd.BadInput("--out must be a directory when --in is a directory or glob pattern")
+	}
+
+	files, err := r.batchFiles()
+	if err != nil {
+		return toCmdErr(cmd, err)
+	}
+	if len(files) == 0 {
+		return cmd.BadInputf("no files match --in %q", r.in)
+	}
+
+	failed := 0
+	for _, file := range files {
+		err := r.processBatchFile(file, funcs, data)
+		if err == nil {
+			continue
+		}
+		if !r.keepGoing {
+			return toCmdErr(cmd, err)
+		}
+		fmt.Fprintf(r.os.Stderr(), "error: %s\n", err)
+		failed++
+	}
+
+	if failed > 0 {
+		return cmd.Errorf("failed to render %d of %d files", failed, len(files))
+	}
+	return command.NoError()
+}
+
+func (r *runner) processBatchFile(
+	file batchFile,
+	funcs template.FuncMap,
+	data interface{},
+) error {
+	if !r.diff && !r.lint && !r.check {
+		if err := os.MkdirAll(filepath.Dir(file.out), 0755); err != nil {
+			return fileError(file.in, err)
+		}
+	}
+	if err := r.processFile(file.in, file.out, file.verbatim, funcs, data); err != nil {
+		return fileError(file.in, err)
+	}
+	return nil
+}
@@ -0,0 +1,548 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/cli/command"
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+func mkBatchDir(t *testing.T, files map[string]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "envtemplate-batch")
+	assert.Nil(t, err)
+
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func assertFileContents(t *testing.T, filename, want string) {
+	got, err := ioutil.ReadFile(filename)
+	assert.Nil(t, err)
+	assert.Equal(t, string(got), want)
+}
+
+func assertNoFile(t *testing.T, filename string) {
+	_, err := os.Stat(filename)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGlobBase(t *testing.T) {
+	assert.Equal(t, globBase("conf/*.tmpl"), "conf")
+	assert.Equal(t, globBase("conf/*/app.tmpl"), "conf")
+	assert.Equal(t, globBase("a/b/[xy]/*/c.tmpl"), filepath.Join("a", "b"))
+	assert.Equal(t, globBase("*.tmpl"), ".")
+}
+
+func TestIsBatchInput(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"a.tmpl": "a"})
+	defer cleanup()
+
+	for _, tc := range []struct {
+		in   string
+		want bool
+	}{
+		{"", false},
+		{dir, true},
+		{filepath.Join(dir, "*.tmpl"), true},
+		{filepath.Join(dir, "a.tmpl"), false},
+		{filepath.Join(dir, "missing"), false},
+	} {
+		got, err := isBatchInput(tc.in)
+		assert.Nil(t, err)
+		assert.Equal(t, got, tc.want)
+	}
+}
+
+func TestRunBatchDir(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.conf.tmpl":     "a={{foo}} {{sourceFile}}",
+		"sub/b.conf.tmpl": "b={{foo}}",
+		"c.conf":          "c={{foo}}",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-strip-suffix", ".tmpl", "-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	assertFileContents(t, filepath.Join(out, "a.conf"), "a=bar "+filepath.Join(in, "a.conf.tmpl"))
+	assertFileContents(t, filepath.Join(out, "sub", "b.conf"), "b=bar")
+	assertFileContents(t, filepath.Join(out, "c.conf"), "c=bar")
+}
+
+func TestRunBatchGlob(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a/app.tmpl": "a={{foo}}",
+		"b/app.tmpl": "b={{foo}}",
+		"b/app.conf": "ignored",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{
+		"-in", filepath.Join(in, "*", "*.tmpl"),
+		"-out", filepath.Join(out, "new"),
+		"-vars", "foo=bar",
+	})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	assertFileContents(t, filepath.Join(out, "new", "a", "app.tmpl"), "a=bar")
+	assertFileContents(t, filepath.Join(out, "new", "b", "app.tmpl"), "b=bar")
+	assertNoFile(t, filepath.Join(out, "new", "b", "app.conf"))
+}
+
+func TestRunBatchNoMatches(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, nil)
+	defer cleanupIn()
+
+	pattern := filepath.Join(in, "*.tmpl")
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", pattern, "-out", in})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInputf("no files match --in %q", pattern))
+}
+
+func TestRunBatchNoOut(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{"a.tmpl": "a"})
+	defer cleanupIn()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--out must be a directory when --in is a directory or glob pattern"))
+}
+
+func TestRunBatchError(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.tmpl": "a",
+		"b.tmpl": "{{missing}}",
+		"c.tmpl": "c",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-strict"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(
+		t,
+		got,
+		c.BadInputf("%s: undefined template variables: missing", filepath.Join(in, "b.tmpl")),
+	)
+
+	assertFileContents(t, filepath.Join(out, "a.tmpl"), "a")
+	assertNoFile(t, filepath.Join(out, "b.tmpl"))
+	assertNoFile(t, filepath.Join(out, "c.tmpl"))
+}
+
+func TestRunBatchKeepGoing(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.tmpl": "{{env \"MISSING\"}}",
+		"b.tmpl": "b",
+		"c.tmpl": "{{missing}}",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	stderr := &bytes.Buffer{}
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().LookupEnv("MISSING").Return("", false)
+	mockOS.EXPECT().Environ().Return(nil)
+	mockOS.EXPECT().Stderr().Return(stderr).Times(2)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-strict", "-keep-going"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.Error("failed to render 2 of 3 files"))
+
+	assert.StringContains(t, stderr.String(), "error: "+filepath.Join(in, "a.tmpl")+": ")
+	assert.StringContains(t, stderr.String(), "no value for $MISSING")
+	assert.StringContains(
+		t,
+		stderr.String(),
+		"error: "+filepath.Join(in, "c.tmpl")+": undefined template variables: missing\n",
+	)
+
+	assertNoFile(t, filepath.Join(out, "a.tmpl"))
+	assertFileContents(t, filepath.Join(out, "b.tmpl"), "b")
+	assertNoFile(t, filepath.Join(out, "c.tmpl"))
+}
+
+func TestRunBatchMaxRenderTimeKeepGoing(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.tmpl": "a",
+		"b.tmpl": "{{slow}}",
+		"c.tmpl": "c",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	release := make(chan struct{})
+	defer close(release)
+
+	funcs := template.FuncMap{
+		"slow": func() string {
+			<-release
+			return "slow"
+		},
+	}
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	stderr := &bytes.Buffer{}
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().Stderr().Return(stderr)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.in = in
+	r.out = out
+	r.keepGoing = true
+	r.maxRenderTime = 10 * time.Millisecond
+
+	got := r.runBatch(c, funcs, nil)
+	assert.Equal(t, got, c.Error("failed to render 1 of 3 files"))
+	assert.Equal(
+		t,
+		stderr.String(),
+		"error: "+filepath.Join(in, "b.tmpl")+": rendering exceeded max render time of 10ms\n",
+	)
+
+	assertFileContents(t, filepath.Join(out, "a.tmpl"), "a")
+	assertNoFile(t, filepath.Join(out, "b.tmpl"))
+	assertFileContents(t, filepath.Join(out, "c.tmpl"), "c")
+}
+
+func TestRunBatchMaxRenderTimeAbandonedRender(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.tmpl": `{{slow}}{{seqNext "n"}}{{sourceFile}}`,
+		"b.tmpl": `{{pause}}{{seqNext "n"}}{{seqNext "n"}} {{sourceFile}}`,
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	// a.tmpl is abandoned at 200ms, and released at 250ms, while pause is
+	// running for b.tmpl if functions are not guarded. Guarded, pause waits
+	// for slow to return, and b.tmpl renders within its max render time.
+	release := make(chan struct{})
+	timer := time.AfterFunc(250*time.Millisecond, func() { close(release) })
+	defer timer.Stop()
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().Stderr().Return(&bytes.Buffer{})
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.in = in
+	r.out = out
+	r.keepGoing = true
+	r.maxRenderTime = 200 * time.Millisecond
+
+	funcs := template.FuncMap{
+		"slow": func() string {
+			<-release
+			return "slow"
+		},
+		"pause": func() string {
+			time.Sleep(80 * time.Millisecond)
+			return ""
+		},
+		"seqNext":    r.seqNext,
+		"sourceFile": r.sourceFile,
+	}
+
+	// the functions a.tmpl calls once released do not run, so they neither
+	// race with nor change the render of b.tmpl
+	got := r.runBatch(c, funcs, nil)
+	assert.Equal(t, got, c.Error("failed to render 1 of 2 files"))
+	assertNoFile(t, filepath.Join(out, "a.tmpl"))
+	assertFileContents(t, filepath.Join(out, "b.tmpl"), "01 "+filepath.Join(in, "b.tmpl"))
+}
+
+func TestRunBatchOnlyChanged(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"same.tmpl":    "same={{foo}}",
+		"changed.tmpl": "changed={{foo}}",
+		"new.tmpl":     "new={{foo}}",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, map[string]string{
+		"same.tmpl":    "same=bar",
+		"changed.tmpl": "changed=old",
+	})
+	defer cleanupOut()
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for _, name := range []string{"same.tmpl", "changed.tmpl"} {
+		assert.Nil(t, os.Chtimes(filepath.Join(out, name), past, past))
+	}
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	stderr := &bytes.Buffer{}
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().Stderr().Return(stderr)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-only-changed", "-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, stderr.String(), "skipped 1 unchanged output file(s)\n")
+
+	assertFileContents(t, filepath.Join(out, "same.tmpl"), "same=bar")
+	assertFileContents(t, filepath.Join(out, "changed.tmpl"), "changed=bar")
+	assertFileContents(t, filepath.Join(out, "new.tmpl"), "new=bar")
+
+	info, err := os.Stat(filepath.Join(out, "same.tmpl"))
+	assert.Nil(t, err)
+	assert.True(t, info.ModTime().Equal(past))
+
+	info, err = os.Stat(filepath.Join(out, "changed.tmpl"))
+	assert.Nil(t, err)
+	assert.True(t, info.ModTime().After(past))
+}
+
+func TestRunBatchOnlyChangedNoneSkipped(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{"new.tmpl": "new={{foo}}"})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	// nothing is written to STDERR when no file is skipped
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = tbnos.NewMockOS(ctrl)
+
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-only-changed", "-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assertFileContents(t, filepath.Join(out, "new.tmpl"), "new=bar")
+}
+
+func TestMatchesAny(t *testing.T) {
+	for _, tc := range []struct {
+		patterns []string
+		rel      string
+		want     bool
+	}{
+		{nil, "a.tmpl", false},
+		{[]string{"*.tmpl"}, "a.tmpl", true},
+		{[]string{"*.tmpl"}, filepath.Join("sub", "a.tmpl"), true},
+		{[]string{"sub/*.tmpl"}, filepath.Join("sub", "a.tmpl"), true},
+		{[]string{"sub/*.tmpl"}, "a.tmpl", false},
+		{[]string{"*.png", "*.conf"}, "a.conf", true},
+		{[]string{"*.png", "*.conf"}, "a.tmpl", false},
+	} {
+		got, err := matchesAny(tc.patterns, tc.rel)
+		assert.Nil(t, err)
+		assert.Equal(t, got, tc.want)
+	}
+}
+
+func TestRunBatchIncludeExcludePatterns(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"app.conf.tmpl":       "app={{foo}}",
+		"sub/db.conf.tmpl":    "db={{foo}}",
+		"sub/skip.conf.tmpl":  "skip={{foo}}",
+		"static/logo.png":     "\x89PNG{{",
+		"static/index.html":   "<p>{{foo}}</p>",
+		"static/app.css.tmpl": "body {{foo}}",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{
+		"-in", in,
+		"-out", out,
+		"-strip-suffix", ".tmpl",
+		"-include-pattern", "*.tmpl",
+		"-exclude-pattern", "skip.*,static/*",
+		"-vars", "foo=bar",
+	})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	assertFileContents(t, filepath.Join(out, "app.conf"), "app=bar")
+	assertFileContents(t, filepath.Join(out, "sub", "db.conf"), "db=bar")
+	assertFileContents(t, filepath.Join(out, "sub", "skip.conf"), "skip={{foo}}")
+	assertFileContents(t, filepath.Join(out, "static", "logo.png"), "\x89PNG{{")
+	assertFileContents(t, filepath.Join(out, "static", "index.html"), "<p>{{foo}}</p>")
+	assertFileContents(t, filepath.Join(out, "static", "app.css"), "body {{foo}}")
+}
+
+func TestRunBatchInvalidPattern(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{"a.tmpl": "a"})
+	defer cleanupIn()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in, "-out", in, "-include-pattern", "[a"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`invalid pattern "[a": syntax error in pattern`))
+}
+
+func TestRunInDir(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.conf.tmpl":     "a={{foo}}",
+		"sub/b.conf.tmpl": "b={{foo}}",
+		"README.md":       "not a template {{",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in-dir", in, "-out-dir", out, "-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	assertFileContents(t, filepath.Join(out, "a.conf"), "a=bar")
+	assertFileContents(t, filepath.Join(out, "sub", "b.conf"), "b=bar")
+	assertNoFile(t, filepath.Join(out, "README.md"))
+}
+
+func TestRunInDirStripSuffix(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.conf.tpl":  "a={{foo}}",
+		"b.conf.tmpl": "b={{foo}}",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in-dir", in, "-out-dir", out, "-strip-suffix", ".tpl", "-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	assertFileContents(t, filepath.Join(out, "a.conf"), "a=bar")
+	assertNoFile(t, filepath.Join(out, "b.conf"))
+	assertNoFile(t, filepath.Join(out, "b.conf.tmpl"))
+}
+
+func TestRunInDirNotDirectory(t *testing.T) {
+	file, cleanup := tempfile.Write(t, "x")
+	defer cleanup()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in-dir", file, "-out-dir", "out"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInputf("--in-dir %q is not a directory", file))
+}
+
+func TestRunInDirBadFlags(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-in-dir", "in"}, "--in-dir requires --out-dir"},
+		{[]string{"-out-dir", "out"}, "--out-dir requires --in-dir"},
+		{[]string{"-in-dir", "in", "-out-dir", "out", "-in", "x"}, "--in-dir and --out-dir may not be combined with --in or --out"},
+		{[]string{"-in-dir", "in", "-out-dir", "out", "-out", "x"}, "--in-dir and --out-dir may not be combined with --in or --out"},
+	} {
+		c := cmd()
+		assert.Nil(t, c.Flags.Parse(tc.args))
+
+		got := c.Runner.Run(c, nil)
+		assert.Equal(t, got, c.BadInput(tc.want))
+	}
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+func runCheck(t *testing.T, args ...string) command.CmdErr {
+	c := cmd()
+	err := c.Flags.Parse(append([]string{"-check", "-vars", "x=X"}, args...))
+	assert.Nil(t, err)
+	return c.Runner.Run(c, nil)
+}
+
+func TestRunCheckUnchanged(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"in.tmpl": "a{{x}}", "out": "aX"})
+	defer cleanup()
+	out := filepath.Join(dir, "out")
+
+	got := runCheck(t, "-in", filepath.Join(dir, "in.tmpl"), "-out", out)
+	assert.Equal(t, got, command.NoError())
+	assertFileContents(t, out, "aX")
+}
+
+func TestRunCheckChanged(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"in.tmpl": "a{{x}}", "out": "a"})
+	defer cleanup()
+	out := filepath.Join(dir, "out")
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-check", "-vars", "x=X", "-in", filepath.Join(dir, "in.tmpl"), "-out", out})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.CmdErr{
+		Cmd:     c,
+		Code:    checkDriftCode,
+		Message: "1 output file(s) would change: " + out,
+	})
+	assertFileContents(t, out, "a")
+}
+
+func TestRunCheckSameFile(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"in": "a{{x}}"})
+	defer cleanup()
+	in := filepath.Join(dir, "in")
+
+	got := runCheck(t, "-in", in, "-out", in)
+	assert.Equal(t, got.Code, checkDriftCode)
+	assertFileContents(t, in, "a{{x}}")
+	assertNoFile(t, in+".bak")
+}
+
+func TestRunCheckMissingOutput(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"in.tmpl": "a{{x}}"})
+	defer cleanup()
+	out := filepath.Join(dir, "out")
+
+	got := runCheck(t, "-in", filepath.Join(dir, "in.tmpl"), "-out", out)
+	assert.Equal(t, got.Code, checkDriftCode)
+	assertNoFile(t, out)
+}
+
+func TestRunCheckSkipEmpty(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"in.tmpl": " \n", "stale": "x"})
+	defer cleanup()
+	in := filepath.Join(dir, "in.tmpl")
+
+	got := runCheck(t, "-skip-empty", "-in", in, "-out", filepath.Join(dir, "missing"))
+	assert.Equal(t, got, command.NoError())
+
+	got = runCheck(t, "-skip-empty", "-in", in, "-out", filepath.Join(dir, "stale"))
+	assert.Equal(t, got.Code, checkDriftCode)
+	assertFileContents(t, filepath.Join(dir, "stale"), "x")
+}
+
+func TestRunCheckDiff(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"in.tmpl": "a{{x}}\n", "out": "a\n"})
+	defer cleanup()
+	out := filepath.Join(dir, "out")
+
+	stdout := &bytes.Buffer{}
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().Stdout().Return(stdout)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-check", "-diff", "-vars", "x=X", "-in", filepath.Join(dir, "in.tmpl"), "-out", out})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got.Code, checkDriftCode)
+	assert.StringContains(t, stdout.String(), "-a\n+aX\n")
+	assertFileContents(t, out, "a\n")
+}
+
+func TestRunCheckBatch(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.tmpl": "a={{x}}",
+		"b.tmpl": "b={{x}}",
+		"c.tmpl": "c={{x}}",
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, map[string]string{"a": "a=X", "b": "b=old"})
+	defer cleanupOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-check", "-vars", "x=X", "-in", in, "-out", out, "-strip-suffix", ".tmpl"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got.Code, checkDriftCode)
+	assert.Equal(
+		t,
+		got.Message,
+		"2 output file(s) would change: "+filepath.Join(out, "b")+", "+filepath.Join(out, "c"),
+	)
+	assertFileContents(t, filepath.Join(out, "b"), "b=old")
+	assertNoFile(t, filepath.Join(out, "c"))
+}
+
+func TestRunCheckBatchCreatesNoDirs(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{"sub/a.tmpl": "a={{x}}"})
+	defer cleanupIn()
+
+	out := filepath.Join(in, "out")
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-check", "-vars", "x=X", "-in", in, "-out", out, "-strip-suffix", ".tmpl"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got.Code, checkDriftCode)
+	assert.Equal(t, got.Message, "1 output file(s) would change: "+filepath.Join(out, "sub", "a"))
+	assertNoFile(t, out)
+}
+
+func TestRunCheckRequiresOut(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-check"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--check requires --out"))
+}
+
+func TestRunCheckLint(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-check", "-lint", "-out", "x"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--lint and --check may not be combined"))
+}
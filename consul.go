@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultConsulAddr = "127.0.0.1:8500"
+
+// consulKey returns the value of the key at path in the Consul KV store.
+// Each key is fetched at most once.
+func (r *runner) consulKey(path string) (string, error) {
+	path = strings.Trim(path, "/")
+	if value, ok := r.consulKeys[path]; ok {
+		return value, nil
+	}
+
+	req, err := r.consulRequest(path, "raw")
+	if err != nil {
+		return "", fmt.Errorf("consulKey: %s", err)
+	}
+	value, err := r.fetch(req)
+	if err != nil {
+		if herr, ok := err.(httpError); ok && herr.statusCode == http.StatusNotFound {
+			return "", fmt.Errorf("consulKey: no key %q", path)
+		}
+		return "", fmt.Errorf("consulKey: %s", err)
+	}
+
+	r.consulKeys[path] = string(value)
+	return string(value), nil
+}
+
+// consulTree returns the keys and values in the Consul KV store in the
+// folder prefix, with prefix and its trailing slash removed from the keys.
+// A missing prefix yields an empty map. Each prefix is fetched at most once.
+func (r *runner) consulTree(prefix string) (map[string]string, error) {
+	prefix = strings.Trim(prefix, "/")
+	if tree, ok := r.consulTrees[prefix]; ok {
+		return tree, nil
+	}
+
+	// a trailing slash excludes siblings sharing the prefix, such as
+	// service/web/environment for service/web/env
+	base := ""
+	if prefix != "" {
+		base = prefix + "/"
+	}
+
+	req, err := r.consulRequest(base, "recurse")
+	if err != nil {
+		return nil, fmt.Errorf("consulTree: %s", err)
+	}
+	var entries []struct {
+		Key   string
+		Value []byte
+	}
+	if err := r.getJSON(req, &entries); err != nil {
+		if herr, ok := err.(httpError); !ok || herr.statusCode != http.StatusNotFound {
+			return nil, fmt.Errorf("consulTree: %s", err)
+		}
+	}
+
+	tree := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Key, base) {
+			continue
+		}
+		key := strings.TrimPrefix(entry.Key, base)
+		// folders have keys ending in a slash
+		if key == "" || strings.HasSuffix(key, "/") {
+			continue
+		}
+		tree[key] = string(entry.Value)
+	}
+
+	r.consulTrees[prefix] = tree
+	return tree, nil
+}
+
+// consulRequest returns a request for the KV endpoint at path, with the
+// given query parameter. The agent and token are given by --consul-addr and
+// --consul-token, or $CONSUL_HTTP_ADDR and $CONSUL_HTTP_TOKEN.
+func (r *runner) consulRequest(path, param string) (*http.Request, error) {
+	addr := r.consulAddr
+	if addr == "" {
+		addr, _ = r.os.LookupEnv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = defaultConsulAddr
+	}
+	if !strings.Contains(addr, "://") {
+		scheme := "http"
+		if ssl, _ := r.os.LookupEnv("CONSUL_HTTP_SSL"); strings.EqualFold(ssl, "true") {
+			scheme = "https"
+		}
+		addr = scheme + "://" + addr
+	}
+
+	u := strings.TrimRight(addr, "/") + "/v1/kv/" + (&url.URL{Path: path}).EscapedPath() + "?" + param
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	token := r.consulToken
+	if token == "" {
+		token, _ = r.os.LookupEnv("CONSUL_HTTP_TOKEN")
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	return req, nil
+}
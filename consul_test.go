@@ -0,0 +1,165 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// mkConsulServer returns a Consul agent that serves the given keys, and a
+// count of the requests it has received.
+func mkConsulServer(t *testing.T, kv map[string]string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("X-Consul-Token") != "acl" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, "ACL not found")
+			return
+		}
+
+		key := strings.TrimPrefix(req.URL.Path, "/v1/kv/")
+		switch req.URL.RawQuery {
+		case "raw":
+			value, ok := kv[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, value)
+
+		case "recurse":
+			type entry struct {
+				Key   string
+				Value []byte
+			}
+			entries := []entry{}
+			for k, v := range kv {
+				if strings.HasPrefix(k, key) {
+					e := entry{Key: k}
+					if !strings.HasSuffix(k, "/") {
+						e.Value = []byte(v)
+					}
+					entries = append(entries, e)
+				}
+			}
+			if len(entries) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(entries)
+
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	return server, &requests
+}
+
+func TestConsulKey(t *testing.T) {
+	server, requests := mkConsulServer(t, map[string]string{"service/web/max_conns": "100"})
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{"CONSUL_HTTP_TOKEN": "acl"})
+	defer finish()
+	r.consulAddr = server.URL
+
+	got, err := r.consulKey("service/web/max_conns")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "100")
+
+	got, err = r.consulKey("/service/web/max_conns")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "100")
+
+	_, err = r.consulKey("service/web/missing")
+	assert.ErrorContains(t, err, `consulKey: no key "service/web/missing"`)
+
+	// fetched once for each key
+	assert.Equal(t, *requests, 2)
+}
+
+func TestConsulKeyEnv(t *testing.T) {
+	server, _ := mkConsulServer(t, map[string]string{"a": "b"})
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{
+		"CONSUL_HTTP_ADDR":  strings.TrimPrefix(server.URL, "http://"),
+		"CONSUL_HTTP_TOKEN": "wrong",
+	})
+	defer finish()
+
+	_, err := r.consulKey("a")
+	assert.ErrorContains(t, err, "consulKey: GET /v1/kv/a returned 403 Forbidden: ACL not found")
+
+	r.consulToken = "acl"
+	got, err := r.consulKey("a")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "b")
+}
+
+func TestConsulTree(t *testing.T) {
+	server, requests := mkConsulServer(t, map[string]string{
+		"service/web/env/":          "",
+		"service/web/env/STAGE":     "prod",
+		"service/web/env/db/":       "",
+		"service/web/env/db/HOST":   "db.example.com",
+		"service/web/environment/X": "sibling",
+		"service/web/envoy":         "sibling",
+		"service/web/max_conns":     "100",
+		"service/worker/env/STAGE":  "dev",
+	})
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{"CONSUL_HTTP_TOKEN": "acl"})
+	defer finish()
+	r.consulAddr = server.URL + "/"
+
+	got, err := r.consulTree("service/web/env/")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, map[string]string{"STAGE": "prod", "db/HOST": "db.example.com"})
+
+	got, err = r.consulTree("service/web/env")
+	assert.Nil(t, err)
+	assert.Equal(t, len(got), 2)
+
+	got, err = r.consulTree("service/missing")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, map[string]string{})
+
+	// fetched once for each prefix
+	assert.Equal(t, *requests, 2)
+}
+
+func TestConsulTreeError(t *testing.T) {
+	server, _ := mkConsulServer(t, nil)
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, nil)
+	defer finish()
+	r.consulAddr = server.URL
+
+	_, err := r.consulTree("service")
+	assert.ErrorContains(t, err, "consulTree: GET /v1/kv/service/ returned 403 Forbidden")
+}
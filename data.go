@@ -0,0 +1,208 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/turbinelabs/envtemplate/envtemplate"
+)
+
+// loadDataFile reads the named JSON or YAML file, chosen by extension, and
+// returns its top-level object.
+func loadDataFile(filename string) (map[string]interface{}, error) {
+	return loadObjectFile("data", filename, false)
+}
+
+// loadDataFiles reads each of the named data files, as loadDataFile does,
+// and deep-merges them in order.
+func loadDataFiles(filenames []string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	for _, filename := range filenames {
+		fileData, err := loadDataFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		data = mergeData(data, fileData)
+	}
+	return data, nil
+}
+
+// mergeData returns the result of merging src over dst. Objects present in
+// both are merged recursively; otherwise values from src replace those in
+// dst. Neither argument is modified.
+func mergeData(dst, src map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(dst)+len(src))
+	for k, v := range dst {
+		merged[k] = v
+	}
+	for k, v := range src {
+		srcMap, srcOK := v.(map[string]interface{})
+		dstMap, dstOK := merged[k].(map[string]interface{})
+		if srcOK && dstOK {
+			merged[k] = mergeData(dstMap, srcMap)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// loadVarsFile reads the named JSON or YAML file, chosen by extension, which
+// must contain an object whose values are scalars. Non-string scalars are
+// converted to strings, with numbers written without an exponent. If the file is encrypted with SOPS, it is decrypted
+// using sops, which requires allowExec.
+func loadVarsFile(filename string, allowExec bool) (map[string]string, error) {
+	raw, err := loadVarsObject(filename, allowExec)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("vars file %s: value of %q must be a string", filename, name)
+		case nil:
+			vars[name] = ""
+		case float64:
+			vars[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			vars[name] = fmt.Sprint(value)
+		}
+	}
+	return vars, nil
+}
+
+// loadVarsObject reads the named JSON or YAML vars file, as for loadVarsFile,
+// but returns its top-level object with values unconverted.
+func loadVarsObject(filename string, allowExec bool) (map[string]interface{}, error) {
+	raw, err := loadObjectFile("vars", filename, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if isSOPSEncrypted(raw) {
+		if !allowExec {
+			return nil, fmt.Errorf("vars file %s is encrypted with SOPS; decrypting it requires --allow-exec", filename)
+		}
+		if raw, err = sopsDecrypt(filename); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// loadObjectFile reads the named JSON or YAML file and returns its top-level
+// object. The kind of file is used in error messages. If exactInts is set,
+// JSON integers are decoded as ints, as they are from YAML, rather than as
+// float64s.
+func loadObjectFile(kind, filename string, exactInts bool) (map[string]interface{}, error) {
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{}
+
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".json":
+		if exactInts {
+			err = unmarshalJSONInts(bytes, &data)
+		} else {
+			err = json.Unmarshal(bytes, &data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not parse %s file %s: %s", kind, filename, err)
+		}
+
+	case ".yaml", ".yml":
+		var raw interface{}
+		if err := yaml.Unmarshal(bytes, &raw); err != nil {
+			return nil, fmt.Errorf("could not parse %s file %s: %s", kind, filename, err)
+		}
+		if raw == nil {
+			return data, nil
+		}
+		m, ok := envtemplate.NormalizeYAML(raw).(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s file %s must contain an object", kind, filename)
+		}
+		data = m
+
+	default:
+		return nil, fmt.Errorf("unsupported %s file extension %q", kind, ext)
+	}
+
+	return data, nil
+}
+
+// unmarshalJSONInts decodes b into the object *m, as json.Unmarshal does,
+// except that integers that fit in an int are decoded as ints. Other numbers
+// are decoded as float64s.
+func unmarshalJSONInts(b []byte, m *map[string]interface{}) error {
+	if !json.Valid(b) {
+		// report syntax errors exactly as json.Unmarshal does
+		return json.Unmarshal(b, m)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(m); err != nil {
+		return err
+	}
+
+	for k, v := range *m {
+		(*m)[k] = jsonInts(v)
+	}
+	return nil
+}
+
+// jsonInts replaces the json.Numbers within v with ints or float64s.
+func jsonInts(v interface{}) interface{} {
+	switch t := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(t.String(), 10, 0); err == nil {
+			return int(i)
+		}
+		f, _ := t.Float64()
+		return f
+
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = jsonInts(e)
+		}
+		return t
+
+	case []interface{}:
+		for i, e := range t {
+			t[i] = jsonInts(e)
+		}
+		return t
+
+	default:
+		return v
+	}
+}
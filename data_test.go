@@ -0,0 +1,237 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// writeNamedTempFile writes contents to a file with the given base name in a
+// new temporary directory, returning the file's path and a cleanup function.
+func writeNamedTempFile(t testing.TB, name, contents string) (string, func()) {
+	dir, err := ioutil.TempDir("", "envtemplate")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %s", err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("could not write %s: %s", path, err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestLoadDataFileJSON(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "data.json", `{"a": "b", "c": {"d": [1, 2]}}`)
+	defer remove()
+
+	data, err := loadDataFile(f)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, data, map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": []interface{}{1.0, 2.0}},
+	})
+}
+
+func TestLoadDataFileYAML(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "data.yaml", "a: b\nc:\n  d:\n  - 1\n  - 2\n")
+	defer remove()
+
+	data, err := loadDataFile(f)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, data, map[string]interface{}{
+		"a": "b",
+		"c": map[string]interface{}{"d": []interface{}{1, 2}},
+	})
+}
+
+func TestLoadDataFileYAMLAliases(t *testing.T) {
+	f, remove := writeNamedTempFile(
+		t,
+		"data.yaml",
+		"defaults: &defaults\n  host: db\n  port: 5432\nprimary: *defaults\nport: &port 80\nproxy: *port\n",
+	)
+	defer remove()
+
+	data, err := loadDataFile(f)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, data["primary"], map[string]interface{}{"host": "db", "port": 5432})
+	assert.Equal(t, data["proxy"], 80)
+}
+
+func TestLoadDataFileEmptyYAML(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "data.yml", "")
+	defer remove()
+
+	data, err := loadDataFile(f)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, data, map[string]interface{}{})
+}
+
+func TestLoadDataFileBadJSON(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "data.json", `{"a":`)
+	defer remove()
+
+	data, err := loadDataFile(f)
+	assert.Nil(t, data)
+	assert.ErrorContains(t, err, "could not parse data file")
+}
+
+func TestLoadDataFileNotObject(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "data.yaml", "- a\n- b\n")
+	defer remove()
+
+	data, err := loadDataFile(f)
+	assert.Nil(t, data)
+	assert.ErrorContains(t, err, "must contain an object")
+}
+
+func TestLoadDataFileBadExtension(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "data.ini", "a=b")
+	defer remove()
+
+	data, err := loadDataFile(f)
+	assert.Nil(t, data)
+	assert.ErrorContains(t, err, "unsupported data file extension")
+}
+
+func TestMergeData(t *testing.T) {
+	dst := map[string]interface{}{
+		"a": "1",
+		"db": map[string]interface{}{
+			"host":  "localhost",
+			"port":  5432,
+			"hosts": []interface{}{"a", "b"},
+			"opts":  map[string]interface{}{"ssl": false, "timeout": 10},
+		},
+		"replaced": map[string]interface{}{"x": 1},
+	}
+	src := map[string]interface{}{
+		"b": "2",
+		"db": map[string]interface{}{
+			"host":  "db.example.com",
+			"hosts": []interface{}{"c"},
+			"opts":  map[string]interface{}{"ssl": true},
+		},
+		"replaced": "scalar",
+	}
+
+	got := mergeData(dst, src)
+	assert.DeepEqual(t, got, map[string]interface{}{
+		"a": "1",
+		"b": "2",
+		"db": map[string]interface{}{
+			"host":  "db.example.com",
+			"port":  5432,
+			"hosts": []interface{}{"c"},
+			"opts":  map[string]interface{}{"ssl": true, "timeout": 10},
+		},
+		"replaced": "scalar",
+	})
+
+	// inputs are unchanged
+	assert.Equal(t, dst["db"].(map[string]interface{})["host"], "localhost")
+	assert.Equal(t, dst["db"].(map[string]interface{})["opts"].(map[string]interface{})["ssl"], false)
+}
+
+func TestLoadDataFiles(t *testing.T) {
+	defaults, removeDefaults := writeNamedTempFile(
+		t,
+		"defaults.yaml",
+		"db:\n  host: localhost\n  port: 5432\n  opts:\n    ssl: false\n    timeout: 10\n",
+	)
+	defer removeDefaults()
+
+	overrides, removeOverrides := writeNamedTempFile(
+		t,
+		"overrides.json",
+		`{"db": {"host": "db.example.com", "opts": {"ssl": true}}, "stage": "prod"}`,
+	)
+	defer removeOverrides()
+
+	data, err := loadDataFiles([]string{defaults, overrides})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, data, map[string]interface{}{
+		"db": map[string]interface{}{
+			"host": "db.example.com",
+			"port": 5432,
+			"opts": map[string]interface{}{"ssl": true, "timeout": 10},
+		},
+		"stage": "prod",
+	})
+}
+
+func TestLoadDataFilesError(t *testing.T) {
+	good, removeGood := writeNamedTempFile(t, "good.json", `{}`)
+	defer removeGood()
+
+	bad, removeBad := writeNamedTempFile(t, "bad.json", `{`)
+	defer removeBad()
+
+	_, err := loadDataFiles([]string{good, bad})
+	assert.ErrorContains(t, err, "could not parse data file "+bad)
+}
+
+func TestLoadVarsFileJSON(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "vars.json", `{"a": "b", "port": 8080, "on": true, "none": null}`)
+	defer remove()
+
+	vars, err := loadVarsFile(f, false)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, vars, map[string]string{"a": "b", "port": "8080", "on": "true", "none": ""})
+}
+
+func TestLoadVarsFileLargeNumbers(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "vars.json", `{"n": 1000000, "big": 12345678901234, "f": 0.5}`)
+	defer remove()
+
+	vars, err := loadVarsFile(f, false)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, vars, map[string]string{"n": "1000000", "big": "12345678901234", "f": "0.5"})
+}
+
+func TestLoadVarsFileYAML(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "vars.yml", "a: b\nport: 8080\n")
+	defer remove()
+
+	vars, err := loadVarsFile(f, false)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, vars, map[string]string{"a": "b", "port": "8080"})
+}
+
+func TestLoadVarsFileNonScalar(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "vars.json", `{"a": ["b"]}`)
+	defer remove()
+
+	vars, err := loadVarsFile(f, false)
+	assert.Nil(t, vars)
+	assert.ErrorContains(t, err, `value of "a" must be a string`)
+}
+
+func TestLoadVarsFileBadYAML(t *testing.T) {
+	f, remove := writeNamedTempFile(t, "vars.yaml", "a: 'b\n")
+	defer remove()
+
+	vars, err := loadVarsFile(f, false)
+	assert.Nil(t, vars)
+	assert.ErrorContains(t, err, "could not parse vars file")
+}
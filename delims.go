@@ -0,0 +1,128 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	defaultLeftDelim  = "{{"
+	defaultRightDelim = "}}"
+)
+
+// checkDelims scans src for template action delimiters and returns an error
+// describing the first unmatched delimiter if they are unbalanced. Delimiters
+// appearing within quoted strings or comments inside an action are ignored,
+// as the template parser would. Empty delimiters select the defaults.
+func checkDelims(src []byte, left, right string) error {
+	if left == "" {
+		left = defaultLeftDelim
+	}
+	if right == "" {
+		right = defaultRightDelim
+	}
+
+	var (
+		lefts, rights  int
+		open           []int
+		unmatchedRight int
+		line           = 1
+	)
+
+	for i := 0; i < len(src); {
+		switch {
+		case bytes.HasPrefix(src[i:], []byte(left)):
+			lefts++
+			open = append(open, line)
+			i += len(left)
+
+		case bytes.HasPrefix(src[i:], []byte(right)):
+			rights++
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			} else if unmatchedRight == 0 {
+				unmatchedRight = line
+			}
+			i += len(right)
+
+		case len(open) > 0 && isQuote(src[i]):
+			n := skipQuoted(src[i:])
+			line += bytes.Count(src[i:i+n], []byte("\n"))
+			i += n
+
+		case len(open) > 0 && bytes.HasPrefix(src[i:], []byte("/*")):
+			n := len(src) - i
+			if end := bytes.Index(src[i+2:], []byte("*/")); end >= 0 {
+				n = end + 4
+			}
+			line += bytes.Count(src[i:i+n], []byte("\n"))
+			i += n
+
+		default:
+			if src[i] == '\n' {
+				line++
+			}
+			i++
+		}
+	}
+
+	var (
+		delim     string
+		firstLine int
+	)
+	switch {
+	case len(open) > 0 && (unmatchedRight == 0 || open[0] < unmatchedRight):
+		delim, firstLine = left, open[0]
+	case unmatchedRight != 0:
+		delim, firstLine = right, unmatchedRight
+	default:
+		return nil
+	}
+
+	return fmt.Errorf(
+		"unbalanced delimiters: %d left, %d right; first unmatched %q on line %d",
+		lefts,
+		rights,
+		delim,
+		firstLine,
+	)
+}
+
+func isQuote(b byte) bool {
+	return b == '"' || b == '\'' || b == '`'
+}
+
+// skipQuoted returns the length of the quoted string or character constant
+// at the start of src, including its quotes. Unterminated interpreted
+// strings and character constants end at a newline; raw strings at the end
+// of src.
+func skipQuoted(src []byte) int {
+	quote := src[0]
+	for i := 1; i < len(src); i++ {
+		switch {
+		case src[i] == quote:
+			return i + 1
+		case src[i] == '\\' && quote != '`':
+			i++
+		case src[i] == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(src)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestCheckDelimsBalanced(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"no actions",
+		`{{env "A"}} {{if .B}}{{.B}}{{end}}`,
+		`{{print "}}"}}{{print "{{\"}}"}}{{print '}'}}{{print ` + "`}}`" + `}}`,
+		`{{/* }} */}}`,
+		"{{.A\n}}\n{{.B}}",
+	} {
+		assert.Nil(t, checkDelims([]byte(src), "", ""))
+	}
+}
+
+func TestCheckDelimsCustom(t *testing.T) {
+	assert.Nil(t, checkDelims([]byte(`{{ [[env "A"]] }} [["]]"]]`), "[[", "]]"))
+
+	err := checkDelims([]byte("[[.A]]\n[[.B\n[[.C]]"), "[[", "]]")
+	assert.ErrorContains(t, err, `unbalanced delimiters: 3 left, 2 right; first unmatched "[[" on line 2`)
+}
+
+func TestCheckDelimsUnbalanced(t *testing.T) {
+	testCases := []struct {
+		src  string
+		want string
+	}{
+		{
+			src:  "{{.A}}\n{{.B}\n{{.C}}",
+			want: `unbalanced delimiters: 3 left, 2 right; first unmatched "{{" on line 2`,
+		},
+		{
+			src:  "{{.A}}\n.B}}\n{{.C}}",
+			want: `unbalanced delimiters: 2 left, 3 right; first unmatched "}}" on line 2`,
+		},
+		{
+			src:  "x }}\n{{ y",
+			want: `unbalanced delimiters: 1 left, 1 right; first unmatched "}}" on line 1`,
+		},
+	}
+
+	for _, tc := range testCases {
+		assert.ErrorContains(t, checkDelims([]byte(tc.src), "", ""), tc.want)
+	}
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// deprecatedFuncs maps the names of deprecated template functions to the
+// names of the functions that replace them. Deprecated names continue to
+// work, but produce a warning on STDERR the first time they are used.
+var deprecatedFuncs = map[string]string{}
+
+// deprecatedFunc wraps fn, the implementation of replacement, such that a
+// warning is emitted the first time it's called via the deprecated name.
+func (r *runner) deprecatedFunc(name, replacement string, fn interface{}) interface{} {
+	fnValue := reflect.ValueOf(fn)
+	variadic := fnValue.Type().IsVariadic()
+
+	var once sync.Once
+	wrapper := func(args []reflect.Value) []reflect.Value {
+		if r.deprecationWarnings {
+			once.Do(func() {
+				fmt.Fprintf(
+					r.os.Stderr(),
+					"warning: template function %q is deprecated, use %q instead\n",
+					name,
+					replacement,
+				)
+			})
+		}
+		if variadic {
+			return fnValue.CallSlice(args)
+		}
+		return fnValue.Call(args)
+	}
+
+	return reflect.MakeFunc(fnValue.Type(), wrapper).Interface()
+}
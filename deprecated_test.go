@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestDeprecatedFuncsHaveReplacements(t *testing.T) {
+	r := cmd().Runner.(*runner)
+	funcs, err := r.mkFuncMap()
+	assert.Nil(t, err)
+
+	for name, replacement := range deprecatedFuncs {
+		_, ok := funcs[replacement]
+		assert.True(t, ok)
+		_, ok = funcs[name]
+		assert.True(t, ok)
+	}
+}
+
+func testRunDeprecated(t *testing.T, args []string, wantStderr string) {
+	out := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{oldEnv "BAR"}}{{oldEnv "BAR"}}{{oldAllSet "BAR" "BAR"}}`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BAR").Return("bar", true).Times(4)
+	if wantStderr != "" {
+		mockOS.EXPECT().Stderr().Return(stderr).Times(2)
+	}
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.deprecated = map[string]string{"oldEnv": "env", "oldAllSet": "allSet"}
+
+	err := c.Flags.Parse(args)
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "barbartrue")
+	assert.Equal(t, stderr.String(), wantStderr)
+}
+
+func TestRunDeprecatedFunc(t *testing.T) {
+	testRunDeprecated(
+		t,
+		nil,
+		`warning: template function "oldEnv" is deprecated, use "env" instead
+warning: template function "oldAllSet" is deprecated, use "allSet" instead
+`,
+	)
+}
+
+func TestRunDeprecatedFuncNoWarnings(t *testing.T) {
+	testRunDeprecated(t, []string{"-deprecation-warnings=false"}, "")
+}
+
+func TestRunDeprecatedFuncAsVariable(t *testing.T) {
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.deprecated = map[string]string{"oldEnv": "env"}
+
+	err := c.Flags.Parse([]string{"-vars", "oldEnv=x"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`"oldEnv" cannot be used as a variable name`))
+}
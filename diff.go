@@ -0,0 +1,293 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	diffContextLines = 3
+
+	// maxDiffEdits bounds the inserted and deleted lines diffLines searches
+	// for, and so the O(D²) memory used by its trace.
+	maxDiffEdits = 2000
+
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorCyan   = "\x1b[36m"
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
+type diffOp struct {
+	kind byte // ' ', '-', or '+'
+	line string
+}
+
+// diffLines computes a minimal edit script transforming a into b, using
+// Myers' O(ND) algorithm. It returns false if more than maxDiffEdits lines
+// must be inserted or deleted.
+func diffLines(a, b []string) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+
+	// trace[d] holds v for diagonals -d-1 through d+1 at the start of round
+	// d, which is all the backtracking below reads, so that the trace grows
+	// with the number of edits rather than the length of the input.
+	trace := [][]int{}
+
+search:
+	for d := 0; d <= max; d++ {
+		if d > maxDiffEdits {
+			return nil, false
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		offset := d + 1
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{'+', b[y-1]})
+			} else {
+				ops = append(ops, diffOp{'-', a[x-1]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, true
+}
+
+// unifiedDiff writes a unified diff transforming from into to. It returns
+// true if the contents differ. If color is true, the diff is colorized with
+// ANSI escape sequences. If the contents differ by more than maxDiffEdits
+// lines, only that they differ is reported.
+func unifiedDiff(
+	w io.Writer,
+	fromName, toName string,
+	from, to []byte,
+	color bool,
+) (bool, error) {
+	ops, ok := diffLines(linesOf(string(from)), linesOf(string(to)))
+	if !ok {
+		_, err := fmt.Fprintf(w, "Files %s and %s differ\n", fromName, toName)
+		return true, err
+	}
+
+	changed := false
+	for _, op := range ops {
+		if op.kind != ' ' {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + colorReset
+	}
+
+	ew := &errWriter{w: w}
+	ew.printf("%s\n", paint(colorBold, "--- "+fromName))
+	ew.printf("%s\n", paint(colorBold, "+++ "+toName))
+
+	for start := 0; start < len(ops); {
+		// find the next change
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// extend the hunk until more than 2*context unchanged lines follow
+		end := start
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContextLines {
+				break
+			}
+			end = run
+		}
+
+		hunkStart := start - diffContextLines
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := end + diffContextLines
+		if hunkEnd > len(ops) {
+			hunkEnd = len(ops)
+		}
+
+		fromLine, toLine := 1, 1
+		for _, op := range ops[:hunkStart] {
+			if op.kind != '+' {
+				fromLine++
+			}
+			if op.kind != '-' {
+				toLine++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, op := range ops[hunkStart:hunkEnd] {
+			if op.kind != '+' {
+				fromCount++
+			}
+			if op.kind != '-' {
+				toCount++
+			}
+		}
+
+		ew.printf(
+			"%s\n",
+			paint(
+				colorCyan,
+				fmt.Sprintf("@@ -%s +%s @@", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount)),
+			),
+		)
+
+		for _, op := range ops[hunkStart:hunkEnd] {
+			line := string(op.kind) + strings.TrimSuffix(op.line, "\n")
+			switch op.kind {
+			case '-':
+				line = paint(colorRed, line)
+			case '+':
+				line = paint(colorGreen, line)
+			}
+			ew.printf("%s\n", line)
+			if !strings.HasSuffix(op.line, "\n") {
+				ew.printf("\\ No newline at end of file\n")
+			}
+		}
+
+		start = hunkEnd
+	}
+
+	return true, ew.err
+}
+
+// linesOf splits s into lines, each retaining its trailing newline, if any.
+func linesOf(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// hunkRange formats a unified diff hunk range. As with GNU diff, a count of
+// one is omitted, and an empty range refers to the line before it.
+func hunkRange(line, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", line-1)
+	case 1:
+		return fmt.Sprintf("%d", line)
+	default:
+		return fmt.Sprintf("%d,%d", line, count)
+	}
+}
+
+// errWriter is an io.Writer wrapper that records the first write error and
+// ignores subsequent writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
+
+// isTerminal returns true if w is a character device, such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+func diffString(t *testing.T, from, to string, color bool) string {
+	buf := &bytes.Buffer{}
+	changed, err := unifiedDiff(buf, "a", "b", []byte(from), []byte(to), color)
+	assert.Nil(t, err)
+	assert.Equal(t, changed, buf.Len() > 0)
+	return buf.String()
+}
+
+func TestDiffLines(t *testing.T) {
+	ops, ok := diffLines([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"})
+	assert.True(t, ok)
+	assert.DeepEqual(t, ops, []diffOp{
+		{' ', "a"},
+		{'-', "b"},
+		{'+', "x"},
+		{' ', "c"},
+		{'+', "d"},
+	})
+
+	ops, _ = diffLines(nil, nil)
+	assert.DeepEqual(t, ops, []diffOp{})
+	ops, _ = diffLines(nil, []string{"a"})
+	assert.DeepEqual(t, ops, []diffOp{{'+', "a"}})
+	ops, _ = diffLines([]string{"a"}, nil)
+	assert.DeepEqual(t, ops, []diffOp{{'-', "a"}})
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// replacing every 25th of 20000 lines takes 1600 edits, which would
+	// need a 64 million entry trace if each round copied the whole search state
+	a := make([]string, 20000)
+	b := make([]string, len(a))
+	for i := range a {
+		a[i] = fmt.Sprintf("line %d\n", i)
+		b[i] = a[i]
+		if i%25 == 0 {
+			b[i] = fmt.Sprintf("changed %d\n", i)
+		}
+	}
+
+	ops, ok := diffLines(a, b)
+	assert.True(t, ok)
+	assert.Equal(t, len(ops), len(a)+len(a)/25)
+
+	counts := map[byte]int{}
+	for _, op := range ops {
+		counts[op.kind]++
+	}
+	assert.DeepEqual(t, counts, map[byte]int{' ': 19200, '-': 800, '+': 800})
+}
+
+func TestDiffLinesTooManyEdits(t *testing.T) {
+	a := make([]string, maxDiffEdits)
+	b := make([]string, len(a))
+	for i := range a {
+		a[i] = fmt.Sprintf("a%d\n", i)
+		b[i] = fmt.Sprintf("b%d\n", i)
+	}
+
+	_, ok := diffLines(a, b)
+	assert.False(t, ok)
+
+	from := strings.Join(a, "")
+	to := strings.Join(b, "")
+	assert.Equal(t, diffString(t, from, to, false), "Files a and b differ\n")
+}
+
+func TestUnifiedDiffUnchanged(t *testing.T) {
+	assert.Equal(t, diffString(t, "a\nb\n", "a\nb\n", false), "")
+	assert.Equal(t, diffString(t, "", "", true), "")
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	to := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\nsixteen\n"
+	assert.Equal(
+		t,
+		diffString(t, from, to, false),
+		`--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -11,5 +11,5 @@
+ 11
+ 12
+ 13
+-14
+ 15
++sixteen
+`,
+	)
+}
+
+func TestUnifiedDiffMergesNearbyHunks(t *testing.T) {
+	from := "1\n2\n3\n4\n5\n6\n7\n8\n"
+	to := "one\n2\n3\n4\n5\n6\n7\neight\n"
+	assert.Equal(
+		t,
+		diffString(t, from, to, false),
+		`--- a
++++ b
+@@ -1,8 +1,8 @@
+-1
++one
+ 2
+ 3
+ 4
+ 5
+ 6
+ 7
+-8
++eight
+`,
+	)
+}
+
+func TestUnifiedDiffEmptyFrom(t *testing.T) {
+	assert.Equal(t, diffString(t, "", "a\n", false), "--- a\n+++ b\n@@ -0,0 +1 @@\n+a\n")
+}
+
+func TestUnifiedDiffNoNewlineAtEOF(t *testing.T) {
+	assert.Equal(
+		t,
+		diffString(t, "a\nb", "a\nb\n", false),
+		"--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+	)
+}
+
+func TestUnifiedDiffColor(t *testing.T) {
+	assert.Equal(
+		t,
+		diffString(t, "a\nb\n", "a\nc\n", true),
+		"\x1b[1m--- a\x1b[0m\n"+
+			"\x1b[1m+++ b\x1b[0m\n"+
+			"\x1b[36m@@ -1,2 +1,2 @@\x1b[0m\n"+
+			" a\n"+
+			"\x1b[31m-b\x1b[0m\n"+
+			"\x1b[32m+c\x1b[0m\n",
+	)
+}
+
+func TestIsTerminal(t *testing.T) {
+	assert.False(t, isTerminal(&bytes.Buffer{}))
+
+	f, remove := tempfile.Make(t)
+	defer remove()
+	file, err := os.Open(f)
+	assert.Nil(t, err)
+	defer file.Close()
+	assert.False(t, isTerminal(file))
+}
+
+func testRunDiff(t *testing.T, args []string, current *string, want string) {
+	in, removeIn := tempfile.Write(t, "a\nb{{x}}\nc\n")
+	defer removeIn()
+	out, removeOut := tempfile.Make(t)
+	defer removeOut()
+	if current == nil {
+		removeOut()
+	} else {
+		assert.Nil(t, ioutil.WriteFile(out, []byte(*current), 0644))
+	}
+
+	stdout := &bytes.Buffer{}
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().Stdout().Return(stdout)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse(append([]string{"-in", in, "-out", out, "-vars", "x=X", "-diff"}, args...))
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, stdout.String(), strings.Replace(want, "OUT", out, -1))
+
+	gotOut, err := ioutil.ReadFile(out)
+	if current == nil {
+		assert.True(t, os.IsNotExist(err))
+	} else {
+		assert.Nil(t, err)
+		assert.Equal(t, string(gotOut), *current)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	current := "a\nb\nc\n"
+	testRunDiff(
+		t,
+		nil,
+		&current,
+		"--- OUT\n+++ OUT (rendered)\n@@ -1,3 +1,3 @@\n a\n-b\n+bX\n c\n",
+	)
+}
+
+func TestRunDiffColor(t *testing.T) {
+	current := "a\nb\nc\n"
+	testRunDiff(
+		t,
+		[]string{"-color", "always"},
+		&current,
+		"\x1b[1m--- OUT\x1b[0m\n\x1b[1m+++ OUT (rendered)\x1b[0m\n\x1b[36m@@ -1,3 +1,3 @@\x1b[0m\n"+
+			" a\n\x1b[31m-b\x1b[0m\n\x1b[32m+bX\x1b[0m\n c\n",
+	)
+}
+
+func TestRunDiffMissingOutput(t *testing.T) {
+	testRunDiff(t, nil, nil, "--- OUT\n+++ OUT (rendered)\n@@ -0,0 +1,3 @@\n+a\n+bX\n+c\n")
+}
+
+func TestRunDiffUnchanged(t *testing.T) {
+	current := "a\nbX\nc\n"
+	testRunDiff(t, nil, &current, "")
+}
+
+func TestRunDiffSameFileNoBackup(t *testing.T) {
+	in, removeIn := tempfile.Write(t, "foo{{bar}}")
+	defer removeIn()
+	defer os.Remove(in + ".bak")
+
+	stdout := &bytes.Buffer{}
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().Stdout().Return(stdout)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-in", in, "-out", in, "-vars", "bar=baz", "-diff"})
+	assert.Nil(t, err)
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.StringContains(t, stdout.String(), "+foobaz")
+
+	_, err = os.Stat(in + ".bak")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunDiffRequiresOut(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-diff"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--diff requires --out"))
+}
+
+func TestRunBadColor(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-color", "sometimes"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`invalid --color value "sometimes"`))
+}
+
+func TestUseColor(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+	mockOS := tbnos.NewMockOS(ctrl)
+
+	r := &runner{os: mockOS}
+
+	for _, color := range []string{colorAuto, colorNever} {
+		r.color = color
+		assert.False(t, r.useColor(&bytes.Buffer{}))
+	}
+
+	r.color = colorAlways
+	assert.True(t, r.useColor(&bytes.Buffer{}))
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"sync"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+// envValue is a memoized environment variable lookup.
+type envValue struct {
+	value string
+	ok    bool
+}
+
+// cachingOS memoizes environment variable lookups, so that rendering a
+// directory or glob pattern of files performs each lookup only once. This
+// is safe because the environment of the process does not change during a
+// run.
+type cachingOS struct {
+	tbnos.OS
+
+	mu  *sync.Mutex
+	env map[string]envValue
+}
+
+func newCachingOS(base tbnos.OS) cachingOS {
+	return cachingOS{OS: base, mu: &sync.Mutex{}, env: map[string]envValue{}}
+}
+
+func (c cachingOS) LookupEnv(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, cached := c.env[key]
+	if !cached {
+		v.value, v.ok = c.OS.LookupEnv(key)
+		c.env[key] = v
+	}
+	return v.value, v.ok
+}
+
+func (c cachingOS) Getenv(key string) string {
+	value, _ := c.LookupEnv(key)
+	return value
+}
+
+func (c cachingOS) ExpandEnv(s string) string {
+	return os.Expand(s, c.Getenv)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+
+	"github.com/turbinelabs/envtemplate/envtemplate"
+)
+
+func TestCachingOSLookupEnv(t *testing.T) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().LookupEnv("SET").Return("value", true)
+	mockOS.EXPECT().LookupEnv("UNSET").Return("", false)
+
+	c := newCachingOS(mockOS)
+	for i := 0; i < 3; i++ {
+		value, ok := c.LookupEnv("SET")
+		assert.Equal(t, value, "value")
+		assert.True(t, ok)
+
+		value, ok = c.LookupEnv("UNSET")
+		assert.Equal(t, value, "")
+		assert.False(t, ok)
+
+		assert.Equal(t, c.Getenv("SET"), "value")
+		assert.Equal(t, c.ExpandEnv("${SET}-$UNSET-x"), "value--x")
+	}
+}
+
+func TestRunBatchLooksUpEnvOnce(t *testing.T) {
+	in, cleanupIn := mkBatchDir(t, map[string]string{
+		"a.conf": `a={{env "FOO"}} {{envOrDefault "BAR" "x"}}`,
+		"b.conf": `b={{env "FOO"}}`,
+		"c.conf": `c={{envOrDefault "BAR" "$FOO"}} {{env "FOO"}}`,
+	})
+	defer cleanupIn()
+
+	out, cleanupOut := mkBatchDir(t, nil)
+	defer cleanupOut()
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().LookupEnv("FOO").Return("foo", true)
+	mockOS.EXPECT().LookupEnv("BAR").Return("", false)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-in", in, "-out", out})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	assertFileContents(t, filepath.Join(out, "a.conf"), "a=foo x")
+	assertFileContents(t, filepath.Join(out, "b.conf"), "b=foo")
+	assertFileContents(t, filepath.Join(out, "c.conf"), "c=foo foo")
+}
+
+func benchmarkRenderEnv(b *testing.B, os tbnos.OS) {
+	in := ""
+	for i := 0; i < 100; i++ {
+		in += fmt.Sprintf("{{envOrDefault \"ENVTEMPLATE_BENCH_%d\" \"x\"}}\n", i%10)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := envtemplate.Render(strings.NewReader(in), ioutil.Discard, envtemplate.WithOS(os))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderEnv(b *testing.B) {
+	benchmarkRenderEnv(b, tbnos.New())
+}
+
+func BenchmarkRenderEnvCached(b *testing.B) {
+	benchmarkRenderEnv(b, newCachingOS(tbnos.New()))
+}
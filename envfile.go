@@ -0,0 +1,80 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+// envFileOS overlays environment variables loaded by --env-file on the
+// environment of the process, which is not modified.
+type envFileOS struct {
+	tbnos.OS
+
+	pairs []string
+	env   map[string]string
+}
+
+// loadEnvFiles parses each of the named files as KEY=value lines, as for
+// --exec-with-env, and returns an envFileOS overlaying the result on base.
+// Values in later files replace those from earlier files.
+func loadEnvFiles(base tbnos.OS, filenames []string) (envFileOS, error) {
+	e := envFileOS{OS: base, env: map[string]string{}}
+	for _, filename := range filenames {
+		bytes, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return envFileOS{}, err
+		}
+
+		pairs, err := parseDotenv(bytes)
+		if err != nil {
+			return envFileOS{}, fmt.Errorf("could not parse env file %s: %s", filename, err)
+		}
+
+		for _, kv := range pairs {
+			i := strings.Index(kv, "=")
+			e.env[kv[:i]] = kv[i+1:]
+		}
+		e.pairs = append(e.pairs, pairs...)
+	}
+	return e, nil
+}
+
+func (e envFileOS) LookupEnv(key string) (string, bool) {
+	if value, ok := e.env[key]; ok {
+		return value, true
+	}
+	return e.OS.LookupEnv(key)
+}
+
+func (e envFileOS) Getenv(key string) string {
+	value, _ := e.LookupEnv(key)
+	return value
+}
+
+func (e envFileOS) ExpandEnv(s string) string {
+	return os.Expand(s, e.Getenv)
+}
+
+func (e envFileOS) Environ() []string {
+	return mergeEnviron(e.OS.Environ(), e.pairs)
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+func TestLoadEnvFiles(t *testing.T) {
+	first, removeFirst := writeNamedTempFile(t, ".env", "# defaults\nA=1\nB='two'\n")
+	defer removeFirst()
+
+	second, removeSecond := writeNamedTempFile(t, "prod.env", "export B=\"2\\n\"\nC=3\n")
+	defer removeSecond()
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().LookupEnv("D").Return("4", true).Times(2)
+	mockOS.EXPECT().LookupEnv("E").Return("", false)
+	mockOS.EXPECT().Environ().Return([]string{"A=0", "D=4"})
+
+	e, err := loadEnvFiles(mockOS, []string{first, second})
+	assert.Nil(t, err)
+
+	value, ok := e.LookupEnv("A")
+	assert.Equal(t, value, "1")
+	assert.True(t, ok)
+
+	value, ok = e.LookupEnv("B")
+	assert.Equal(t, value, "2\n")
+	assert.True(t, ok)
+
+	value, ok = e.LookupEnv("D")
+	assert.Equal(t, value, "4")
+	assert.True(t, ok)
+
+	_, ok = e.LookupEnv("E")
+	assert.False(t, ok)
+
+	assert.Equal(t, e.ExpandEnv("$A-$C-$D"), "1-3-4")
+	assert.DeepEqual(t, e.Environ(), []string{"A=1", "D=4", "B=2\n", "C=3"})
+}
+
+func TestLoadEnvFilesErrors(t *testing.T) {
+	bad, removeBad := writeNamedTempFile(t, ".env", "A=1\nnot a pair\n")
+	defer removeBad()
+
+	_, err := loadEnvFiles(tbnos.New(), []string{bad})
+	assert.ErrorContains(t, err, "could not parse env file "+bad+": line 2: expected KEY=value")
+
+	_, err = loadEnvFiles(tbnos.New(), []string{bad + ".missing"})
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunEnvFile(t *testing.T) {
+	envFile, removeEnvFile := writeNamedTempFile(t, ".env", "HOST=db\nPORT=5432\n")
+	defer removeEnvFile()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{env "HOST"}}:{{env "PORT"}} {{envOrDefault "USER" "$HOST"}}`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("USER").Return("", false)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-env-file", envFile})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "db:5432 db")
+}
+
+func TestRunBadEnvFile(t *testing.T) {
+	envFile, removeEnvFile := writeNamedTempFile(t, ".env", "1=x\n")
+	defer removeEnvFile()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-env-file", envFile})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(
+		t,
+		got,
+		c.BadInput("could not parse env file "+envFile+": line 1: invalid environment variable name \"1\""),
+	)
+}
@@ -18,29 +18,56 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
+	"github.com/Masterminds/sprig"
 	"github.com/turbinelabs/cli"
 	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/envtemplate/envtemplate"
 	tbnflag "github.com/turbinelabs/nonstdlib/flag"
 	tbnos "github.com/turbinelabs/nonstdlib/os"
 	tbnregexp "github.com/turbinelabs/nonstdlib/regexp"
-	tbnstrings "github.com/turbinelabs/nonstdlib/strings"
 )
 
 const TbnPublicVersion = "0.19.0"
 
+// utf8BOM is the UTF-8 encoding of the byte order mark, U+FEFF.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+const (
+	parseErrorFail = "fail"
+	parseErrorWarn = "warn"
+)
+
+const (
+	modeTemplate = "template"
+	modeEnvsubst = "envsubst"
+)
+
+// checkDriftCode is the exit status used by --check when an output file
+// would change.
+const checkDriftCode command.CmdErrCode = 3
+
 const (
 	description = `
 Process a go-templated file, using environment and command-line variables
 for substitutions.
 
-Three functions are made avaiable to the templates:
+The following functions are made available to the templates:
 
-{{ul "env"}}: used to specify a required environment variable:
+{{ul "env"}}: used to specify a required environment variable. If it is not
+set, the error suggests similarly named variables that are:
     {{print "{{env \"TBN_HOME\""}}"}}
 
 {{ul "envOrDefault"}}: used to specify an optional environment variable,
@@ -51,23 +78,481 @@ with a default value, which can reference other environment variables:
 separated by some character and return a slice of all the substrings
 between separators:
 	{{print "{{envSplit \"TBN_WORKSPACES\" \":\"}}"}}
+
+{{ul "envInt"}}, {{ul "envBool"}}, {{ul "envFloat"}}, {{ul "envDuration"}}: used
+to specify a required environment variable that is parsed as an integer,
+boolean, floating point number, or duration such as "1m30s", failing if it
+is not valid:
+    {{print "{{if gt (envInt \"TBN_WORKERS\") 4}}...{{end}}"}}
+
+{{ul "envOrData"}}: used to specify a value taken from the environment if
+present, and otherwise from the file specified by --data-file. If neither
+has a value, it returns an empty string, or fails with --strict:
+    {{print "{{envOrData \"TBN_HOME\"}}"}}
+
+{{ul "allSet"}}: returns true only if every named environment variable is
+set and non-empty:
+    {{print "{{if allSet \"DB_HOST\" \"DB_USER\"}}...{{end}}"}}
+
+{{ul "envAll"}}: returns a map of every environment variable.
+{{ul "envWithPrefix"}}: returns a map of the environment variables whose names
+start with a prefix, keyed by name with the prefix removed:
+    {{print "{{range $name, $addr := envWithPrefix \"UPSTREAM_\"}}...{{end}}"}}
+
+{{ul "regexQuote"}}: escapes all regular expression metacharacters in a
+value, so that it matches only the literal text:
+    {{print "{{env \"TBN_HOST\" | regexQuote}}"}}
+
+{{ul "regexMatch"}}: returns true if a value contains a match of a regular
+expression, using Go's RE2 syntax. {{ul "regexReplaceAll"}} replaces every
+match with a replacement in which $1 or ${name} refer to submatches:
+    {{print "{{if not (env \"TAG\" | regexMatch \"^v[0-9.]+$\")}}...{{end}}"}}
+    {{print "{{env \"TBN_HOST\" | regexReplaceAll \"[^a-z0-9]+\" \"-\"}}"}}
+
+{{ul "chunk"}}: splits a list into groups of at most n elements:
+    {{print "{{range chunk 2 (envSplit \"TBN_HOSTS\" \",\")}}...{{end}}"}}
+
+{{ul "gitCommit"}}, {{ul "gitBranch"}}: return the commit and branch checked
+out in the git working tree containing the current directory. The repository
+is read directly unless --allow-exec is set, in which case git is invoked:
+    {{print "{{gitBranch}}@{{gitCommit}}"}}
+
+{{ul "countLines"}}, {{ul "countWords"}}, {{ul "countBytes"}}: count the
+lines, words, or bytes of a value. The {{ul "countFileLines"}},
+{{ul "countFileWords"}}, and {{ul "countFileBytes"}} variants count the
+contents of a named file:
+    {{print "Content-Length: {{countBytes .Body}}"}}
+
+{{ul "seqNext"}}: returns the next value of a named counter. Each counter
+starts at the value of --seq-base and increments across the entire template:
+    {{print "{{range .hosts}}id: {{seqNext \"host\"}}{{end}}"}}
+
+{{ul "uuidv4"}}, {{ul "randAlphaNum"}}, {{ul "randBytesB64"}}: return a random
+UUID, a random string of n letters and digits, or n random bytes encoded as
+base64. Values are generated securely unless --seed is set:
+    {{print "node_id: {{uuidv4}}"}}
+    {{print "token: {{randAlphaNum 32}}"}}
+
+{{ul "toolVersion"}}, {{ul "sourceFile"}}: return the version of envtemplate
+and the name of the input file (or "stdin"):
+    {{print "# generated by envtemplate {{toolVersion}} from {{sourceFile}}"}}
+
+{{ul "mustMinLen"}}: returns a list unchanged if it has at least n elements,
+and otherwise fails with the given message:
+    {{print "{{range mustMinLen 3 (envSplit \"SEEDS\" \",\") \"need 3 seeds\"}}...{{end}}"}}
+
+{{ul "setState"}}, {{ul "getState"}}: store and retrieve values in the JSON
+file specified by --state-file, which persists across invocations:
+    {{print "{{setState \"password\" (env \"PASSWORD\")}}"}}
+    {{print "{{getState \"password\"}}"}}
+
+{{ul "pgURL"}}, {{ul "mysqlDSN"}}: build database connection strings from a
+user, password, host, port, and database name, escaping credentials as
+required by each format:
+    {{print "{{pgURL \"app\" (env \"DB_PASS\") \"db\" \"5432\" \"app\"}}"}}
+
+{{ul "goos"}}, {{ul "goarch"}}: return the operating system and architecture
+envtemplate is running on, using Go's names (e.g. "linux" and "amd64"):
+    {{print "{{if eq goos \"darwin\"}}/usr/local/tbn{{else}}/opt/tbn{{end}}"}}
+
+{{ul "hostname"}}, {{ul "fqdn"}}: return the hostname and the fully qualified
+domain name of this machine:
+    {{print "node: {{hostname}}"}}
+
+{{ul "interfaceIP"}}: returns the address of a network interface, preferring
+IPv4. {{ul "privateIP"}} and {{ul "publicIP"}} return the first private
+(RFC 1918 or unique local) or public address of any interface that is up,
+other than loopback. Carrier-grade NAT addresses (100.64.0.0/10) are
+neither, and public addresses provided by NAT are not visible:
+    {{print "address: {{interfaceIP \"eth0\"}}"}}
+
+{{ul "fileAge"}}: returns the number of seconds since a file was modified.
+{{ul "fileOlderThan"}}: returns true if a file was modified longer ago than a
+duration such as "1h". A missing file is not older than any duration, unless
+--strict is set, in which case it is an error:
+    {{print "{{if fileOlderThan \"/var/cache/tbn\" \"24h\"}}refresh: true{{end}}"}}
+
+{{ul "toUpper"}}, {{ul "toLower"}}, {{ul "trim"}}: convert a value to upper
+or lower case, or remove its leading and trailing whitespace. {{ul "upper"}}
+and {{ul "lower"}} are synonyms for toUpper and toLower:
+    {{print "{{env \"TBN_HOST\" | trim | toLower}}"}}
+
+{{ul "title"}}: converts the first letter of each space-separated word to upper
+case:
+    {{print "# {{env \"TBN_SERVICE\" | title}} configuration"}}
+
+{{ul "snakecase"}}, {{ul "camelcase"}}, {{ul "kebabcase"}}: split a value into
+words at punctuation, spaces, and changes of case, and join them as
+"db_host", "dbHost", or "db-host" respectively:
+    {{print "{{range $k, $v := envWithPrefix \"APP_\"}}{{camelcase $k}}: {{$v}}{{end}}"}}
+
+{{ul "replace"}}: replaces every occurrence of one string with another:
+    {{print "{{env \"TBN_HOST\" | replace \".\" \"-\"}}"}}
+
+{{ul "trimPrefix"}}, {{ul "trimSuffix"}}: remove a leading or trailing string
+from a value, if present:
+    {{print "{{env \"TBN_URL\" | trimPrefix \"https://\" | trimSuffix \"/\"}}"}}
+
+{{ul "split"}}: slices a value into a list of the substrings between
+separators. An empty value produces an empty list. {{ul "join"}} concatenates
+the elements of a list with a separator:
+    {{print "{{env \"TBN_HOSTS\" | split \",\" | join \" \"}}"}}
+
+{{ul "contains"}}, {{ul "hasPrefix"}}, {{ul "hasSuffix"}}: return true if a
+value contains, begins with, or ends with a string:
+    {{print "{{if env \"TBN_URL\" | hasPrefix \"https://\"}}tls: true{{end}}"}}
+
+{{ul "default"}}: returns a default value if the given value is empty,
+including an environment variable that is set but empty, or a missing, empty,
+or null value in the data. Empty lists and objects are also empty, while zero
+and false are not:
+    {{print "{{envOrDefault \"TBN_REGION\" \"\" | default \"us-east-1\"}}"}}
+
+{{ul "coalesce"}}: returns the first of its arguments that is not empty, as
+for default:
+    {{print "{{coalesce .region (envOrDefault \"TBN_REGION\" \"\") \"us-east-1\"}}"}}
+
+{{ul "required"}}: returns a value unchanged, failing with the given message if
+it is empty:
+    {{print "{{envOrDefault \"DB_HOST\" \"\" | required \"DB_HOST must be set\"}}"}}
+
+{{ul "procEnv"}}: returns a variable from the environment of the process with
+the given PID, as read from /proc/PID/environ. Requires --allow-proc, and is
+only available on Linux:
+    {{print "{{procEnv \"1\" \"TBN_HOME\"}}"}}
+
+{{ul "baseEncode"}}, {{ul "baseDecode"}}: convert an integer to and from its
+representation in a base between 2 and 62, e.g. to build short identifiers:
+    {{print "id: {{baseEncode (seqNext \"host\") 36}}"}}
+
+{{ul "expandHome"}}: replaces a leading "~" in a path with the value of $HOME.
+Functions that read or inspect files expand their filename arguments the
+same way:
+    {{print "{{expandHome (env \"TBN_CONFIG\")}}"}}
+
+{{ul "include"}}: renders another template file with the same functions and,
+unless given explicitly, the same data, and returns the result. Relative
+paths are resolved against the directory of the including file, or the
+working directory when reading from STDIN:
+    {{print "{{include \"common/header.tmpl\"}}"}}
+
+{{ul "yamlValue"}}: returns a value as a YAML scalar, quoting it only when it
+would otherwise be read as a number, boolean, or null, or is not valid as a
+plain scalar:
+    {{print "password: {{env \"DB_PASS\" | yamlValue}}"}}
+
+{{ul "durationBetween"}}: parses two timestamps using a Go time layout and
+returns the duration between them:
+    {{print "{{durationBetween \"2006-01-02\" (env \"ISSUED\") (env \"EXPIRES\")}}"}}
+
+{{ul "now"}}: returns the current time. {{ul "date"}} formats a time using a Go
+time layout, {{ul "unixEpoch"}} returns a time as seconds since the Unix
+epoch, and {{ul "dateModify"}} adds a duration such as "720h" or "-30m" to a
+time:
+    {{print "# generated {{now | date \"2006-01-02T15:04:05Z07:00\"}}"}}
+    {{print "expires: {{now | dateModify \"720h\" | unixEpoch}}"}}
+
+{{ul "fence"}}: wraps a value in a Markdown fenced code block with the given
+language, using a fence longer than any run of backticks in the value:
+    {{print "{{env \"TBN_CONFIG\" | fence \"yaml\"}}"}}
+
+{{ul "switch"}}: looks up a key in a list of alternating keys and values,
+returning the matching value or, if none matches, the final default value:
+    {{print "replicas: {{switch (env \"STAGE\") \"dev\" \"1\" \"prod\" \"3\" \"2\"}}"}}
+
+{{ul "mapToYAML"}}: renders a map as YAML "key: value" lines, sorted by key and
+indented by the given number of spaces, with strings quoted as by yamlValue:
+    {{print "{{mapToYAML .env 2}}"}}
+
+{{ul "pow"}}, {{ul "log2"}}, {{ul "log10"}}: compute powers and logarithms,
+failing if the result is not a finite real number:
+    {{print "buffer_size: {{pow 2 20}}"}}
+
+{{ul "yamlBlock"}}: returns a multiline value as a YAML literal block scalar,
+indenting each line by the given number of spaces and preserving trailing
+newlines:
+    {{print "cert: {{env \"TLS_CERT\" | yamlBlock 2}}"}}
+
+{{ul "lookup"}}: returns the value at a dot-separated path in the file
+specified by --data-file. List elements are selected by index. The
+{{ul "yamlGet"}} variant looks up a path in a YAML document. YAML aliases are
+resolved to the values of their anchors:
+    {{print "{{lookup \"db.hosts.0\"}} {{env \"TBN_CONFIG\" | yamlGet \"db.port\"}}"}}
+
+{{ul "goString"}}: returns a value as a double-quoted Go string literal. The
+{{ul "cString"}} variant returns a double-quoted C string literal, using octal
+escapes for control and non-ASCII bytes:
+    {{print "const Message = {{env \"MSG\" | goString}}"}}
+
+{{ul "quote"}}: returns a value as a double-quoted JSON string, which is also
+valid in YAML. {{ul "squote"}} returns a value in single quotes, doubling any
+single quotes within it as YAML and SQL require:
+    {{print "password: {{env \"DB_PASS\" | quote}}"}}
+
+{{ul "shellQuote"}}: returns a value quoted as a single word for a POSIX shell,
+so that it is never expanded or split:
+    {{print "exec app --name {{env \"TBN_NAME\" | shellQuote}}"}}
+
+{{ul "inCanary"}}: returns true for a stable subset of roughly the given
+percentage of keys, selected by a hash of the key:
+    {{print "{{if inCanary (env \"HOSTNAME\") 10}}new_feature: true{{end}}"}}
+
+{{ul "queryGet"}}: returns the first value of a parameter in a URL query
+string, or the empty string if it is not present. The {{ul "queryKeys"}}
+variant returns the sorted parameter names:
+    {{print "timeout: {{queryGet (env \"DB_OPTS\") \"timeout\"}}"}}
+
+{{ul "urlEncode"}}, {{ul "urlDecode"}}: encode and decode a value for use in a
+URL query string, in which a space is encoded as "+".
+{{ul "urlParse"}}: splits a URL into its scheme, user, password, host, port,
+path, query, and fragment, with the user, password, and path decoded:
+    {{print "{{$db := urlParse (env \"DATABASE_URL\")}}host: {{$db.host}}"}}
+
+{{ul "joinWrap"}}: joins a list with a separator and wraps the result in a
+prefix and suffix. An empty list produces an empty string:
+    {{print "hosts: {{envSplit \"HOSTS\" \",\" | joinWrap \"[\" \", \" \"]\"}}"}}
+
+{{ul "naturalSort"}}: returns a sorted copy of a list, comparing runs of
+digits numerically so that "item2" sorts before "item10":
+    {{print "{{range envSplit \"NODES\" \",\" | naturalSort}}{{.}} {{end}}"}}
+
+{{ul "vault"}}: returns the value of a key in a Vault secret. The server and
+token are read from $VAULT_ADDR and $VAULT_TOKEN, or ~/.vault-token, and
+$VAULT_NAMESPACE selects an optional namespace:
+    {{print "password: {{vault \"secret/data/db\" \"password\"}}"}}
+
+{{ul "toJSON"}}: encodes a value as compact JSON, without HTML escaping:
+    {{print "config = {{toJSON .}}"}}
+
+{{ul "fromJSON"}}: decodes a JSON string into a value usable with index and
+range:
+    {{print "{{(fromJSON (env \"SERVICE\")).host}}"}}
+
+{{ul "toYAML"}}: encodes a value, such as a list or object from the data file,
+as a block YAML document without a trailing newline. {{ul "fromYAML"}} decodes
+a YAML string into a value usable with index and range:
+    {{print "listeners:{{toYAML .listeners | nindent 2}}"}}
+
+{{ul "indent"}}: prefixes each non-empty line of a value with a number of
+spaces. The {{ul "nindent"}} variant also adds a leading newline, so that a
+multi-line value such as a certificate can follow a YAML key:
+    {{print "tls.crt: |{{file \"/etc/tls/tls.crt\" | nindent 4}}"}}
+
+{{ul "b64enc"}}, {{ul "b64dec"}}: encode and decode standard base64, as used in
+Kubernetes Secrets and basic auth headers. {{ul "b64urlenc"}} and
+{{ul "b64urldec"}} use the URL-safe alphabet. Padding is optional when
+decoding:
+    {{print "password: {{env \"DB_PASS\" | b64enc}}"}}
+
+{{ul "sha256sum"}}, {{ul "sha1sum"}}, {{ul "md5sum"}}: return the hexadecimal
+digest of a value, e.g. to annotate a Kubernetes Deployment with the hash of
+its configuration so that pods restart when it changes:
+    {{print "checksum/config: {{include \"configmap.tmpl\" | sha256sum}}"}}
+
+{{ul "ssm"}}: returns the value of an AWS SSM Parameter Store parameter. If
+the optional second argument is true, SecureString parameters are decrypted.
+The region is found as it is by the AWS CLI. Credentials are read from
+$AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY; from the web identity token
+named by $AWS_WEB_IDENTITY_TOKEN_FILE for the role $AWS_ROLE_ARN, as with IAM
+roles for service accounts on EKS; from the keys or web identity settings of
+the $AWS_PROFILE profile in ~/.aws/credentials or ~/.aws/config; from the ECS
+container credentials endpoint; or from the EC2 instance metadata service.
+Profiles that assume a role using another profile, or that use
+credential_process or SSO, are not supported and fail:
+    {{print "password: {{ssm \"/prod/db/password\" true}}"}}
+
+{{ul "ssmOrDefault"}}: like ssm, but returns a default value if the
+parameter does not exist:
+    {{print "pool: {{ssmOrDefault \"/prod/db/pool\" \"10\"}}"}}
+
+{{ul "awsSecret"}}: returns the value of an AWS Secrets Manager secret or, if
+a key is given, the value of that key in the secret's JSON object. The
+region may be given with --aws-region:
+    {{print "password: {{awsSecret \"prod/db\" \"password\"}}"}}
+
+{{ul "gcpSecret"}}: returns the payload of a GCP Secret Manager secret
+version, using Application Default Credentials. If no version is given, the
+latest version is used:
+    {{print "password: {{gcpSecret \"projects/x/secrets/db/versions/latest\"}}"}}
+
+{{ul "azureSecret"}}: returns the value of a secret in an Azure Key Vault,
+authenticating as the service principal or workload identity given by the
+$AZURE_* environment variables, or as the host's managed identity:
+    {{print "password: {{azureSecret \"prod-vault\" \"db-password\"}}"}}
+
+{{ul "consulKey"}}: returns the value of a key in the Consul KV store. The
+agent is given by --consul-addr and --consul-token:
+    {{print "max_conns: {{consulKey \"service/web/max_conns\"}}"}}
+
+{{ul "consulTree"}}: returns a map of the keys and values in a folder of the
+Consul KV store, with the folder's path removed from the keys:
+    {{print "{{range $k, $v := consulTree \"service/web/env\"}}{{$k}}={{$v}} {{end}}"}}
+
+{{ul "etcdGet"}}: returns the value of a key in etcd. The cluster is given by
+--etcd-endpoints, with TLS and authentication given by the other --etcd-*
+flags:
+    {{print "max_conns: {{etcdGet \"/service/web/max_conns\"}}"}}
+
+{{ul "etcdPrefix"}}: returns a map of the keys and values in etcd that start
+with a prefix, with the prefix removed from the keys:
+    {{print "{{range $k, $v := etcdPrefix \"/service/web/env/\"}}{{$k}}={{$v}} {{end}}"}}
+
+{{ul "k8sSecret"}}: returns the decoded value of a key in a Kubernetes
+Secret, given its namespace and name. The API server is found using
+$KUBECONFIG, the pod's service account, or ~/.kube/config:
+    {{print "password: {{k8sSecret \"prod\" \"db\" \"password\"}}"}}
+
+{{ul "k8sConfigMap"}}: returns the value of a key in a Kubernetes ConfigMap,
+given its namespace and name:
+    {{print "log_level: {{k8sConfigMap \"prod\" \"web\" \"log_level\"}}"}}
+
+{{ul "file"}}: returns the contents of a file, such as a Docker secret.
+Relative paths are resolved as for include. Requires --allow-file-read:
+    {{print "password: {{file \"/run/secrets/db_password\" | trim}}"}}
+
+{{ul "envOrFile"}}: returns the value of an environment variable if it is
+set, and otherwise the contents of a file, as for file:
+    {{print "password: {{envOrFile \"DB_PASSWORD\" \"/run/secrets/db_password\"}}"}}
 	
-Additional variable substitutions can be specified using the --var flag.
+Additional variable substitutions can be specified using the --vars flag, or
+loaded from a JSON or YAML file with the --vars-file flag. A var given with
+--vars takes precedence over one of the same name in the vars file, while a
+var may be given at most once with --vars. Vars may not share a name with a
+template function.
+
+A JSON or YAML file may be specified with the --data-file flag. Its contents
+are made available to the template as the data object, so that values can be
+referenced as {{print "{{.key}}"}}. If the flag is repeated, the files are merged
+in order: objects are merged recursively, and any other value in a later
+file, including a list, replaces the value from an earlier file.
+
+With --context, vars are instead merged over the data object rather than
+being made available as functions, so that they are referenced as
+{{print "{{.name}}"}}. Values from the vars file keep their structure, so
+that lists and objects may be used with range and index:
+    {{print "{{range .hosts}}server {{.}}{{end}}"}}
+
+Text outside of template actions is copied to the output byte for byte,
+including carriage returns and any UTF-8 byte order mark at the start of the
+input. Use --strip-bom to remove the byte order mark. Note that the
+{{print "{{-"}} and {{print "-}}"}} trim markers remove all adjacent whitespace,
+including carriage returns.
+
+If --in names a directory or is a glob pattern, every matching file is
+rendered into the --out directory under the same relative name, less any
+suffix given with --strip-suffix. Alternatively, --in-dir and --out-dir
+render only the files ending in .tmpl, or in --strip-suffix if given, and
+remove the suffix from the output filenames:
+    {{print "envtemplate --in-dir config --out-dir /etc/app"}}
+
+Each environment variable is looked up once and the result reused for every
+file, since the environment cannot change during a run.
+
+With --mode=envsubst, the input is not a go template. Instead, references
+to environment variables are replaced as by GNU envsubst: {{print "$VAR"}} and
+{{print "${VAR}"}} are replaced with the value of VAR, or nothing if it is unset,
+and {{print "${VAR:-default}"}} is replaced with default if VAR is unset or
+empty. It may not be combined with --lint or --strict.
+
+If the options are followed by exec and a command, the command is run
+after the templates are rendered, and envtemplate exits with the command's
+exit status. This allows envtemplate to serve as the entrypoint of a
+container:
+    {{print "envtemplate --in app.conf.tmpl --out app.conf exec -- app serve"}}
+
+Where the platform allows it, the command replaces envtemplate, keeping its
+process ID, and receives signals sent to it directly. Otherwise the command
+is run as a child process, and SIGHUP, SIGINT, SIGQUIT, and SIGTERM are
+relayed to it. If the command exits with a non-zero status, envtemplate
+exits with the same status, or with 128+n if the command is killed by
+signal n, and prints nothing. Errors of envtemplate itself, including
+failing to start the command, are reported with a message.
+
+With --exec-with-env and --allow-exec, the output is not written. Instead it
+is parsed as KEY=value lines, which are added to the environment of the
+command given after --. Blank lines and lines starting with # are ignored,
+and values may be quoted. The command is run, and its exit status
+reported, as for exec:
+    {{print "envtemplate --in app.env.tmpl --allow-exec --exec-with-env -- app serve"}}
 `
 
+	includePatternDesc = `
+Glob patterns selecting the files rendered as templates when --in is a
+directory or glob pattern. Other files are copied verbatim. Patterns are
+matched against paths relative to --in, or against the file name alone if
+the pattern contains no slash. Multiple values may be comma-separated or the
+flag may be repeated. If none are given, every file is rendered.`
+
+	excludePatternDesc = `
+Glob patterns, as for --include-pattern, selecting files that are copied
+verbatim rather than rendered, even if they match an include pattern.`
+
+	dataFileDesc = `
+A JSON or YAML ` + "`filename`" + ` whose contents are used as the template
+data. The format is determined by the file extension. Multiple values may be
+comma-separated or the flag may be repeated, in which case later files are
+deep-merged over earlier ones.`
+
+	envFileDesc = `
+A ` + "`filename`" + ` containing environment variables as KEY=value lines.
+Blank lines and lines starting with # are ignored, and values may be quoted.
+The variables are visible to the template functions that read the
+environment, and take precedence over the environment of the process, which
+is not modified. Multiple values may be comma-separated or the flag may be
+repeated, in which case values from later files take precedence.`
+
 	varsDesc = `
 Additional vars referenced by the template file. Values are in the format
 ` + "`name=value`" + `. Multiple values may be comma-separated or the flag may
-be repeated.`
+be repeated. Values take precedence over those from --vars-file.`
+
+	varsFileDesc = `
+A JSON or YAML ` + "`filename`" + ` containing an object of additional vars
+referenced by the template file. The format is determined by the file
+extension. Values given with --vars take precedence. Files encrypted with
+SOPS are decrypted by running sops with its configured KMS, age, or PGP
+keys, which requires --allow-exec. If sops fails, envtemplate exits with its
+exit status.`
 )
 
 func cmd() *command.Cmd {
-	r := &runner{os: tbnos.New(), vars: tbnflag.NewStrings()}
+	r := &runner{
+		os:                   tbnos.New(),
+		vars:                 tbnflag.NewStrings(),
+		dataFiles:            tbnflag.NewStrings(),
+		envFiles:             tbnflag.NewStrings(),
+		includePatterns:      tbnflag.NewStrings(),
+		excludePatterns:      tbnflag.NewStrings(),
+		deprecated:           deprecatedFuncs,
+		execProcess:          execProcess,
+		goos:                 runtime.GOOS,
+		goarch:               runtime.GOARCH,
+		now:                  time.Now,
+		hostname:             os.Hostname,
+		lookupHost:           net.LookupHost,
+		lookupAddr:           net.LookupAddr,
+		netInterfaces:        systemInterfaces,
+		httpClient:           &http.Client{Timeout: httpTimeout},
+		vaultSecrets:         map[string]map[string]interface{}{},
+		ssmParams:            map[ssmKey]string{},
+		awsSecrets:           map[string]string{},
+		gcpSecrets:           map[string]string{},
+		gcpSecretManagerURL:  defaultGCPSecretManagerURL,
+		azureSecrets:         map[string]string{},
+		consulKeys:           map[string]string{},
+		consulTrees:          map[string]map[string]string{},
+		etcdKeys:             map[string]string{},
+		etcdPrefixes:         map[string]map[string]string{},
+		etcdTokens:           map[string]string{},
+		k8sServiceAccountDir: defaultK8sServiceAccountDir,
+		k8sObjects:           map[string][]byte{},
+		procRoot:             defaultProcRoot,
+	}
 
 	cmd := &command.Cmd{
 		Name:        "envtemplate",
 		Summary:     "Process a go-templated config file",
-		Usage:       "[OPTIONS] <filename>",
+		Usage:       "[OPTIONS] [exec [--] <command> [<arg>...]]",
 		Description: description,
 		Runner:      r,
 	}
@@ -76,7 +561,13 @@ func cmd() *command.Cmd {
 		&r.in,
 		"in",
 		"",
-		"The input `filename`. If empty, input will be read from STDIN",
+		"The input `filename`. If empty, input will be read from STDIN. If a directory or glob pattern, each matching file is rendered into the --out directory.",
+	)
+	cmd.Flags.IntVar(
+		&r.inFD,
+		"in-fd",
+		-1,
+		"A file `descriptor`, inherited from the parent process, from which input is read instead of STDIN. May not be combined with --in.",
 	)
 	cmd.Flags.StringVar(
 		&r.out,
@@ -84,132 +575,1241 @@ func cmd() *command.Cmd {
 		"",
 		"The output `filename`. If empty, output will be go to STDOUT",
 	)
+	cmd.Flags.StringVar(
+		&r.inDir,
+		"in-dir",
+		"",
+		"An input `directory`, walked recursively. Each file ending in --strip-suffix, \".tmpl\" by default, is rendered into --out-dir with the suffix removed. Other files are ignored.",
+	)
+	cmd.Flags.StringVar(
+		&r.outDir,
+		"out-dir",
+		"",
+		"The output `directory` for --in-dir.",
+	)
+	cmd.Flags.StringVar(
+		&r.stripSuffix,
+		"strip-suffix",
+		"",
+		"A `suffix`, such as \".tmpl\", removed from output filenames when --in is a directory or glob pattern.",
+	)
+	cmd.Flags.BoolVar(
+		&r.onlyChanged,
+		"only-changed",
+		false,
+		"if true, output files whose contents would not change are not rewritten, preserving their modification times. In batch mode, the number of files skipped is reported.",
+	)
+	cmd.Flags.BoolVar(
+		&r.skipEmpty,
+		"skip-empty",
+		false,
+		"if true, output files whose rendered contents are empty or contain only whitespace are not written, and any existing output file is removed.",
+	)
+	cmd.Flags.Var(&r.includePatterns, "include-pattern", includePatternDesc)
+	cmd.Flags.Var(&r.excludePatterns, "exclude-pattern", excludePatternDesc)
+	cmd.Flags.BoolVar(
+		&r.keepGoing,
+		"keep-going",
+		false,
+		"if true, when --in is a directory or glob pattern, continue rendering the remaining files after a file fails.",
+	)
 	cmd.Flags.BoolVar(
 		&r.nobackup,
 		"no-backup",
 		false,
 		"if true, in the special case where --in and --out are the same file, don't keep a backup of the input file.",
 	)
+	cmd.Flags.BoolVar(
+		&r.diff,
+		"diff",
+		false,
+		fmt.Sprintf(
+			"if true, print a unified diff between the current contents of --out and the rendered template to STDOUT, rather than writing --out. Files differing by more than %d inserted or deleted lines are only reported to differ.",
+			maxDiffEdits,
+		),
+	)
+	cmd.Flags.BoolVar(
+		&r.check,
+		"check",
+		false,
+		"if true, render the template without writing --out, exiting with status 3 if the contents of --out would change. May be combined with --diff to show the changes.",
+	)
+	cmd.Flags.StringVar(
+		&r.color,
+		"color",
+		colorAuto,
+		"Whether to colorize --diff output: `always`, never, or auto. In auto mode, output is colorized when STDOUT is a terminal and $NO_COLOR is not set.",
+	)
+	cmd.Flags.StringVar(
+		&r.delims,
+		"delims",
+		"",
+		"The left and right template action `delimiters`, separated by a comma, e.g. \"[[,]]\". If empty, the standard delimiters are used.",
+	)
+	cmd.Flags.StringVar(
+		&r.leftDelim,
+		"left-delim",
+		"",
+		"The left template action `delimiter`, e.g. \"[[\". If empty, \"{{\" is used. May not be combined with --delims.",
+	)
+	cmd.Flags.StringVar(
+		&r.rightDelim,
+		"right-delim",
+		"",
+		"The right template action `delimiter`, e.g. \"]]\". If empty, \"}}\" is used. May not be combined with --delims.",
+	)
+	cmd.Flags.BoolVar(
+		&r.lint,
+		"lint",
+		false,
+		"if true, the template is not rendered. Instead, every function and variable it references is listed on STDOUT, and any that are undefined are reported together.",
+	)
+	cmd.Flags.BoolVar(
+		&r.stripBOM,
+		"strip-bom",
+		false,
+		"if true, a UTF-8 byte order mark at the start of the input is removed before rendering.",
+	)
+	cmd.Flags.BoolVar(
+		&r.strictDelims,
+		"strict-delims",
+		false,
+		"if true, check that template delimiters are balanced before parsing, reporting the line of the first unmatched delimiter",
+	)
+	cmd.Flags.BoolVar(
+		&r.strict,
+		"strict",
+		false,
+		"if true, fail before rendering if the template references any undefined functions or variables, listing all of them, and fail when rendering if the template references a key missing from the data. Also causes fileOlderThan to fail for missing files, and envOrData to fail for missing values.",
+	)
+	cmd.Flags.BoolVar(
+		&r.respectUmask,
+		"respect-umask",
+		false,
+		"if true, output files are written with mode 0666 masked by the process umask, rather than 0644.",
+	)
+	cmd.Flags.BoolVar(
+		&r.allowFileRead,
+		"allow-file-read",
+		false,
+		"if true, the file and envOrFile template functions are enabled. Like include and the other functions that take a path, they may read any file the process can.",
+	)
+	cmd.Flags.BoolVar(
+		&r.allowExec,
+		"allow-exec",
+		false,
+		"if true, template functions may execute external commands, and vars files encrypted with SOPS are decrypted by running sops.",
+	)
+	cmd.Flags.BoolVar(
+		&r.execWithEnv,
+		"exec-with-env",
+		false,
+		"if true, the output is parsed as KEY=value lines and added to the environment of the command given after --, which is then run. Requires --allow-exec.",
+	)
+	cmd.Flags.BoolVar(
+		&r.allowProc,
+		"allow-proc",
+		false,
+		"if true, template functions may read the environment of other processes. Linux only.",
+	)
+	cmd.Flags.BoolVar(
+		&r.deprecationWarnings,
+		"deprecation-warnings",
+		true,
+		"if true, a warning is printed to STDERR when a template uses a deprecated function.",
+	)
+	cmd.Flags.BoolVar(
+		&r.sprig,
+		"sprig",
+		false,
+		"if true, the functions of the Sprig template library are available to templates. Sprig functions replace envtemplate functions of the same name, except env, so that they behave as Sprig documents. Among others, Sprig's regexReplaceAll takes the replacement last, camelcase capitalizes the first word, default treats 0 and false as empty, split returns a map, and the random functions ignore --seed.",
+	)
 	cmd.Flags.Var(&r.vars, "vars", varsDesc)
+	cmd.Flags.StringVar(&r.varsFile, "vars-file", "", varsFileDesc)
+	cmd.Flags.BoolVar(
+		&r.context,
+		"context",
+		false,
+		"if true, vars given with --vars and --vars-file are merged over the template data rather than made available as functions, e.g. {{.foo}}. Values from --vars-file may be lists or objects.",
+	)
+	cmd.Flags.StringVar(
+		&r.varsPrefix,
+		"vars-prefix",
+		"",
+		"If set, vars given with --vars are also made available in the template data as a map with this `name`, e.g. {{.CLI.foo}} for a prefix of CLI.",
+	)
+	cmd.Flags.DurationVar(
+		&r.maxRenderTime,
+		"max-render-time",
+		0,
+		"The maximum `duration` allowed for rendering each template. If zero, rendering time is unlimited.",
+	)
+	cmd.Flags.Int64Var(
+		&r.maxOutputSize,
+		"max-output-size",
+		0,
+		"The maximum size, in `bytes`, of rendered output. If zero, output size is unlimited.",
+	)
+	cmd.Flags.StringVar(
+		&r.mode,
+		"mode",
+		modeTemplate,
+		"The input `syntax`: template, for go templates, or envsubst, for $VAR and ${VAR} references to environment variables, as for GNU envsubst.",
+	)
+	cmd.Flags.StringVar(
+		&r.onParseError,
+		"on-parse-error",
+		parseErrorFail,
+		"The `action` taken when the template cannot be parsed: fail, or warn. With warn, a warning is printed to STDERR and the input is written to the output unchanged.",
+	)
+	cmd.Flags.IntVar(
+		&r.errorContext,
+		"error-context",
+		0,
+		"If positive, the `number` of template lines surrounding the location of a parse or execution error to print to STDERR.",
+	)
+	cmd.Flags.IntVar(
+		&r.seqBase,
+		"seq-base",
+		0,
+		"The initial `value` of counters returned by seqNext.",
+	)
+	cmd.Flags.Int64Var(
+		&r.seed,
+		"seed",
+		0,
+		"If non-zero, uuidv4, randAlphaNum, and randBytesB64 use a generator seeded with this `value`, so that output is reproducible, e.g. in tests. Seeded values are predictable and must not be used as secrets.",
+	)
+	cmd.Flags.StringVar(
+		&r.cpuProfile,
+		"cpuprofile",
+		"",
+		"If set, a CPU profile of the run is written to this `filename`, in the format read by go tool pprof.",
+	)
+	cmd.Flags.StringVar(
+		&r.memProfile,
+		"memprofile",
+		"",
+		"If set, a heap profile taken at the end of the run is written to this `filename`, in the format read by go tool pprof.",
+	)
+	cmd.Flags.StringVar(
+		&r.dumpResolved,
+		"dump-resolved",
+		"",
+		"If set, the environment variables and template variables used by the template, and their values, are written as JSON to this `filename` after rendering.",
+	)
+	cmd.Flags.BoolVar(
+		&r.redact,
+		"redact",
+		false,
+		"if true, values are omitted from the --dump-resolved file, leaving only names.",
+	)
+	cmd.Flags.StringVar(
+		&r.stateFile,
+		"state-file",
+		"",
+		"A JSON `filename` used by setState and getState to persist values across invocations. It is created if it does not exist.",
+	)
+	cmd.Flags.StringVar(
+		&r.awsRegion,
+		"aws-region",
+		"",
+		"The AWS `region` used by the ssm and awsSecret functions. If empty, the region is given by $AWS_REGION, $AWS_DEFAULT_REGION, or the AWS config file.",
+	)
+	cmd.Flags.StringVar(
+		&r.consulAddr,
+		"consul-addr",
+		"",
+		"The `address` of the Consul agent used by consulKey and consulTree. If empty, $CONSUL_HTTP_ADDR or "+defaultConsulAddr+" is used.",
+	)
+	cmd.Flags.StringVar(
+		&r.consulToken,
+		"consul-token",
+		"",
+		"The ACL `token` used by consulKey and consulTree. If empty, $CONSUL_HTTP_TOKEN is used.",
+	)
+	cmd.Flags.StringVar(
+		&r.etcdEndpoints,
+		"etcd-endpoints",
+		"",
+		"A comma-separated list of etcd `endpoints` used by etcdGet and etcdPrefix. If empty, $ETCDCTL_ENDPOINTS or "+defaultEtcdEndpoint+" is used.",
+	)
+	cmd.Flags.StringVar(
+		&r.etcdUser,
+		"etcd-user",
+		"",
+		"The etcd `username:password` used by etcdGet and etcdPrefix. If empty, $ETCDCTL_USER is used, if set.",
+	)
+	cmd.Flags.StringVar(
+		&r.etcdCACert,
+		"etcd-cacert",
+		"",
+		"A `filename` of PEM-encoded CA certificates used to verify etcd servers. If empty, $ETCDCTL_CACERT is used, if set.",
+	)
+	cmd.Flags.StringVar(
+		&r.etcdCert,
+		"etcd-cert",
+		"",
+		"A `filename` of a PEM-encoded client certificate presented to etcd servers. If empty, $ETCDCTL_CERT is used, if set.",
+	)
+	cmd.Flags.StringVar(
+		&r.etcdKey,
+		"etcd-key",
+		"",
+		"A `filename` of the PEM-encoded key of --etcd-cert. If empty, $ETCDCTL_KEY is used, if set.",
+	)
+	cmd.Flags.Var(&r.dataFiles, "data-file", dataFileDesc)
+	cmd.Flags.Var(&r.envFiles, "env-file", envFileDesc)
 
 	return cmd
 }
 
 type runner struct {
-	os       tbnos.OS
-	in       string
-	out      string
-	nobackup bool
-	vars     tbnflag.Strings
+	os            tbnos.OS
+	in            string
+	inFD          int
+	source        string
+	inMode        os.FileMode
+	stripSuffix   string
+	inDir         string
+	outDir        string
+	templatesOnly bool
+	keepGoing     bool
+
+	includePatterns tbnflag.Strings
+	excludePatterns tbnflag.Strings
+	onlyChanged     bool
+	skipped         int
+	skipEmpty       bool
+	out             string
+	nobackup        bool
+	diff            bool
+	check           bool
+	drifted         []string
+	color           string
+	delims          string
+	leftDelim       string
+	rightDelim      string
+	lint            bool
+	stripBOM        bool
+	strictDelims    bool
+	strict          bool
+	respectUmask    bool
+	allowExec       bool
+	allowFileRead   bool
+	execWithEnv     bool
+	child           *childCommand
+	rendered        *bytes.Buffer
+	allowProc       bool
+	sprig           bool
+	procRoot        string
+	vars            tbnflag.Strings
+	varsFile        string
+	varsPrefix      string
+	context         bool
+	dataFiles       tbnflag.Strings
+	envFiles        tbnflag.Strings
+	data            map[string]interface{}
+
+	dumpResolved string
+	redact       bool
+	resolved     *resolvedSet
+	stateFile    string
+	state        map[string]string
+	stateChanged bool
+
+	maxRenderTime time.Duration
+	maxOutputSize int64
+	errorContext  int
+	onParseError  string
+	mode          string
+	seqBase       int
+	seed          int64
+
+	// the source used by the random functions, created on first use
+	rand io.Reader
+
+	// per-render state
+	seqs         map[string]int
+	renderFuncs  template.FuncMap
+	renderData   interface{}
+	renderSource string
+	includes     []string
+
+	// serializes the template functions of renders guarded for
+	// --max-render-time, and the guard of the render that last called one
+	funcMu    sync.Mutex
+	funcGuard *renderGuard
+
+	deprecated          map[string]string
+	deprecationWarnings bool
+
+	// replaces envtemplate with the child command, if supported
+	execProcess func(argv0 string, argv []string, envv []string) error
+
+	// the platform reported by goos and goarch
+	goos   string
+	goarch string
+
+	now func() time.Time
+
+	// the identity of this machine, as found by hostname, fqdn, and the
+	// functions returning IP addresses
+	hostname      func() (string, error)
+	lookupHost    func(string) ([]string, error)
+	lookupAddr    func(string) ([]string, error)
+	netInterfaces func() ([]netInterface, error)
+
+	// clients for remote services
+	httpClient           *http.Client
+	vaultSecrets         map[string]map[string]interface{}
+	awsCreds             *awsCredentials
+	ssmParams            map[ssmKey]string
+	awsSecrets           map[string]string
+	awsRegion            string
+	gcpToken             string
+	gcpSecrets           map[string]string
+	gcpSecretManagerURL  string
+	azureToken           string
+	azureSecrets         map[string]string
+	consulAddr           string
+	consulToken          string
+	consulKeys           map[string]string
+	consulTrees          map[string]map[string]string
+	etcdEndpoints        string
+	etcdUser             string
+	etcdCACert           string
+	etcdCert             string
+	etcdKey              string
+	etcdClient           *http.Client
+	etcdTokens           map[string]string
+	etcdKeys             map[string]string
+	etcdPrefixes         map[string]map[string]string
+	k8s                  *k8sClient
+	k8sServiceAccountDir string
+	k8sObjects           map[string][]byte
+
+	cpuProfile string
+	memProfile string
 }
 
 func (r *runner) Run(cmd *command.Cmd, args []string) command.CmdErr {
-	funcs, err := r.mkFuncMap()
+	stopProfiling, err := r.startProfiling()
 	if err != nil {
+		return cmd.Error(err)
+	}
+
+	cmdErr := r.run(cmd, args)
+	if err := stopProfiling(); err != nil && cmdErr.Code == command.CmdErrCodeNoError {
+		return cmd.Error(err)
+	}
+	if cmdErr.Code != command.CmdErrCodeNoError || r.child == nil {
+		return cmdErr
+	}
+
+	if err := r.runCommand(); err != nil {
+		if exitErr, ok := err.(exitStatusError); ok {
+			// does not return, except in tests
+			r.os.Exit(exitErr.status)
+			return command.CmdErr{Cmd: cmd, Code: command.CmdErrCode(exitErr.status)}
+		}
+		return cmd.Errorf("could not run %s: %s", r.child.args[0], err)
+	}
+	return command.NoError()
+}
+
+func (r *runner) run(cmd *command.Cmd, args []string) command.CmdErr {
+	switch r.color {
+	case colorAuto, colorAlways, colorNever:
+	default:
+		return cmd.BadInputf("invalid --color value %q", r.color)
+	}
+
+	switch r.onParseError {
+	case parseErrorFail, parseErrorWarn:
+	default:
+		return cmd.BadInputf("invalid --on-parse-error value %q", r.onParseError)
+	}
+
+	switch r.mode {
+	case modeTemplate:
+	case modeEnvsubst:
+		if r.lint {
+			return cmd.BadInput("--lint may not be combined with --mode=envsubst")
+		}
+		if r.strict {
+			return cmd.BadInput("--strict may not be combined with --mode=envsubst")
+		}
+	default:
+		return cmd.BadInputf("invalid --mode value %q", r.mode)
+	}
+
+	if err := r.useDirs(); err != nil {
 		return cmd.BadInput(err)
 	}
 
-	var in []byte
+	if r.inFD >= 0 && r.in != "" {
+		return cmd.BadInput("--in-fd and --in may not be combined")
+	}
 
-	if r.in == "" {
-		in, err = ioutil.ReadAll(r.os.Stdin())
+	if r.diff && r.out == "" {
+		return cmd.BadInput("--diff requires --out")
+	}
+
+	if r.lint && r.diff {
+		return cmd.BadInput("--lint and --diff may not be combined")
+	}
+
+	if r.check {
+		if r.out == "" {
+			return cmd.BadInput("--check requires --out")
+		}
+		if r.lint {
+			return cmd.BadInput("--lint and --check may not be combined")
+		}
+	}
+
+	execArgs, execMode := parseExec(args)
+	if execMode {
+		if len(execArgs) == 0 {
+			return cmd.BadInput("exec requires a command")
+		}
+		if r.execWithEnv {
+			return cmd.BadInput("--exec-with-env may not be combined with exec")
+		}
+	}
+
+	if r.execWithEnv {
+		if !r.allowExec {
+			return cmd.BadInput("--exec-with-env requires --allow-exec")
+		}
+		if len(args) == 0 {
+			return cmd.BadInput("--exec-with-env requires a command after --")
+		}
+		if r.out != "" || r.lint {
+			return cmd.BadInput("--exec-with-env may not be combined with --out or --lint")
+		}
+		r.rendered = &bytes.Buffer{}
+	}
+
+	if r.context && r.varsPrefix != "" {
+		return cmd.BadInput("--context and --vars-prefix may not be combined")
+	}
+
+	if r.delims != "" {
+		if r.leftDelim != "" || r.rightDelim != "" {
+			return cmd.BadInput("--delims may not be combined with --left-delim or --right-delim")
+		}
+		delims := strings.Split(r.delims, ",")
+		if len(delims) != 2 || delims[0] == "" || delims[1] == "" {
+			return cmd.BadInputf("--delims must be two non-empty delimiters separated by a comma, got %q", r.delims)
+		}
+		r.leftDelim, r.rightDelim = delims[0], delims[1]
+	}
+
+	if len(r.envFiles.Strings) > 0 {
+		envFiles, err := loadEnvFiles(r.os, r.envFiles.Strings)
 		if err != nil {
+			return cmd.BadInput(err)
+		}
+		r.os = envFiles
+	}
+
+	batch, err := isBatchInput(r.in)
+	if err != nil {
+		return cmd.Error(err)
+	}
+	if batch {
+		r.os = newCachingOS(r.os)
+	}
+
+	if r.dumpResolved != "" {
+		r.resolved = newResolvedSet()
+		r.os = trackingOS{r.os, r.resolved}
+	}
+
+	funcs, err := r.mkFuncMap()
+	if err != nil {
+		return varsCmdErr(cmd, err)
+	}
+
+	var data interface{}
+	if len(r.dataFiles.Strings) > 0 {
+		r.data, err = loadDataFiles(r.dataFiles.Strings)
+		if err != nil {
+			return cmd.BadInput(err)
+		}
+		data = r.data
+	}
+
+	if r.varsPrefix != "" {
+		if !tbnregexp.GolangIdentifierRegexp().MatchString(r.varsPrefix) {
+			return cmd.BadInputf("Invalid vars prefix: %q", r.varsPrefix)
+		}
+		if _, ok := r.data[r.varsPrefix]; ok {
+			return cmd.BadInputf("vars prefix %q conflicts with a key in the data file", r.varsPrefix)
+		}
+
+		vars, err := envtemplate.ParseVars(r.vars.Strings)
+		if err != nil {
+			return cmd.BadInput(err)
+		}
+
+		prefixed := make(map[string]interface{}, len(r.data)+1)
+		for k, v := range r.data {
+			prefixed[k] = v
+		}
+		prefixed[r.varsPrefix] = vars
+		data = prefixed
+	}
+
+	if r.context {
+		vars, err := r.loadContextVars()
+		if err != nil {
+			return varsCmdErr(cmd, err)
+		}
+		data = mergeData(r.data, vars)
+	}
+
+	if r.stateFile != "" {
+		r.state, err = loadState(r.stateFile)
+		if err != nil {
+			return cmd.BadInput(err)
+		}
+	}
+
+	if batch {
+		if cerr := r.runBatch(cmd, funcs, data); cerr.Code != command.CmdErrCodeNoError {
+			return cerr
+		}
+	} else if err := r.processFile(r.in, r.out, false, funcs, data); err != nil {
+		return toCmdErr(cmd, err)
+	}
+
+	if batch && r.skipped > 0 {
+		fmt.Fprintf(r.os.Stderr(), "skipped %d unchanged output file(s)\n", r.skipped)
+	}
+
+	if r.stateChanged && !r.check {
+		if err := saveState(r.stateFile, r.state); err != nil {
 			return cmd.Error(err)
 		}
+	}
+
+	if r.resolved != nil {
+		if err := r.resolved.write(r.dumpResolved, r.redact); err != nil {
+			return cmd.Error(err)
+		}
+	}
+
+	if len(r.drifted) > 0 {
+		return command.CmdErr{
+			Cmd:  cmd,
+			Code: checkDriftCode,
+			Message: fmt.Sprintf(
+				"%d output file(s) would change: %s",
+				len(r.drifted),
+				strings.Join(r.drifted, ", "),
+			),
+		}
+	}
+
+	if r.execWithEnv {
+		child, cmdErr := r.execWithEnvCommand(cmd, args, r.rendered.Bytes())
+		if cmdErr.Code != command.CmdErrCodeNoError {
+			return cmdErr
+		}
+		r.child = child
+	}
+
+	if execMode {
+		r.child = &childCommand{execArgs, r.os.Environ()}
+	}
+
+	return command.NoError()
+}
+
+// processFile renders the template in the named input file to the named
+// output file, or copies it unchanged if verbatim is true. An empty input or
+// output filename selects STDIN or STDOUT, respectively. Errors caused by
+// invalid template input are returned as inputErrors.
+func (r *runner) processFile(
+	inFile string,
+	outFile string,
+	verbatim bool,
+	funcs template.FuncMap,
+	data interface{},
+) error {
+	var (
+		in  []byte
+		err error
+	)
+
+	r.source = inFile
+	r.inMode = 0
+
+	if inFile == "" {
+		in, err = r.readStdin()
+		if err != nil {
+			return err
+		}
 	} else {
-		in, err = ioutil.ReadFile(r.in)
+		in, err = ioutil.ReadFile(inFile)
 		if err != nil {
-			return cmd.Error(err)
+			return err
+		}
+		info, err := os.Stat(inFile)
+		if err != nil {
+			return err
 		}
+		r.inMode = info.Mode().Perm()
 		// in the special case where input and output are the same file,
 		// read the file into a string, and write a backup of the file
-		if r.in == r.out && !r.nobackup {
-			err = ioutil.WriteFile(r.in+".bak", in, 0644)
-			if err != nil {
-				return cmd.Error(err)
+		if inFile == outFile && !r.nobackup && !r.diff && !r.lint && !r.check {
+			if err := r.writeFile(inFile+".bak", in); err != nil {
+				return err
 			}
 		}
 	}
 
-	tmpl, err := template.New("").Funcs(funcs).Parse(string(in))
+	if r.stripBOM && !verbatim {
+		in = bytes.TrimPrefix(in, utf8BOM)
+	}
+
+	if r.lint {
+		if verbatim {
+			return nil
+		}
+		return r.lintTemplate(in, funcs)
+	}
+
+	out := in
+	if !verbatim {
+		if out, err = r.renderChecked(in, funcs, data); err != nil {
+			return err
+		}
+	}
+
+	if r.check {
+		return r.checkFile(outFile, out, verbatim)
+	}
+
+	if r.diff {
+		return r.printDiff(outFile, out)
+	}
+
+	if outFile == "" {
+		if r.rendered != nil {
+			r.rendered.Write(out)
+			return nil
+		}
+		_, err := r.os.Stdout().Write(out)
+		return err
+	}
+
+	if r.skipEmpty && !verbatim && len(bytes.TrimSpace(out)) == 0 {
+		if err := os.Remove(outFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		fmt.Fprintf(r.os.Stderr(), "skipped empty output file %s\n", outFile)
+		return nil
+	}
+
+	if r.onlyChanged {
+		if same, err := sameContents(outFile, out); err != nil {
+			return err
+		} else if same {
+			r.skipped++
+			return nil
+		}
+	}
+	return r.writeFile(outFile, out)
+}
+
+// readStdin reads the input from STDIN, or from the file descriptor
+// specified by --in-fd.
+func (r *runner) readStdin() ([]byte, error) {
+	if r.inFD < 0 {
+		return ioutil.ReadAll(r.os.Stdin())
+	}
+
+	f := os.NewFile(uintptr(r.inFD), fmt.Sprintf("fd %d", r.inFD))
+	defer f.Close()
+
+	in, err := ioutil.ReadAll(f)
 	if err != nil {
-		return cmd.Error(err)
+		return nil, fmt.Errorf("could not read --in-fd %d: %s", r.inFD, err)
+	}
+	return in, nil
+}
+
+// renderChecked renders in after applying the checks selected by
+// --strict-delims and --strict. With --mode=envsubst, environment variable
+// references are substituted instead.
+func (r *runner) renderChecked(
+	in []byte,
+	funcs template.FuncMap,
+	data interface{},
+) ([]byte, error) {
+	if r.mode == modeEnvsubst {
+		return envtemplate.Envsubst(in, r.os), nil
 	}
 
-	out := &bytes.Buffer{}
-	err = tmpl.Execute(out, nil)
+	if r.strictDelims {
+		if err := checkDelims(in, r.leftDelim, r.rightDelim); err != nil {
+			return nil, inputError{err}
+		}
+	}
+
+	if r.strict {
+		// other parse errors are reported by render
+		if tmpl, err := parseLenient(r.newTemplate(), string(in), funcs); err == nil {
+			if undefined := undefinedNames(tmpl, funcs); len(undefined) > 0 {
+				return nil, inputError{fmt.Errorf(
+					"undefined template variables: %s",
+					strings.Join(undefined, ", "),
+				)}
+			}
+		}
+	}
+
+	return r.render(in, funcs, data)
+}
+
+// render parses and executes the template source in. If parsing fails and
+// --on-parse-error=warn is set, a warning is printed and the source is
+// returned unchanged.
+func (r *runner) render(in []byte, funcs template.FuncMap, data interface{}) ([]byte, error) {
+	execFuncs := funcs
+	if r.maxRenderTime > 0 {
+		// once execute returns, any function the render calls is refused
+		ctx, abandon := context.WithCancel(context.Background())
+		defer abandon()
+		execFuncs = r.guardFuncs(ctx, funcs, data, r.source)
+	}
+
+	tmpl, err := r.newTemplate().Funcs(execFuncs).Parse(string(in))
 	if err != nil {
-		return cmd.Error(err)
+		if r.onParseError == parseErrorWarn {
+			fmt.Fprintf(r.os.Stderr(), "warning: %s; passing input through unchanged\n", err)
+			r.printErrorContext(in, err)
+			return in, nil
+		}
+		r.printErrorContext(in, err)
+		return nil, err
+	}
+
+	if r.maxRenderTime <= 0 {
+		r.resetRenderState(funcs, data, r.source)
+	}
+	out, err := execute(tmpl, data, r.maxRenderTime, r.maxOutputSize)
+	if err != nil {
+		r.printErrorContext(in, err)
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// newTemplate returns an empty template using the configured delimiters.
+// With --strict, referencing a missing key of a map is an error.
+func (r *runner) newTemplate() *template.Template {
+	tmpl := template.New("").Delims(r.leftDelim, r.rightDelim)
+	if r.strict {
+		tmpl = tmpl.Option("missingkey=error")
+	}
+	return tmpl
+}
+
+// resetRenderState clears state accumulated by template functions during a
+// render, and records the functions, data, and source file used by include
+// and sourceFile. With --max-render-time, it is called by the first guarded
+// function of the render.
+func (r *runner) resetRenderState(funcs template.FuncMap, data interface{}, source string) {
+	r.seqs = map[string]int{}
+	r.renderFuncs = funcs
+	r.renderData = data
+	r.renderSource = source
+	r.includes = nil
+	if source != "" {
+		r.includes = []string{source}
+	}
+}
+
+// printErrorContext writes the template source surrounding the location of
+// err to STDERR, if --error-context is set.
+func (r *runner) printErrorContext(src []byte, err error) {
+	if r.errorContext <= 0 {
+		return
 	}
+	if context := errorContext(src, err, r.errorContext); context != "" {
+		fmt.Fprint(r.os.Stderr(), context)
+	}
+}
 
-	if r.out == "" {
-		fmt.Fprintf(r.os.Stdout(), out.String())
+// checkFile records outFile as drifted if writing rendered to it would
+// change its contents, printing a diff if --diff is set. With --skip-empty,
+// empty output is compared against a missing file.
+func (r *runner) checkFile(outFile string, rendered []byte, verbatim bool) error {
+	var same bool
+	if r.skipEmpty && !verbatim && len(bytes.TrimSpace(rendered)) == 0 {
+		if _, err := os.Stat(outFile); os.IsNotExist(err) {
+			same = true
+		} else if err != nil {
+			return err
+		}
+		rendered = nil
 	} else {
-		err = ioutil.WriteFile(r.out, out.Bytes(), 0644)
-		if err != nil {
-			return cmd.Error(err)
+		var err error
+		if same, err = sameContents(outFile, rendered); err != nil {
+			return err
 		}
 	}
 
-	return command.NoError()
+	if same {
+		return nil
+	}
+	r.drifted = append(r.drifted, outFile)
+
+	if r.diff {
+		return r.printDiff(outFile, rendered)
+	}
+	return nil
 }
 
-func (r *runner) mkFuncMap() (template.FuncMap, error) {
-	predef := template.FuncMap{
-		"env":          r.env,
-		"envOrDefault": r.envOrDefault,
-		"envSplit":     r.envSplit,
+// printDiff writes a diff between the current contents of the output file
+// and rendered to STDOUT. A missing output file is treated as empty.
+func (r *runner) printDiff(outFile string, rendered []byte) error {
+	current, err := ioutil.ReadFile(outFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
 
-	funcs := template.FuncMap{
-		"env":          r.env,
-		"envOrDefault": r.envOrDefault,
-		"envSplit":     r.envSplit,
+	stdout := r.os.Stdout()
+	_, err = unifiedDiff(stdout, outFile, outFile+" (rendered)", current, rendered, r.useColor(stdout))
+	return err
+}
+
+// useColor returns true if output written to w should be colorized.
+func (r *runner) useColor(w io.Writer) bool {
+	switch r.color {
+	case colorAlways:
+		return true
+	case colorNever:
+		return false
 	}
 
-	for _, kvStr := range r.vars.Strings {
-		name, value := tbnstrings.SplitFirstEqual(kvStr)
+	if !isTerminal(w) {
+		return false
+	}
+	noColor, _ := r.os.LookupEnv("NO_COLOR")
+	return noColor == ""
+}
 
-		if !tbnregexp.GolangIdentifierRegexp().MatchString(name) {
-			return nil, fmt.Errorf("Invalid template variable name: %q", name)
+// fileMode returns the mode used for files written by the runner: the
+// umask-derived mode if --respect-umask is set, otherwise the mode of the
+// input file, or 0644 if the input is STDIN.
+func (r *runner) fileMode() os.FileMode {
+	switch {
+	case r.respectUmask:
+		return 0666 &^ umask()
+	case r.inMode != 0:
+		return r.inMode
+	default:
+		return 0644
+	}
+}
+
+func (r *runner) writeFile(filename string, data []byte) error {
+	mode := r.fileMode()
+	if !r.respectUmask && r.inMode == 0 {
+		// absent an explicit mode, replacing a file keeps its mode
+		if info, err := os.Stat(filename); err == nil {
+			mode = info.Mode().Perm()
 		}
+	}
+	return writeFileAtomic(filename, data, mode)
+}
+
+// execute renders tmpl with the given data. If timeout is positive and
+// rendering does not complete within it, an error is returned. Template
+// execution cannot be interrupted, so a timed-out render is abandoned rather
+// than stopped; render guards its functions, so that it cannot interfere
+// with later renders. If maxSize is positive, rendering fails as soon as the
+// output exceeds maxSize bytes.
+func execute(
+	tmpl *template.Template,
+	data interface{},
+	timeout time.Duration,
+	maxSize int64,
+) (*bytes.Buffer, error) {
+	out := &bytes.Buffer{}
+
+	var w io.Writer = out
+	if maxSize > 0 {
+		w = &limitWriter{w: out, limit: maxSize}
+	}
+
+	if timeout <= 0 {
+		return out, tmpl.Execute(w, data)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- tmpl.Execute(w, data) }()
+
+	select {
+	case err := <-done:
+		return out, err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("rendering exceeded max render time of %s", timeout)
+	}
+}
+
+// limitWriter is an io.Writer that fails once more than limit bytes have been
+// written to it.
+type limitWriter struct {
+	w       io.Writer
+	limit   int64
+	written int64
+}
+
+func (lw *limitWriter) Write(p []byte) (int, error) {
+	if lw.written+int64(len(p)) > lw.limit {
+		return 0, fmt.Errorf("rendered output exceeds max output size of %d bytes", lw.limit)
+	}
+	n, err := lw.w.Write(p)
+	lw.written += int64(n)
+	return n, err
+}
+
+func (r *runner) mkFuncMap() (template.FuncMap, error) {
+	cliFuncs := template.FuncMap{
+		"envOrData": r.envOrData,
+		"lookup":    r.lookup,
+		"gitCommit": r.gitCommit,
+		"gitBranch": r.gitBranch,
+
+		"seqNext":     r.seqNext,
+		"now":         r.now,
+		"toolVersion": toolVersion,
+		"sourceFile":  r.sourceFile,
+		"setState":    r.setState,
+		"getState":    r.getState,
+		"goos":        r.runtimeOS,
+		"goarch":      r.runtimeArch,
+
+		"hostname":    r.hostname,
+		"fqdn":        r.fqdn,
+		"interfaceIP": r.interfaceIP,
+		"privateIP":   r.privateIP,
+		"publicIP":    r.publicIP,
+
+		"uuidv4":       r.uuidv4,
+		"randAlphaNum": r.randAlphaNum,
+		"randBytesB64": r.randBytesB64,
+
+		"fileAge":       r.fileAge,
+		"fileOlderThan": r.fileOlderThan,
+
+		"procEnv": r.procEnv,
+		"include": r.include,
+		"vault":   r.vault,
+
+		"ssm":          r.ssm,
+		"ssmOrDefault": r.ssmOrDefault,
+		"awsSecret":    r.awsSecret,
+		"gcpSecret":    r.gcpSecret,
+		"azureSecret":  r.azureSecret,
+		"consulKey":    r.consulKey,
+		"consulTree":   r.consulTree,
+		"etcdGet":      r.etcdGet,
+		"etcdPrefix":   r.etcdPrefix,
+		"k8sSecret":    r.k8sSecret,
+		"k8sConfigMap": r.k8sConfigMap,
+
+		"file":      r.file,
+		"envOrFile": r.envOrFile,
+	}
 
-		if predef[name] != nil {
-			return nil, fmt.Errorf("%q cannot be used as a variable name", name)
+	funcs := envtemplate.Funcs(r.os)
+	for name, fn := range cliFuncs {
+		funcs[name] = fn
+	}
+
+	if r.sprig {
+		// Sprig's functions replace envtemplate's of the same name, so that
+		// templates written for Sprig behave as documented by Sprig, except
+		// that the environment is still consulted through r.os.
+		env := funcs["env"]
+		for name, fn := range sprig.TxtFuncMap() {
+			funcs[name] = fn
+		}
+		funcs["env"] = env
+		funcs["expandenv"] = r.os.ExpandEnv
+	}
+
+	for name, replacement := range r.deprecated {
+		funcs[name] = r.deprecatedFunc(name, replacement, funcs[replacement])
+	}
+
+	if r.context {
+		return funcs, nil
+	}
+
+	vars, err := envtemplate.ParseVars(r.vars.Strings)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.varsFile != "" {
+		fileVars, err := loadVarsFile(r.varsFile, r.allowExec)
+		if err != nil {
+			return nil, err
 		}
 
-		if funcs[name] != nil {
-			return nil, fmt.Errorf("variable %q specified more than once", name)
+		for name, value := range fileVars {
+			// values from --vars take precedence
+			if _, ok := vars[name]; !ok {
+				vars[name] = value
+			}
 		}
+	}
 
-		funcs[name] = func() string { return value }
+	if err := envtemplate.AddVars(funcs, vars); err != nil {
+		return nil, err
+	}
+	if r.resolved != nil {
+		r.resolved.trackVars(funcs, vars)
 	}
 
 	return funcs, nil
 }
 
-func (r *runner) env(key string) (string, error) {
-	value, ok := r.os.LookupEnv(key)
-	if !ok {
-		return "", fmt.Errorf("no value for $%s in environment", key)
+// loadContextVars returns the vars given with --vars-file and --vars, for use
+// as template data with --context. Values from --vars take precedence.
+func (r *runner) loadContextVars() (map[string]interface{}, error) {
+	vars, err := envtemplate.ParseVars(r.vars.Strings)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]interface{}{}
+	if r.varsFile != "" {
+		if data, err = loadVarsObject(r.varsFile, r.allowExec); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, value := range vars {
+		data[name] = value
+	}
+	return data, nil
+}
+
+func (r *runner) envOrData(key string) (interface{}, error) {
+	if value, ok := r.os.LookupEnv(key); ok {
+		return value, nil
+	}
+	if value, ok := r.data[key]; ok {
+		return value, nil
+	}
+	if !r.strict {
+		return "", nil
+	}
+	return nil, fmt.Errorf("no value for $%s in environment or data file", key)
+}
+
+func (r *runner) lookup(path string) (interface{}, error) {
+	if r.data == nil {
+		return nil, fmt.Errorf("lookup requires --data-file")
 	}
-	return value, nil
+	return envtemplate.GetPath(r.data, path)
 }
 
-func (r *runner) envOrDefault(key, defValue string) string {
-	value, ok := r.os.LookupEnv(key)
+func (r *runner) gitCommit() (string, error) {
+	if r.allowExec {
+		return gitCommand("rev-parse", "HEAD")
+	}
+	commit, _, err := gitHead(".")
+	return commit, err
+}
+
+func (r *runner) gitBranch() (string, error) {
+	if r.allowExec {
+		return gitCommand("rev-parse", "--abbrev-ref", "HEAD")
+	}
+	_, branch, err := gitHead(".")
+	return branch, err
+}
+
+func (r *runner) seqNext(name string) int {
+	n, ok := r.seqs[name]
 	if !ok {
-		return r.os.ExpandEnv(defValue)
+		n = r.seqBase
+	}
+	r.seqs[name] = n + 1
+	return n
+}
+
+func (r *runner) sourceFile() string {
+	return sourceName(r.renderSource)
+}
+
+// sourceName returns the name of the template read from source, which is
+// empty for STDIN.
+func sourceName(source string) string {
+	if source == "" {
+		return "stdin"
 	}
-	return value
+	return source
 }
 
-func (r *runner) envSplit(key string, sep string) ([]string, error) {
-	value, err := r.env(key)
+func (r *runner) fileAge(filename string) (int64, error) {
+	filename, err := envtemplate.ExpandHome(filename, r.os)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(filename)
 	if err != nil {
-		return []string(nil), err
+		return 0, err
 	}
-	return strings.Split(value, sep), nil
+	return int64(r.now().Sub(info.ModTime()) / time.Second), nil
+}
+
+func (r *runner) fileOlderThan(filename, duration string) (bool, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return false, err
+	}
+
+	filename, err = envtemplate.ExpandHome(filename, r.os)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		if os.IsNotExist(err) && !r.strict {
+			return false, nil
+		}
+		return false, err
+	}
+	return r.now().Sub(info.ModTime()) > d, nil
+}
+
+func (r *runner) runtimeOS() string {
+	return r.goos
+}
+
+func (r *runner) runtimeArch() string {
+	return r.goarch
+}
+
+func toolVersion() string {
+	return TbnPublicVersion
 }
 
 func mkCLI() cli.CLI {
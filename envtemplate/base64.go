@@ -0,0 +1,52 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// b64enc returns s encoded as padded, standard base64.
+func b64enc(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// b64dec decodes standard base64, with or without padding.
+func b64dec(s string) (string, error) {
+	return decodeBase64("b64dec", base64.RawStdEncoding, s)
+}
+
+// b64urlenc returns s encoded as padded, URL-safe base64.
+func b64urlenc(s string) string {
+	return base64.URLEncoding.EncodeToString([]byte(s))
+}
+
+// b64urldec decodes URL-safe base64, with or without padding, as found in
+// JWTs.
+func b64urldec(s string) (string, error) {
+	return decodeBase64("b64urldec", base64.RawURLEncoding, s)
+}
+
+func decodeBase64(name string, enc *base64.Encoding, s string) (string, error) {
+	b, err := enc.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestB64Enc(t *testing.T) {
+	assert.Equal(t, b64enc(""), "")
+	assert.Equal(t, b64enc("user:pass"), "dXNlcjpwYXNz")
+	assert.Equal(t, b64enc("a"), "YQ==")
+	assert.Equal(t, b64enc("\xfb\xff"), "+/8=")
+}
+
+func TestB64Dec(t *testing.T) {
+	for _, in := range []string{"YQ==", "YQ", "YQ==\n"} {
+		got, err := b64dec(in)
+		assert.Nil(t, err)
+		assert.Equal(t, got, "a")
+	}
+
+	got, err := b64dec("+/8=")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "\xfb\xff")
+
+	got, err = b64dec("-_8")
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "b64dec: illegal base64 data")
+}
+
+func TestB64URLEnc(t *testing.T) {
+	assert.Equal(t, b64urlenc("a"), "YQ==")
+	assert.Equal(t, b64urlenc("\xfb\xff"), "-_8=")
+}
+
+func TestB64URLDec(t *testing.T) {
+	for _, in := range []string{"-_8=", "-_8"} {
+		got, err := b64urldec(in)
+		assert.Nil(t, err)
+		assert.Equal(t, got, "\xfb\xff")
+	}
+
+	got, err := b64urldec("+/8=")
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "b64urldec: illegal base64 data")
+}
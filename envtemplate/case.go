@@ -0,0 +1,107 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"strings"
+	"unicode"
+)
+
+// words splits s into words for case conversion. Words are separated by any
+// character other than a letter or digit, and by changes in case, so that
+// "APP_DB_HOST", "app-db-host", and "appDBHost" all contain the words "app",
+// "db", and "host", ignoring case. A digit belongs to the preceding word.
+func words(s string) []string {
+	var (
+		result []string
+		word   []rune
+	)
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				result = append(result, string(word))
+				word = nil
+			}
+			continue
+		}
+
+		if unicode.IsUpper(r) && len(word) > 0 {
+			prev := word[len(word)-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if !unicode.IsUpper(prev) || nextLower {
+				result = append(result, string(word))
+				word = nil
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		result = append(result, string(word))
+	}
+	return result
+}
+
+// joinWords returns the words of s, lower-cased and joined by sep.
+func joinWords(s, sep string) string {
+	ws := words(s)
+	for i, w := range ws {
+		ws[i] = strings.ToLower(w)
+	}
+	return strings.Join(ws, sep)
+}
+
+// snakecase returns s as lower case words separated by underscores.
+func snakecase(s string) string {
+	return joinWords(s, "_")
+}
+
+// kebabcase returns s as lower case words separated by hyphens.
+func kebabcase(s string) string {
+	return joinWords(s, "-")
+}
+
+// camelcase returns the words of s joined with each word after the first
+// capitalized, e.g. "dbHost".
+func camelcase(s string) string {
+	ws := words(s)
+	for i, w := range ws {
+		w = strings.ToLower(w)
+		if i > 0 {
+			w = capitalize(w)
+		}
+		ws[i] = w
+	}
+	return strings.Join(ws, "")
+}
+
+// title returns s with the first letter of each space-separated word
+// converted to upper case. The rest of each word is unchanged.
+func title(s string) string {
+	fields := strings.Split(s, " ")
+	for i, f := range fields {
+		fields[i] = capitalize(f)
+	}
+	return strings.Join(fields, " ")
+}
+
+func capitalize(s string) string {
+	for i, r := range s {
+		return string(unicode.ToUpper(r)) + s[i+len(string(r)):]
+	}
+	return s
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestWords(t *testing.T) {
+	for in, want := range map[string][]string{
+		"":              nil,
+		"_-_ ":          nil,
+		"app":           {"app"},
+		"APP_DB_HOST":   {"APP", "DB", "HOST"},
+		"app-db-host":   {"app", "db", "host"},
+		"app.db host":   {"app", "db", "host"},
+		"appDBHost":     {"app", "DB", "Host"},
+		"HTTPServer":    {"HTTP", "Server"},
+		"AppDbHost":     {"App", "Db", "Host"},
+		"v2Api":         {"v2", "Api"},
+		"OAUTH2_CLIENT": {"OAUTH2", "CLIENT"},
+		"élanVital":     {"élan", "Vital"},
+	} {
+		assert.DeepEqual(t, words(in), want)
+	}
+}
+
+func TestCaseConversions(t *testing.T) {
+	for _, tc := range []struct {
+		in, snake, kebab, camel string
+	}{
+		{"", "", "", ""},
+		{"APP_DB_HOST", "app_db_host", "app-db-host", "appDbHost"},
+		{"app-db-host", "app_db_host", "app-db-host", "appDbHost"},
+		{"appDBHost", "app_db_host", "app-db-host", "appDbHost"},
+		{"HTTPServer", "http_server", "http-server", "httpServer"},
+		{"max connections", "max_connections", "max-connections", "maxConnections"},
+	} {
+		assert.Equal(t, snakecase(tc.in), tc.snake)
+		assert.Equal(t, kebabcase(tc.in), tc.kebab)
+		assert.Equal(t, camelcase(tc.in), tc.camel)
+	}
+}
+
+func TestTitle(t *testing.T) {
+	assert.Equal(t, title(""), "")
+	assert.Equal(t, title("hello world"), "Hello World")
+	assert.Equal(t, title("hello  wORLD"), "Hello  WORLD")
+	assert.Equal(t, title("élan app_db"), "Élan App_db")
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"bytes"
+	"strings"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+// Envsubst replaces references to environment variables in in, in the
+// style of GNU envsubst. Both $VAR and ${VAR} are replaced with the value
+// of VAR, or with the empty string if it is not set. ${VAR:-default} is
+// replaced with default if VAR is unset or empty, and ${VAR-default} if VAR
+// is unset. Defaults may themselves contain references. A $ that does not
+// begin a reference, including one with no closing brace, is copied
+// unchanged.
+func Envsubst(in []byte, os tbnos.OS) []byte {
+	return []byte(envsubst(string(in), os))
+}
+
+func envsubst(s string, os tbnos.OS) string {
+	var b bytes.Buffer
+	for i := 0; i < len(s); {
+		if s[i] != '$' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		if s[i+1] == '{' {
+			end := closingBrace(s, i+2)
+			if end < 0 {
+				b.WriteString(s[i:])
+				break
+			}
+			if value, ok := expandBraced(s[i+2:end], os); ok {
+				b.WriteString(value)
+			} else {
+				b.WriteString(s[i : end+1])
+			}
+			i = end + 1
+			continue
+		}
+
+		n := nameLen(s[i+1:])
+		if n == 0 {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+		value, _ := os.LookupEnv(s[i+1 : i+1+n])
+		b.WriteString(value)
+		i += 1 + n
+	}
+	return b.String()
+}
+
+// expandBraced expands the contents of a ${...} reference. It returns false
+// if expr is not a valid reference.
+func expandBraced(expr string, os tbnos.OS) (string, bool) {
+	n := nameLen(expr)
+	if n == 0 {
+		return "", false
+	}
+
+	name, rest := expr[:n], expr[n:]
+	value, set := os.LookupEnv(name)
+	switch {
+	case rest == "":
+		return value, true
+	case strings.HasPrefix(rest, ":-"):
+		if !set || value == "" {
+			return envsubst(rest[2:], os), true
+		}
+		return value, true
+	case strings.HasPrefix(rest, "-"):
+		if !set {
+			return envsubst(rest[1:], os), true
+		}
+		return value, true
+	}
+	return "", false
+}
+
+// closingBrace returns the index of the brace closing a reference whose
+// contents begin at start, allowing for nested references, or -1 if there
+// is none.
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// nameLen returns the length of the environment variable name at the start
+// of s.
+func nameLen(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || i > 0 && '0' <= c && c <= '9' {
+			continue
+		}
+		return i
+	}
+	return len(s)
+}
@@ -0,0 +1,55 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestEnvsubst(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOST").Return("db", true).AnyTimes()
+	mockOS.EXPECT().LookupEnv("PORT").Return("5432", true).AnyTimes()
+	mockOS.EXPECT().LookupEnv("EMPTY").Return("", true).AnyTimes()
+	mockOS.EXPECT().LookupEnv("UNSET").Return("", false).AnyTimes()
+	mockOS.EXPECT().LookupEnv("HOST_1").Return("", false).AnyTimes()
+
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"$HOST:$PORT", "db:5432"},
+		{"${HOST}_1", "db_1"},
+		{"$HOST_1", ""},
+		{"[$UNSET]", "[]"},
+		{"${UNSET:-x} ${EMPTY:-y} ${HOST:-z}", "x y db"},
+		{"${UNSET-x} [${EMPTY-y}] ${HOST-z}", "x [] db"},
+		{"${UNSET:-$HOST:${PORT}}", "db:5432"},
+		{"${UNSET:-${UNSET:-deep}}", "deep"},
+		{"${UNSET:-}", ""},
+		{"cost: $5 $ $$ $", "cost: $5 $ $$ $"},
+		{"${HOST", "${HOST"},
+		{"${1BAD} ${HOST?x} ${}", "${1BAD} ${HOST?x} ${}"},
+		{"{{env \"HOST\"}}", "{{env \"HOST\"}}"},
+	} {
+		assert.Equal(t, string(Envsubst([]byte(tc.in), mockOS)), tc.want)
+	}
+}
@@ -0,0 +1,335 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package envtemplate renders go templates using variables from the
+// environment and from caller-supplied values. It provides the template
+// functions used by the envtemplate command.
+package envtemplate
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+	tbnregexp "github.com/turbinelabs/nonstdlib/regexp"
+	tbnstrings "github.com/turbinelabs/nonstdlib/strings"
+)
+
+// FuncMap returns the predefined template functions, as returned by Funcs,
+// along with a function for each of the given vars that returns its value.
+func FuncMap(vars map[string]string, os tbnos.OS) (template.FuncMap, error) {
+	funcs := Funcs(os)
+	if err := AddVars(funcs, vars); err != nil {
+		return nil, err
+	}
+	return funcs, nil
+}
+
+// Funcs returns the predefined template functions. Environment variables are
+// looked up using os.
+func Funcs(os tbnos.OS) template.FuncMap {
+	e := envFuncs{os}
+
+	return template.FuncMap{
+		"env":             e.env,
+		"envOrDefault":    e.envOrDefault,
+		"envSplit":        e.envSplit,
+		"envInt":          e.envInt,
+		"envBool":         e.envBool,
+		"envFloat":        e.envFloat,
+		"envDuration":     e.envDuration,
+		"allSet":          e.allSet,
+		"envAll":          e.envAll,
+		"envWithPrefix":   e.envWithPrefix,
+		"expandHome":      e.expandHome,
+		"regexQuote":      regexp.QuoteMeta,
+		"regexMatch":      regexMatch,
+		"regexReplaceAll": regexReplaceAll,
+		"chunk":           chunk,
+
+		"countLines":     countLines,
+		"countWords":     countWords,
+		"countBytes":     countBytes,
+		"countFileLines": fileCounter(e.expandHome, countLines),
+		"countFileWords": fileCounter(e.expandHome, countWords),
+		"countFileBytes": fileCounter(e.expandHome, countBytes),
+
+		"mustMinLen": mustMinLen,
+		"pgURL":      pgURL,
+		"mysqlDSN":   mysqlDSN,
+
+		"toUpper": strings.ToUpper,
+		"toLower": strings.ToLower,
+		"upper":   strings.ToUpper,
+		"lower":   strings.ToLower,
+		"title":   title,
+
+		"snakecase": snakecase,
+		"camelcase": camelcase,
+		"kebabcase": kebabcase,
+
+		"trim":       strings.TrimSpace,
+		"trimPrefix": trimPrefix,
+		"trimSuffix": trimSuffix,
+		"replace":    replace,
+		"split":      split,
+		"join":       join,
+		"contains":   contains,
+		"hasPrefix":  hasPrefix,
+		"hasSuffix":  hasSuffix,
+
+		"default":  defaultValue,
+		"coalesce": coalesce,
+		"required": required,
+
+		"baseEncode": baseEncode,
+		"baseDecode": baseDecode,
+		"pow":        pow,
+		"log2":       logFunc("log2", math.Log2),
+		"log10":      logFunc("log10", math.Log10),
+
+		"yamlValue": yamlValue,
+		"mapToYAML": mapToYAML,
+		"yamlBlock": yamlBlock,
+		"yamlGet":   yamlGet,
+		"toYAML":    toYAML,
+		"fromYAML":  fromYAML,
+
+		"toJSON":   toJSON,
+		"fromJSON": fromJSON,
+
+		"b64enc":    b64enc,
+		"b64dec":    b64dec,
+		"b64urlenc": b64urlenc,
+		"b64urldec": b64urldec,
+
+		"md5sum":    md5sum,
+		"sha1sum":   sha1sum,
+		"sha256sum": sha256sum,
+
+		"durationBetween": durationBetween,
+		"date":            date,
+		"unixEpoch":       unixEpoch,
+		"dateModify":      dateModify,
+		"fence":           fence,
+		"indent":          indent,
+		"nindent":         nindent,
+		"switch":          switchValue,
+		"inCanary":        inCanary,
+		"queryGet":        queryGet,
+		"queryKeys":       queryKeys,
+		"urlEncode":       url.QueryEscape,
+		"urlDecode":       urlDecode,
+		"urlParse":        urlParse,
+		"joinWrap":        joinWrap,
+		"naturalSort":     naturalSort,
+
+		"goString":   goString,
+		"cString":    cString,
+		"quote":      quote,
+		"squote":     squote,
+		"shellQuote": shellQuote,
+	}
+}
+
+// AddVars adds a function to funcs for each of the given vars that returns
+// its value. It fails if any var name is not a valid identifier or is
+// already defined in funcs.
+func AddVars(funcs template.FuncMap, vars map[string]string) error {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := CheckVarName(name, funcs); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range names {
+		value := vars[name]
+		funcs[name] = func() string { return value }
+	}
+	return nil
+}
+
+// ParseVars parses a list of vars in the format name=value. It fails if a
+// name is given more than once.
+func ParseVars(kvs []string) (map[string]string, error) {
+	vars := make(map[string]string, len(kvs))
+	for _, kvStr := range kvs {
+		name, value := tbnstrings.SplitFirstEqual(kvStr)
+		if _, ok := vars[name]; ok {
+			return nil, fmt.Errorf("variable %q specified more than once", name)
+		}
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+// CheckVarName returns an error if name is not a valid template variable
+// name, or would shadow one of the functions in predef.
+func CheckVarName(name string, predef template.FuncMap) error {
+	if !tbnregexp.GolangIdentifierRegexp().MatchString(name) {
+		return fmt.Errorf("Invalid template variable name: %q", name)
+	}
+
+	if predef[name] != nil {
+		return fmt.Errorf("%q cannot be used as a variable name", name)
+	}
+
+	return nil
+}
+
+// ExpandHome replaces a leading "~" or "~/" in path with the home directory
+// given by $HOME, as found using os. Other paths, including those starting
+// with "~user", are returned unchanged.
+func ExpandHome(path string, os tbnos.OS) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	home, ok := os.LookupEnv("HOME")
+	if !ok || home == "" {
+		return "", fmt.Errorf("cannot expand %q: no value for $HOME in environment", path)
+	}
+	return home + path[1:], nil
+}
+
+type envFuncs struct {
+	os tbnos.OS
+}
+
+func (e envFuncs) env(key string) (string, error) {
+	value, ok := e.os.LookupEnv(key)
+	if !ok {
+		if names := suggestNames(key, e.os.Environ()); len(names) > 0 {
+			return "", fmt.Errorf(
+				"no value for $%s in environment; did you mean %s?",
+				key,
+				strings.Join(names, " or "),
+			)
+		}
+		return "", fmt.Errorf("no value for $%s in environment", key)
+	}
+	return value, nil
+}
+
+func (e envFuncs) envOrDefault(key, defValue string) string {
+	value, ok := e.os.LookupEnv(key)
+	if !ok {
+		return e.os.ExpandEnv(defValue)
+	}
+	return value
+}
+
+func (e envFuncs) envSplit(key string, sep string) ([]string, error) {
+	value, err := e.env(key)
+	if err != nil {
+		return []string(nil), err
+	}
+	return strings.Split(value, sep), nil
+}
+
+// envParse looks up the required environment variable key and parses its
+// value, ignoring surrounding whitespace. If parse fails, the returned error
+// names the variable and the expected kind of value.
+func (e envFuncs) envParse(key, kind string, parse func(string) error) error {
+	value, err := e.env(key)
+	if err != nil {
+		return err
+	}
+	if err := parse(strings.TrimSpace(value)); err != nil {
+		return fmt.Errorf("value of $%s must be %s, got %q", key, kind, value)
+	}
+	return nil
+}
+
+func (e envFuncs) envInt(key string) (int, error) {
+	var i int
+	err := e.envParse(key, "an integer", func(s string) (err error) {
+		i, err = strconv.Atoi(s)
+		return err
+	})
+	return i, err
+}
+
+func (e envFuncs) envBool(key string) (bool, error) {
+	var b bool
+	err := e.envParse(key, "a boolean", func(s string) (err error) {
+		b, err = strconv.ParseBool(s)
+		return err
+	})
+	return b, err
+}
+
+func (e envFuncs) envFloat(key string) (float64, error) {
+	var f float64
+	err := e.envParse(key, "a number", func(s string) (err error) {
+		f, err = strconv.ParseFloat(s, 64)
+		return err
+	})
+	return f, err
+}
+
+func (e envFuncs) envDuration(key string) (time.Duration, error) {
+	var d time.Duration
+	err := e.envParse(key, "a duration", func(s string) (err error) {
+		d, err = time.ParseDuration(s)
+		return err
+	})
+	return d, err
+}
+
+func (e envFuncs) allSet(keys ...string) bool {
+	for _, key := range keys {
+		if value, ok := e.os.LookupEnv(key); !ok || value == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (e envFuncs) envAll() map[string]string {
+	return e.envWithPrefix("")
+}
+
+// envWithPrefix returns the environment variables whose names start with
+// prefix, keyed by name with the prefix removed.
+func (e envFuncs) envWithPrefix(prefix string) map[string]string {
+	env := map[string]string{}
+	for _, kv := range e.os.Environ() {
+		name, value := tbnstrings.SplitFirstEqual(kv)
+		if name == "" || !strings.HasPrefix(name, prefix) || name == prefix {
+			continue
+		}
+		env[strings.TrimPrefix(name, prefix)] = value
+	}
+	return env
+}
+
+func (e envFuncs) expandHome(path string) (string, error) {
+	return ExpandHome(path, e.os)
+}
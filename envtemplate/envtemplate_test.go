@@ -0,0 +1,394 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+	"github.com/turbinelabs/test/assert"
+)
+
+func mkMockOS(t *testing.T) (*tbnos.MockOS, func()) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	return tbnos.NewMockOS(ctrl), ctrl.Finish
+}
+
+// renderString renders the template in with Render, returning the output as
+// a string.
+func renderString(in string, opts ...Option) (string, error) {
+	out := &bytes.Buffer{}
+	err := Render(strings.NewReader(in), out, opts...)
+	return out.String(), err
+}
+
+func TestRender(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOME").Return("/home/tbn", true)
+	mockOS.EXPECT().LookupEnv("MISSING").Return("", false)
+	mockOS.EXPECT().ExpandEnv("$TBN/default").Return("/opt/tbn/default")
+
+	got, err := renderString(
+		`{{env "HOME"}} {{envOrDefault "MISSING" "$TBN/default"}} {{foo}}`,
+		WithVars(map[string]string{"foo": "bar"}),
+		WithOS(mockOS),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "/home/tbn /opt/tbn/default bar")
+}
+
+func TestRenderMissingEnv(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("MISSING").Return("", false)
+	mockOS.EXPECT().Environ().Return(nil)
+
+	got, err := renderString(`{{env "MISSING"}}`, WithOS(mockOS))
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "no value for $MISSING in environment")
+}
+
+func TestRenderMissingEnvSuggestion(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("DB_HST").Return("", false)
+	mockOS.EXPECT().Environ().Return([]string{"DB_HOST=db", "DB_PORT=5432", "HOME=/home/tbn"})
+
+	got, err := renderString(`{{env "DB_HST"}}`, WithOS(mockOS))
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "no value for $DB_HST in environment; did you mean DB_HOST?")
+}
+
+func TestRenderParseError(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	got, err := renderString(`{{undefined}}`, WithOS(mockOS))
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, `function "undefined" not defined`)
+}
+
+func TestEnvSplit(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOSTS").Return("a:b:c", true)
+	mockOS.EXPECT().LookupEnv("MISSING").Return("", false)
+	mockOS.EXPECT().Environ().Return(nil)
+
+	e := envFuncs{mockOS}
+
+	got, err := e.envSplit("HOSTS", ":")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, []string{"a", "b", "c"})
+
+	got, err = e.envSplit("MISSING", ":")
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "no value for $MISSING in environment")
+}
+
+func TestEnvTyped(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	env := map[string]string{
+		"PORT":     " 8080\n",
+		"DEBUG":    "true",
+		"RATIO":    "0.25",
+		"TIMEOUT":  "1m30s",
+		"BAD":      "many",
+		"NEGATIVE": "-3",
+	}
+	mockOS.EXPECT().LookupEnv(gomock.Any()).DoAndReturn(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}).AnyTimes()
+	mockOS.EXPECT().Environ().Return(nil)
+
+	e := envFuncs{mockOS}
+
+	i, err := e.envInt("PORT")
+	assert.Nil(t, err)
+	assert.Equal(t, i, 8080)
+
+	i, err = e.envInt("NEGATIVE")
+	assert.Nil(t, err)
+	assert.Equal(t, i, -3)
+
+	b, err := e.envBool("DEBUG")
+	assert.Nil(t, err)
+	assert.True(t, b)
+
+	f, err := e.envFloat("RATIO")
+	assert.Nil(t, err)
+	assert.Equal(t, f, 0.25)
+
+	d, err := e.envDuration("TIMEOUT")
+	assert.Nil(t, err)
+	assert.Equal(t, d, 90*time.Second)
+
+	_, err = e.envInt("RATIO")
+	assert.ErrorContains(t, err, `value of $RATIO must be an integer, got "0.25"`)
+
+	_, err = e.envBool("BAD")
+	assert.ErrorContains(t, err, `value of $BAD must be a boolean, got "many"`)
+
+	_, err = e.envFloat("BAD")
+	assert.ErrorContains(t, err, `value of $BAD must be a number, got "many"`)
+
+	_, err = e.envDuration("PORT")
+	assert.ErrorContains(t, err, `value of $PORT must be a duration, got " 8080\n"`)
+
+	_, err = e.envInt("MISSING")
+	assert.ErrorContains(t, err, "no value for $MISSING in environment")
+}
+
+func TestRenderEnvTyped(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("WORKERS").Return("4", true)
+	mockOS.EXPECT().LookupEnv("TLS").Return("false", true)
+
+	got, err := renderString(
+		`{{if gt (envInt "WORKERS") 2}}many{{end}} {{if not (envBool "TLS")}}plain{{end}}`,
+		WithOS(mockOS),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "many plain")
+}
+
+func TestAllSet(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("A").Return("a", true).Times(2)
+	mockOS.EXPECT().LookupEnv("B").Return("", true)
+
+	e := envFuncs{mockOS}
+	assert.True(t, e.allSet("A"))
+	assert.False(t, e.allSet("A", "B"))
+	assert.True(t, e.allSet())
+}
+
+func TestEnvWithPrefix(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().Environ().Return([]string{
+		"UPSTREAM_API=api:8080",
+		"UPSTREAM_WEB=web:80=x",
+		"UPSTREAM_=empty",
+		"HOME=/home/tbn",
+		"=C:=C:\\",
+	}).Times(2)
+
+	e := envFuncs{mockOS}
+	assert.DeepEqual(t, e.envWithPrefix("UPSTREAM_"), map[string]string{
+		"API": "api:8080",
+		"WEB": "web:80=x",
+	})
+	assert.DeepEqual(t, e.envAll(), map[string]string{
+		"UPSTREAM_API": "api:8080",
+		"UPSTREAM_WEB": "web:80=x",
+		"UPSTREAM_":    "empty",
+		"HOME":         "/home/tbn",
+	})
+}
+
+func TestRenderEnvWithPrefix(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().Environ().Return([]string{"UPSTREAM_WEB=web:80", "UPSTREAM_API=api:8080"})
+
+	got, err := renderString(
+		`{{range $name, $addr := envWithPrefix "UPSTREAM_"}}upstream {{$name}} {{$addr}};{{end}}`,
+		WithOS(mockOS),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "upstream API api:8080;upstream WEB web:80;")
+}
+
+func TestFuncMapPredefinedName(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	for name := range Funcs(mockOS) {
+		_, err := FuncMap(map[string]string{name: "x"}, mockOS)
+		assert.ErrorContains(t, err, `"`+name+`" cannot be used as a variable name`)
+	}
+}
+
+func TestFuncMapInvalidName(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	_, err := FuncMap(map[string]string{"a-b": "x"}, mockOS)
+	assert.ErrorContains(t, err, `Invalid template variable name: "a-b"`)
+}
+
+func TestParseVars(t *testing.T) {
+	got, err := ParseVars([]string{"a=b", "c=d=e", "f="})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, map[string]string{"a": "b", "c": "d=e", "f": ""})
+}
+
+func TestParseVarsDuplicate(t *testing.T) {
+	got, err := ParseVars([]string{"a=b", "a=c"})
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, `variable "a" specified more than once`)
+}
+
+func TestExpandHome(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOME").Return("/home/tbn", true).Times(2)
+
+	for _, tc := range []struct {
+		path string
+		want string
+	}{
+		{"~", "/home/tbn"},
+		{"~/sub/file", "/home/tbn/sub/file"},
+		{"/etc/tbn", "/etc/tbn"},
+		{"rel/~/x", "rel/~/x"},
+		{"~other/x", "~other/x"},
+		{"", ""},
+	} {
+		got, err := ExpandHome(tc.path, mockOS)
+		assert.Nil(t, err)
+		assert.Equal(t, got, tc.want)
+	}
+}
+
+func TestExpandHomeUnset(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOME").Return("", false)
+
+	got, err := ExpandHome("~/x", mockOS)
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, `cannot expand "~/x": no value for $HOME in environment`)
+}
+
+func TestRenderExpandHome(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOME").Return("/home/tbn", true)
+
+	got, err := renderString(`{{expandHome "~/.tbn"}}`, WithOS(mockOS))
+	assert.Nil(t, err)
+	assert.Equal(t, got, "/home/tbn/.tbn")
+}
+
+func TestRenderSwitch(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("STAGE").Return("prod", true)
+
+	got, err := renderString(`{{switch (env "STAGE") "dev" "1" "prod" "3" "2"}}`, WithOS(mockOS))
+	assert.Nil(t, err)
+	assert.Equal(t, got, "3")
+}
+
+func TestRenderRequired(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("DB_HOST").Return("", true)
+
+	got, err := renderString(
+		`host: {{envOrDefault "DB_HOST" "" | required "DB_HOST must name the database server"}}`,
+		WithOS(mockOS),
+	)
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "error calling required: DB_HOST must name the database server")
+}
+
+func TestRenderSplitJoin(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOSTS").Return("https://a/,https://b/", true)
+
+	got, err := renderString(
+		`{{$hosts := env "HOSTS" | split ","}}{{range $hosts}}{{if hasPrefix "https://" .}}{{. | trimPrefix "https://" | trimSuffix "/"}} {{end}}{{end}}{{join ";" $hosts}}`,
+		WithOS(mockOS),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "a b https://a/;https://b/")
+}
+
+func TestRenderURL(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("DATABASE_URL").Return("postgres://app:s%3Dcret@db:5432/app?sslmode=require", true).Times(2)
+
+	got, err := renderString(
+		`{{$db := urlParse (env "DATABASE_URL")}}{{$db.host}} {{$db.port}} {{$db.path | trimPrefix "/"}} {{queryGet $db.query "sslmode"}} {{(env "DATABASE_URL" | urlEncode | urlDecode | urlParse).password}}`,
+		WithOS(mockOS),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "db 5432 app require s=cret")
+}
+
+func TestRenderDefaultCoalesce(t *testing.T) {
+	got, err := renderString(
+		`{{.region | default "us-east-1"}} {{coalesce .host .fallback "localhost"}} {{.port | default 80}}`,
+		WithData(map[string]interface{}{"host": "", "fallback": "db", "port": 0}),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "us-east-1 db 0")
+}
+
+func TestRenderNindentToYAML(t *testing.T) {
+	got, err := renderString(
+		"spec:\n  ports:{{toYAML .ports | nindent 2}}\n",
+		WithData(map[string]interface{}{
+			"ports": []interface{}{
+				map[string]interface{}{"name": "http", "port": 80},
+				map[string]interface{}{"name": "admin", "port": 9000},
+			},
+		}),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "spec:\n  ports:\n  - name: http\n    port: 80\n  - name: admin\n    port: 9000\n")
+}
+
+func TestRenderPow(t *testing.T) {
+	mockOS, finish := mkMockOS(t)
+	defer finish()
+
+	got, err := renderString(`{{pow 2 10}}MB {{log2 1024}} {{log10 0.001}}`, WithOS(mockOS))
+	assert.Nil(t, err)
+	assert.Equal(t, got, "1024MB 10 -3")
+}
@@ -0,0 +1,615 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chunk splits list into consecutive groups of n elements. The final group
+// may contain fewer than n elements.
+func chunk(n int, list []string) ([][]string, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive, got %d", n)
+	}
+
+	chunks := make([][]string, 0, (len(list)+n-1)/n)
+	for len(list) > n {
+		chunks = append(chunks, list[:n:n])
+		list = list[n:]
+	}
+	if len(list) > 0 {
+		chunks = append(chunks, list)
+	}
+	return chunks, nil
+}
+
+// mustMinLen returns list unchanged if it has at least n elements, and
+// otherwise fails with message.
+func mustMinLen(n int, list []string, message string) ([]string, error) {
+	if len(list) < n {
+		return nil, fmt.Errorf("%s (need at least %d, got %d)", message, n, len(list))
+	}
+	return list, nil
+}
+
+// replace returns s with every occurrence of old replaced by new. The
+// argument order allows the subject to be piped in.
+func replace(old, new, s string) string {
+	return strings.Replace(s, old, new, -1)
+}
+
+// trimPrefix returns s without the leading prefix, if present. The argument
+// order allows the subject to be piped in, as for replace and the functions
+// below.
+func trimPrefix(prefix, s string) string {
+	return strings.TrimPrefix(s, prefix)
+}
+
+// trimSuffix returns s without the trailing suffix, if present.
+func trimSuffix(suffix, s string) string {
+	return strings.TrimSuffix(s, suffix)
+}
+
+// contains returns true if substr is within s.
+func contains(substr, s string) bool {
+	return strings.Contains(s, substr)
+}
+
+// hasPrefix returns true if s begins with prefix.
+func hasPrefix(prefix, s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// hasSuffix returns true if s ends with suffix.
+func hasSuffix(suffix, s string) bool {
+	return strings.HasSuffix(s, suffix)
+}
+
+// split slices s into the substrings separated by sep. The argument order
+// allows the subject to be piped in. Unlike strings.Split, an empty s
+// produces an empty list.
+func split(sep, s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, sep)
+}
+
+// join concatenates the elements of list, which may be a list of any type,
+// separated by sep. Elements that are not strings are formatted as by print.
+func join(sep string, list interface{}) (string, error) {
+	if strs, ok := list.([]string); ok {
+		return strings.Join(strs, sep), nil
+	}
+
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join requires a list, got %T", list)
+	}
+	strs := make([]string, v.Len())
+	for i := range strs {
+		strs[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(strs, sep), nil
+}
+
+// isEmpty returns true if v is nil, an empty string, or an empty list or
+// map. Zero numbers and false are not empty.
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	}
+	return false
+}
+
+// defaultValue returns def if v is empty, as defined by isEmpty, and v
+// otherwise.
+func defaultValue(def, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+// coalesce returns the first of values that is not empty, as defined by
+// isEmpty, or nil if all are empty.
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// required returns v unchanged unless it is empty, as defined by isEmpty, in
+// which case it fails with message.
+func required(message string, v interface{}) (interface{}, error) {
+	if isEmpty(v) {
+		return nil, fmt.Errorf("%s", message)
+	}
+	return v, nil
+}
+
+const baseDigits = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+func checkBase(base int) error {
+	if base < 2 || base > len(baseDigits) {
+		return fmt.Errorf("base must be between 2 and %d, got %d", len(baseDigits), base)
+	}
+	return nil
+}
+
+// baseEncode returns the representation of n in the given base, between 2
+// and 62. Digits beyond 9 are the lower case letters followed by the upper
+// case letters, so that bases up to 36 match strconv.FormatInt.
+func baseEncode(n, base int) (string, error) {
+	if err := checkBase(base); err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "0", nil
+	}
+
+	// work with negative values so that the minimum int can be encoded
+	neg := n < 0
+	if !neg {
+		n = -n
+	}
+
+	var buf []byte
+	for n != 0 {
+		buf = append(buf, baseDigits[-(n%base)])
+		n /= base
+	}
+	if neg {
+		buf = append(buf, '-')
+	}
+
+	for i, j := 0, len(buf)-1; i < j; i, j = i+1, j-1 {
+		buf[i], buf[j] = buf[j], buf[i]
+	}
+	return string(buf), nil
+}
+
+// baseDecode is the inverse of baseEncode.
+func baseDecode(s string, base int) (int, error) {
+	if err := checkBase(base); err != nil {
+		return 0, err
+	}
+
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" {
+		return 0, fmt.Errorf("invalid base %d number %q", base, s)
+	}
+
+	// accumulate negatively so that the minimum int can be decoded
+	const minInt = -int(^uint(0)>>1) - 1
+	n := 0
+	for i := 0; i < len(digits); i++ {
+		d := strings.IndexByte(baseDigits[:base], digits[i])
+		if d < 0 {
+			return 0, fmt.Errorf("invalid base %d number %q", base, s)
+		}
+		if n < (minInt+d)/base {
+			return 0, fmt.Errorf("base %d number %q is out of range", base, s)
+		}
+		n = n*base - d
+	}
+
+	if len(digits) == len(s) {
+		if n == minInt {
+			return 0, fmt.Errorf("base %d number %q is out of range", base, s)
+		}
+		n = -n
+	}
+	return n, nil
+}
+
+// countLines returns the number of lines in s. A final line without a
+// trailing newline is counted.
+func countLines(s string) int {
+	n := strings.Count(s, "\n")
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		n++
+	}
+	return n
+}
+
+// countWords returns the number of whitespace-separated words in s.
+func countWords(s string) int {
+	return len(strings.Fields(s))
+}
+
+// countBytes returns the length of s in bytes.
+func countBytes(s string) int {
+	return len(s)
+}
+
+// fileCounter returns a function that applies count to the contents of a
+// named file. The filename is first passed to expand.
+func fileCounter(
+	expand func(string) (string, error),
+	count func(string) int,
+) func(string) (int, error) {
+	return func(filename string) (int, error) {
+		filename, err := expand(filename)
+		if err != nil {
+			return 0, err
+		}
+		contents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return 0, err
+		}
+		return count(string(contents)), nil
+	}
+}
+
+// pgURL returns a PostgreSQL connection URL. The credentials and database
+// name are escaped as necessary.
+func pgURL(user, password, host, port, db string) string {
+	u := &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(user, password),
+		Host:   net.JoinHostPort(host, port),
+	}
+	if db != "" {
+		u.Path = "/" + db
+	}
+	return u.String()
+}
+
+// mysqlDSN returns a DSN in the format used by the Go MySQL driver. The
+// driver splits credentials at the last '@' and does not unescape them, so
+// the password is included verbatim and may contain any character. The user
+// name may not contain ':'.
+func mysqlDSN(user, password, host, port, db string) (string, error) {
+	if strings.Contains(user, ":") {
+		return "", fmt.Errorf("mysql user name may not contain ':': %q", user)
+	}
+	return fmt.Sprintf("%s:%s@tcp(%s)/%s", user, password, net.JoinHostPort(host, port), db), nil
+}
+
+// durationBetween parses start and end using layout, as described by
+// time.Parse, and returns the duration from start to end.
+func durationBetween(layout, start, end string) (string, error) {
+	from, err := time.Parse(layout, start)
+	if err != nil {
+		return "", err
+	}
+	to, err := time.Parse(layout, end)
+	if err != nil {
+		return "", err
+	}
+	return to.Sub(from).String(), nil
+}
+
+// date formats t using layout, as described by time.Time.Format. The
+// argument order allows the time to be piped in.
+func date(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// unixEpoch returns t as the number of seconds since the Unix epoch.
+func unixEpoch(t time.Time) int64 {
+	return t.Unix()
+}
+
+// dateModify returns t offset by duration, such as "720h" or "-90m", as
+// parsed by time.ParseDuration.
+func dateModify(duration string, t time.Time) (time.Time, error) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dateModify: %s", err)
+	}
+	return t.Add(d), nil
+}
+
+// fence wraps s in a Markdown fenced code block tagged with lang. The fence
+// is made longer than any run of backticks in s, so that s cannot close it.
+func fence(lang, s string) string {
+	longest, run := 0, 0
+	for _, c := range s {
+		if c == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+
+	n := 3
+	if longest >= n {
+		n = longest + 1
+	}
+	f := strings.Repeat("`", n)
+
+	if s != "" && !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	return f + lang + "\n" + s + f
+}
+
+// indent returns s with each line prefixed by n spaces. Empty lines are left
+// empty, so that no trailing whitespace is introduced.
+func indent(n int, s string) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("indent must not be negative, got %d", n)
+	}
+
+	pad := strings.Repeat(" ", n)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// nindent returns s indented as for indent, preceded by a newline, so that
+// it may begin on the line following a mapping key.
+func nindent(n int, s string) (string, error) {
+	s, err := indent(n, s)
+	if err != nil {
+		return "", err
+	}
+	return "\n" + s, nil
+}
+
+// switchValue returns the value paired with key in cases, which consists of
+// alternating keys and values followed by a default value. The default is
+// returned if key matches none of the keys.
+func switchValue(key string, cases ...string) (string, error) {
+	if len(cases)%2 == 0 {
+		return "", fmt.Errorf(
+			"switch requires key/value pairs followed by a default, got %d arguments after the key",
+			len(cases),
+		)
+	}
+
+	for i := 0; i < len(cases)-1; i += 2 {
+		if cases[i] == key {
+			return cases[i+1], nil
+		}
+	}
+	return cases[len(cases)-1], nil
+}
+
+// pow returns base raised to the power exp. It fails if the result is not a
+// finite real number.
+func pow(base, exp float64) (float64, error) {
+	result := math.Pow(base, exp)
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, fmt.Errorf("pow %v %v is not a finite real number", base, exp)
+	}
+	return result, nil
+}
+
+// logFunc returns a function that applies log to positive values and fails
+// otherwise.
+func logFunc(name string, log func(float64) float64) func(float64) (float64, error) {
+	return func(n float64) (float64, error) {
+		if !(n > 0) || math.IsInf(n, 1) {
+			return 0, fmt.Errorf("%s requires a positive finite argument, got %v", name, n)
+		}
+		return log(n), nil
+	}
+}
+
+// goString returns s as a double-quoted Go string literal.
+func goString(s string) string {
+	return strconv.Quote(s)
+}
+
+// cString returns s as a double-quoted C string literal. Control characters
+// and bytes outside of printable ASCII, including those of multi-byte UTF-8
+// sequences, are written as octal escapes, which unlike hexadecimal escapes
+// cannot absorb a following character.
+func cString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\a':
+			b.WriteString(`\a`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\v':
+			b.WriteString(`\v`)
+		case '?':
+			// avoid forming trigraphs such as ??=
+			if i > 0 && s[i-1] == '?' {
+				b.WriteString(`\?`)
+			} else {
+				b.WriteByte(c)
+			}
+		default:
+			if c < 0x20 || c >= 0x7f {
+				fmt.Fprintf(&b, "\\%03o", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// inCanary reports whether key falls within a deterministic subset
+// containing roughly pct percent of all keys. The same key and pct always
+// produce the same result, and a key included at a given pct is included at
+// every larger pct.
+func inCanary(key string, pct int) (bool, error) {
+	if pct < 0 || pct > 100 {
+		return false, fmt.Errorf("inCanary percentage must be between 0 and 100, got %d", pct)
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32()%100) < pct, nil
+}
+
+// queryGet returns the first value of key in the URL query string query, or
+// the empty string if key is not present.
+func queryGet(query, key string) (string, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("queryGet: invalid query string: %s", err)
+	}
+	return values.Get(key), nil
+}
+
+// queryKeys returns the sorted keys of the URL query string query.
+func queryKeys(query string) ([]string, error) {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("queryKeys: invalid query string: %s", err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// urlDecode decodes s as an encoded URL query component, in which "+"
+// represents a space.
+func urlDecode(s string) (string, error) {
+	decoded, err := url.QueryUnescape(s)
+	if err != nil {
+		return "", fmt.Errorf("urlDecode: %s", err)
+	}
+	return decoded, nil
+}
+
+// urlParse splits rawURL into its components, keyed by scheme, user,
+// password, host, port, path, query, and fragment. The user, password, and
+// path are decoded, and the brackets around an IPv6 host are removed.
+// Components absent from rawURL are empty.
+func urlParse(rawURL string) (map[string]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("urlParse: %s", err)
+	}
+
+	password, _ := u.User.Password()
+	return map[string]string{
+		"scheme":   u.Scheme,
+		"user":     u.User.Username(),
+		"password": password,
+		"host":     u.Hostname(),
+		"port":     u.Port(),
+		"path":     u.Path,
+		"query":    u.RawQuery,
+		"fragment": u.Fragment,
+	}, nil
+}
+
+// joinWrap joins list with sep, surrounded by prefix and suffix. An empty
+// list produces the empty string, without the prefix or suffix.
+func joinWrap(prefix, sep, suffix string, list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return prefix + strings.Join(list, sep) + suffix
+}
+
+// naturalSort returns a sorted copy of list in which runs of digits are
+// compared numerically, so that "item2" sorts before "item10".
+func naturalSort(list []string) []string {
+	sorted := append([]string{}, list...)
+	sort.Slice(sorted, func(i, j int) bool { return naturalLess(sorted[i], sorted[j]) })
+	return sorted
+}
+
+// naturalLess reports whether a sorts before b in natural order. Strings
+// that compare equal numerically, such as "a01" and "a1", are ordered
+// lexically.
+func naturalLess(a, b string) bool {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !isDigit(a[i]) || !isDigit(b[j]) {
+			if a[i] != b[j] {
+				return a[i] < b[j]
+			}
+			i++
+			j++
+			continue
+		}
+
+		endA, endB := digitsEnd(a, i), digitsEnd(b, j)
+		numA := strings.TrimLeft(a[i:endA], "0")
+		numB := strings.TrimLeft(b[j:endB], "0")
+		if len(numA) != len(numB) {
+			return len(numA) < len(numB)
+		}
+		if numA != numB {
+			return numA < numB
+		}
+		i, j = endA, endB
+	}
+
+	if i == len(a) && j == len(b) {
+		return a < b
+	}
+	return i == len(a)
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// digitsEnd returns the index of the first non-digit in s at or after i.
+func digitsEnd(s string, i int) int {
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestHashes(t *testing.T) {
+	assert.Equal(t, md5sum(""), "d41d8cd98f00b204e9800998ecf8427e")
+	assert.Equal(t, md5sum("abc"), "900150983cd24fb0d6963f7d28e17f72")
+	assert.Equal(t, sha1sum(""), "da39a3ee5e6b4b0d3255bfef95601890afd80709")
+	assert.Equal(t, sha1sum("abc"), "a9993e364706816aba3e25717850c26c9cd0d89d")
+	assert.Equal(t, sha256sum(""), "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
+	assert.Equal(t, sha256sum("abc"), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad")
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// toJSON returns v encoded as compact JSON. Unlike json.Marshal, '<', '>' and
+// '&' are not escaped, since the output is rarely destined for HTML. Values
+// decoded from YAML are accepted.
+func toJSON(v interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(NormalizeYAML(v)); err != nil {
+		return "", fmt.Errorf("toJSON: %s", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// fromJSON decodes s as JSON. Objects are returned as
+// map[string]interface{} and arrays as []interface{}, so the result may be
+// used with index and range.
+func fromJSON(s string) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("fromJSON: %s", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestToJSON(t *testing.T) {
+	for _, tc := range []struct {
+		v    interface{}
+		want string
+	}{
+		{"a \"b\" <c> & d\n", `"a \"b\" <c> & d\n"`},
+		{42, "42"},
+		{nil, "null"},
+		{[]string{"a", "b"}, `["a","b"]`},
+		{map[string]interface{}{"b": 1, "a": true}, `{"a":true,"b":1}`},
+		{
+			map[interface{}]interface{}{"a": []interface{}{map[interface{}]interface{}{1: "x"}}},
+			`{"a":[{"1":"x"}]}`,
+		},
+	} {
+		got, err := toJSON(tc.v)
+		assert.Nil(t, err)
+		assert.Equal(t, got, tc.want)
+	}
+}
+
+func TestToJSONError(t *testing.T) {
+	got, err := toJSON(func() {})
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "toJSON:")
+}
+
+func TestFromJSON(t *testing.T) {
+	got, err := fromJSON(`{"a": {"b": [1, "x"]}, "c": null}`)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{1.0, "x"}},
+		"c": nil,
+	})
+
+	got, err = fromJSON(`"s"`)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "s")
+}
+
+func TestFromJSONError(t *testing.T) {
+	got, err := fromJSON(`{"a":`)
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "fromJSON:")
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	got, err := renderString(
+		`{{$m := fromJSON .}}{{index $m "host"}} {{range $m.ports}}{{.}},{{end}} {{toJSON $m}}`,
+		WithData(`{"host": "web", "ports": [80, 443]}`),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, `web 80,443, {"host":"web","ports":[80,443]}`)
+}
+
+func TestNormalizeYAML(t *testing.T) {
+	got := NormalizeYAML(map[interface{}]interface{}{
+		"a": []interface{}{map[interface{}]interface{}{1: "x"}},
+		"b": 2,
+	})
+	assert.DeepEqual(t, got, map[string]interface{}{
+		"a": []interface{}{map[string]interface{}{"1": "x"}},
+		"b": 2,
+	})
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// shellSafe matches values that need no quoting in a POSIX shell.
+var shellSafe = regexp.MustCompile(`^[A-Za-z0-9@%+=:,./_-]+$`)
+
+// quoteString formats v as a string for quoting. A nil value, such as a
+// missing key in the template data, is the empty string.
+func quoteString(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// quote returns v as a double-quoted JSON string, which is also a valid YAML
+// double-quoted scalar. Invalid UTF-8 is replaced with U+FFFD.
+func quote(v interface{}) string {
+	s, _ := toJSON(quoteString(v))
+	return s
+}
+
+// squote returns v in single quotes, doubling any single quotes within it,
+// as in YAML and SQL.
+func squote(v interface{}) string {
+	return "'" + strings.Replace(quoteString(v), "'", "''", -1) + "'"
+}
+
+// shellQuote returns v quoted as a single word for a POSIX shell. Values
+// consisting only of characters that are never special are returned
+// unchanged. Others are single-quoted, with each single quote within them
+// written as a closing quote, an escaped quote, and an opening quote.
+func shellQuote(v interface{}) string {
+	s := quoteString(v)
+	if shellSafe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
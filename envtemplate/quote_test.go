@@ -0,0 +1,59 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, quote(""), `""`)
+	assert.Equal(t, quote(nil), `""`)
+	assert.Equal(t, quote(8080), `"8080"`)
+	assert.Equal(t, quote(`say "hi" <b>`), `"say \"hi\" <b>"`)
+	assert.Equal(t, quote(`C:\dir`), `"C:\\dir"`)
+	assert.Equal(t, quote("a\tb\n\x01"), `"a\tb\n\u0001"`)
+	assert.Equal(t, quote("café"), `"café"`)
+}
+
+func TestSquote(t *testing.T) {
+	assert.Equal(t, squote(""), `''`)
+	assert.Equal(t, squote(nil), `''`)
+	assert.Equal(t, squote(true), `'true'`)
+	assert.Equal(t, squote(`it's "fine"`), `'it''s "fine"'`)
+}
+
+func TestShellQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                    `''`,
+		"simple":              `simple`,
+		"/opt/tbn/bin-1.2":    `/opt/tbn/bin-1.2`,
+		"user@host:8080,a=b%": `user@host:8080,a=b%`,
+		"two words":           `'two words'`,
+		"$HOME":               `'$HOME'`,
+		"it's":                `'it'\''s'`,
+		"a;rm -rf /":          `'a;rm -rf /'`,
+		"`id`\n":              "'`id`\n'",
+		"*":                   `'*'`,
+	} {
+		assert.Equal(t, shellQuote(in), want)
+	}
+	assert.Equal(t, shellQuote(nil), `''`)
+	assert.Equal(t, shellQuote(42), `42`)
+}
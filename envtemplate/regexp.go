@@ -0,0 +1,42 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// regexMatch returns true if s contains a match of the regular expression
+// pattern. Use ^ and $ to match the whole value.
+func regexMatch(pattern, s string) (bool, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("regexMatch: %s", err)
+	}
+	return re.MatchString(s), nil
+}
+
+// regexReplaceAll returns s with every match of the regular expression
+// pattern replaced by repl, in which $1 or ${name} refer to submatches.
+func regexReplaceAll(pattern, repl, s string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("regexReplaceAll: %s", err)
+	}
+	return re.ReplaceAllString(s, repl), nil
+}
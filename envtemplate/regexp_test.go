@@ -0,0 +1,61 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestRegexMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		want       bool
+	}{
+		{`^v[0-9]+\.[0-9]+\.[0-9]+$`, "v1.2.3", true},
+		{`^v[0-9]+\.[0-9]+\.[0-9]+$`, "v1.2.3-rc1", false},
+		{`-rc[0-9]+$`, "v1.2.3-rc1", true},
+		{``, "anything", true},
+	} {
+		got, err := regexMatch(tc.pattern, tc.s)
+		assert.Nil(t, err)
+		assert.Equal(t, got, tc.want)
+	}
+
+	got, err := regexMatch(`(`, "a")
+	assert.False(t, got)
+	assert.ErrorContains(t, err, "regexMatch: error parsing regexp")
+}
+
+func TestRegexReplaceAll(t *testing.T) {
+	got, err := regexReplaceAll(`[^a-z0-9]+`, "-", "Web_Server.1")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "-eb-erver-1")
+
+	got, err = regexReplaceAll(`^([^:]+):(.*)$`, "${1}@$2", "nginx:1.15")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "nginx@1.15")
+
+	got, err = regexReplaceAll(`(?P<host>[a-z]+)\.example\.com`, "$host.internal", "db.example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "db.internal")
+
+	got, err = regexReplaceAll(`[`, "", "a")
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "regexReplaceAll: error parsing regexp")
+}
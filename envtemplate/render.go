@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"text/template"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+// An Option configures Render.
+type Option func(*options)
+
+type options struct {
+	os         tbnos.OS
+	vars       map[string]string
+	funcs      template.FuncMap
+	data       interface{}
+	leftDelim  string
+	rightDelim string
+}
+
+// WithOS specifies the OS from which environment variables are read. By
+// default, the environment of the current process is used.
+func WithOS(os tbnos.OS) Option {
+	return func(o *options) { o.os = os }
+}
+
+// WithVars specifies variables that are made available to the template as
+// functions returning their values. Variable names may not conflict with
+// the names of template functions.
+func WithVars(vars map[string]string) Option {
+	return func(o *options) { o.vars = vars }
+}
+
+// WithFuncs specifies additional template functions. They take precedence
+// over predefined functions of the same name.
+func WithFuncs(funcs template.FuncMap) Option {
+	return func(o *options) { o.funcs = funcs }
+}
+
+// WithData specifies the data object passed to the template, referenced as
+// {{.}}.
+func WithData(data interface{}) Option {
+	return func(o *options) { o.data = data }
+}
+
+// WithDelims specifies the template action delimiters. Empty delimiters
+// select the defaults, "{{" and "}}".
+func WithDelims(left, right string) Option {
+	return func(o *options) { o.leftDelim, o.rightDelim = left, right }
+}
+
+// Render reads a template from in, executes it with the predefined
+// functions, as returned by Funcs, and writes the result to out. Nothing is
+// written to out if the template cannot be parsed or executed.
+func Render(in io.Reader, out io.Writer, opts ...Option) error {
+	o := options{os: tbnos.New()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	funcs := Funcs(o.os)
+	for name, fn := range o.funcs {
+		funcs[name] = fn
+	}
+	if err := AddVars(funcs, o.vars); err != nil {
+		return err
+	}
+
+	tmpl, err := template.New("").Delims(o.leftDelim, o.rightDelim).Funcs(funcs).Parse(string(src))
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, o.data); err != nil {
+		return err
+	}
+	_, err = buf.WriteTo(out)
+	return err
+}
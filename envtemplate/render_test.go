@@ -0,0 +1,93 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"text/template"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestRenderDefaultOS(t *testing.T) {
+	os.Setenv("ENVTEMPLATE_TEST_RENDER", "value")
+	defer os.Unsetenv("ENVTEMPLATE_TEST_RENDER")
+
+	got, err := renderString(`{{env "ENVTEMPLATE_TEST_RENDER"}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "value")
+}
+
+func TestRenderWithData(t *testing.T) {
+	got, err := renderString(
+		`{{.name}}:{{range .ports}} {{.}}{{end}}`,
+		WithData(map[string]interface{}{"name": "web", "ports": []int{80, 443}}),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "web: 80 443")
+}
+
+func TestRenderWithDelims(t *testing.T) {
+	got, err := renderString(
+		`[[foo]] {{foo}}`,
+		WithDelims("[[", "]]"),
+		WithVars(map[string]string{"foo": "bar"}),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "bar {{foo}}")
+}
+
+func TestRenderWithFuncs(t *testing.T) {
+	got, err := renderString(
+		`{{greet "world"}} {{toUpper "x"}}`,
+		WithFuncs(template.FuncMap{
+			"greet":   func(s string) string { return "hello, " + s },
+			"toUpper": func(s string) string { return "overridden" },
+		}),
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hello, world overridden")
+}
+
+func TestRenderWithVarsConflict(t *testing.T) {
+	got, err := renderString(`{{env}}`, WithVars(map[string]string{"env": "x"}))
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, `"env" cannot be used as a variable name`)
+}
+
+func TestRenderExecutionErrorWritesNothing(t *testing.T) {
+	got, err := renderString(
+		`partial {{fail}}`,
+		WithFuncs(template.FuncMap{"fail": func() (string, error) { return "", errors.New("boom") }}),
+	)
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "boom")
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("read failed") }
+
+func TestRenderReadError(t *testing.T) {
+	out := &bytes.Buffer{}
+	err := Render(failingReader{}, out)
+	assert.ErrorContains(t, err, "read failed")
+	assert.Equal(t, out.String(), "")
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the maximum number of names suggested for a misspelled
+// environment variable.
+const maxSuggestions = 3
+
+// levenshtein returns the edit distance between a and b: the minimum number
+// of single-byte insertions, deletions, and substitutions that transform a
+// into b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// suggestNames returns the names in environ, a list of KEY=value pairs,
+// that are close to key, ordered from closest to farthest. Names are
+// compared case-insensitively, and are considered close if they are within
+// an edit distance of a third of the length of key, or of 1 for short keys.
+// A name at an edit distance of the length of key or more, which need share
+// nothing with it, is never close.
+func suggestNames(key string, environ []string) []string {
+	maxDistance := len(key) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	if maxDistance >= len(key) {
+		maxDistance = len(key) - 1
+	}
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+
+	upperKey := strings.ToUpper(key)
+	candidates := []candidate{}
+	seen := map[string]bool{}
+	for _, kv := range environ {
+		name := kv
+		if i := strings.Index(kv, "="); i >= 0 {
+			name = kv[:i]
+		}
+		if name == "" || name == key || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if d := levenshtein(upperKey, strings.ToUpper(name)); d <= maxDistance {
+			candidates = append(candidates, candidate{name, d})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	if len(candidates) > maxSuggestions {
+		candidates = candidates[:maxSuggestions]
+	}
+
+	names := make([]string, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.name
+	}
+	return names
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, levenshtein("", ""), 0)
+	assert.Equal(t, levenshtein("abc", ""), 3)
+	assert.Equal(t, levenshtein("", "abc"), 3)
+	assert.Equal(t, levenshtein("DB_HOST", "DB_HOST"), 0)
+	assert.Equal(t, levenshtein("DB_HST", "DB_HOST"), 1)
+	assert.Equal(t, levenshtein("DB_HOTS", "DB_HOST"), 2)
+	assert.Equal(t, levenshtein("kitten", "sitting"), 3)
+}
+
+func TestSuggestNames(t *testing.T) {
+	environ := []string{
+		"DB_HOST=localhost",
+		"DB_PORT=5432",
+		"DB_HOSTS=a,b",
+		"HOME=/home/tbn",
+		"=C:=C:\\",
+		"db_hst=lower",
+	}
+
+	assert.DeepEqual(t, suggestNames("DB_HST", environ), []string{"db_hst", "DB_HOST", "DB_HOSTS"})
+	assert.DeepEqual(t, suggestNames("DB_PROT", environ), []string{"DB_PORT"})
+	assert.DeepEqual(t, suggestNames("HOEM", environ), []string{})
+	assert.DeepEqual(t, suggestNames("HOM", environ), []string{"HOME"})
+	assert.DeepEqual(t, suggestNames("UNRELATED", environ), []string{})
+	assert.DeepEqual(t, suggestNames("DB_HOST", nil), []string{})
+}
+
+func TestSuggestNamesShortKey(t *testing.T) {
+	environ := []string{"_=/usr/bin/env", "Y=1", "x=2", "AC=3"}
+	assert.DeepEqual(t, suggestNames("X", environ), []string{"x"})
+	assert.DeepEqual(t, suggestNames("Z", environ), []string{})
+	assert.DeepEqual(t, suggestNames("AB", environ), []string{"AC"})
+	assert.DeepEqual(t, suggestNames("", environ), []string{})
+}
+
+func TestSuggestNamesLimit(t *testing.T) {
+	environ := []string{"KEY_A=", "KEY_B=", "KEY_C=", "KEY_D="}
+	assert.DeepEqual(t, suggestNames("KEY_", environ), []string{"KEY_A", "KEY_B", "KEY_C"})
+}
@@ -0,0 +1,280 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	// plain scalars that YAML 1.1 resolves to booleans or null
+	yamlReserved = map[string]bool{
+		"":      true,
+		"~":     true,
+		"null":  true,
+		"true":  true,
+		"false": true,
+		"yes":   true,
+		"no":    true,
+		"on":    true,
+		"off":   true,
+		"y":     true,
+		"n":     true,
+	}
+
+	// plain scalars that YAML 1.1 resolves to numbers or timestamps
+	yamlNonString = regexp.MustCompile(strings.Join([]string{
+		`^[-+]?(\.[0-9]+|[0-9][0-9_]*(\.[0-9_]*)?)([eE][-+]?[0-9]+)?$`,
+		`^[-+]?0x[0-9a-fA-F_]+$`,
+		`^[-+]?0b[01_]+$`,
+		`^[-+]?0o?[0-7_]+$`,
+		`^[-+]?[0-9][0-9_]*(:[0-5]?[0-9])+(\.[0-9_]*)?$`,
+		`^[-+]?\.(inf|Inf|INF)$`,
+		`^\.(nan|NaN|NAN)$`,
+		`^[0-9]{4}-[0-9]{1,2}-[0-9]{1,2}`,
+	}, "|"))
+)
+
+// yamlIndicators are characters that may not begin a plain YAML scalar.
+const yamlIndicators = "-?:,[]{}#&*!|>'\"%@`"
+
+// yamlValue returns s as a YAML scalar, quoting it only if it would
+// otherwise be read as something other than the string s.
+func yamlValue(s string) string {
+	if yamlNeedsQuotes(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func yamlNeedsQuotes(s string) bool {
+	switch {
+	case yamlReserved[strings.ToLower(s)]:
+		return true
+	case yamlNonString.MatchString(s):
+		return true
+	case strings.ContainsAny(s[:1], yamlIndicators):
+		return true
+	case s != strings.TrimSpace(s):
+		return true
+	case strings.Contains(s, ": "), strings.Contains(s, " #"), strings.HasSuffix(s, ":"):
+		return true
+	}
+
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// mapToYAML renders the entries of m, a map with string keys, as YAML
+// "key: value" lines sorted by key and indented by n spaces. String keys and
+// values are quoted only as required by yamlValue; numbers and booleans are
+// left unquoted so that they keep their type. Values must be scalars.
+func mapToYAML(m interface{}, n int) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("mapToYAML indent must not be negative, got %d", n)
+	}
+
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+		return "", fmt.Errorf("mapToYAML requires a map with string keys, got %T", m)
+	}
+
+	keys := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+
+	indent := strings.Repeat(" ", n)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value, err := yamlScalar(v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())))
+		if err != nil {
+			return "", fmt.Errorf("mapToYAML key %q: %s", key, err)
+		}
+		lines = append(lines, indent+yamlValue(key)+": "+value)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// yamlScalar returns v formatted as a YAML scalar.
+func yamlScalar(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "null", nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return yamlValue(v.String()), nil
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return fmt.Sprint(v.Interface()), nil
+	case reflect.Float32, reflect.Float64:
+		// without an exponent, so that numbers parsed from JSON, which are
+		// always floats, are written as given
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.Invalid:
+		return "null", nil
+	default:
+		return "", fmt.Errorf("value must be a scalar, got %s", v.Type())
+	}
+}
+
+// yamlBlock returns s as a YAML literal block scalar with each line indented
+// by n spaces, for use as the value of a mapping key. The chomping indicator
+// is chosen so that trailing newlines are preserved exactly. The result does
+// not end with a newline; the line break following it in the template ends
+// the final line. Values that cannot be represented as a block scalar
+// without an explicit indentation indicator, such as those beginning with a
+// space, values consisting only of newlines, and values that contain
+// non-printable characters are returned quoted.
+func yamlBlock(n int, s string) (string, error) {
+	if n < 1 {
+		return "", fmt.Errorf("yamlBlock indent must be positive, got %d", n)
+	}
+
+	body := strings.TrimSuffix(s, "\n")
+	if text := strings.TrimLeft(body, "\n"); strings.HasPrefix(text, " ") || (text == "" && s != "") {
+		return strconv.Quote(s), nil
+	}
+	for _, r := range body {
+		if r != '\n' && r != '\t' && !unicode.IsPrint(r) {
+			return strconv.Quote(s), nil
+		}
+	}
+
+	var header string
+	switch {
+	case !strings.HasSuffix(s, "\n"):
+		header = "|-"
+	case strings.HasSuffix(s, "\n\n"):
+		header = "|+"
+	default:
+		header = "|"
+	}
+	if s == "" {
+		return header, nil
+	}
+
+	indent := strings.Repeat(" ", n)
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return header + "\n" + strings.Join(lines, "\n"), nil
+}
+
+// GetPath returns the value at the dot-separated path within v, which may
+// be made up of maps and lists such as those produced by decoding JSON or
+// YAML. List elements are selected by index. An empty path selects v.
+func GetPath(v interface{}, path string) (interface{}, error) {
+	if path == "" {
+		return v, nil
+	}
+
+	for _, key := range strings.Split(path, ".") {
+		var ok bool
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v, ok = t[key]
+		case map[interface{}]interface{}:
+			v, ok = t[key]
+		case []interface{}:
+			if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(t) {
+				v, ok = t[i], true
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("no value at %q", path)
+		}
+	}
+	return v, nil
+}
+
+// NormalizeYAML converts the map[interface{}]interface{} values produced by
+// the YAML decoder into map[string]interface{}, so that decoded YAML behaves
+// the same as decoded JSON within templates.
+func NormalizeYAML(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[fmt.Sprint(k)] = NormalizeYAML(e)
+		}
+		return m
+
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, e := range t {
+			s[i] = NormalizeYAML(e)
+		}
+		return s
+
+	default:
+		return v
+	}
+}
+
+// toYAML returns v encoded as a block YAML document, without a trailing
+// newline. Map keys are sorted. Nested values are indented by two spaces
+// relative to their parent; use indent or nindent to place the result
+// within a larger document.
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("toYAML: %s", err)
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// fromYAML decodes s as YAML, resolving any aliases. Objects are returned as
+// map[string]interface{} and arrays as []interface{}, as for fromJSON.
+func fromYAML(s string) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("fromYAML: %s", err)
+	}
+	return NormalizeYAML(v), nil
+}
+
+// yamlGet decodes doc as YAML, resolving any aliases, and returns the value
+// at path, as described by GetPath.
+func yamlGet(path, doc string) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(doc), &v); err != nil {
+		return nil, err
+	}
+	return GetPath(v, path)
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package envtemplate
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestYAMLValueUnquoted(t *testing.T) {
+	for _, s := range []string{
+		"hello",
+		"hello world",
+		"web-1.example.com",
+		"/var/lib/tbn",
+		"a:b",
+		"http://example.com/x",
+		"x-y_z",
+		"truthy",
+		"1.2.3",
+		"v1",
+		"a#b",
+		"交通",
+	} {
+		assert.Equal(t, yamlValue(s), s)
+	}
+}
+
+func TestYAMLValueQuoted(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{"", `""`},
+		{"true", `"true"`},
+		{"False", `"False"`},
+		{"yes", `"yes"`},
+		{"OFF", `"OFF"`},
+		{"y", `"y"`},
+		{"null", `"null"`},
+		{"~", `"~"`},
+		{"123", `"123"`},
+		{"-1.5e3", `"-1.5e3"`},
+		{"0x1F", `"0x1F"`},
+		{"0755", `"0755"`},
+		{"1_000", `"1_000"`},
+		{"12:30", `"12:30"`},
+		{".inf", `".inf"`},
+		{".NaN", `".NaN"`},
+		{"2018-06-01", `"2018-06-01"`},
+		{"@user", `"@user"`},
+		{"*alias", `"*alias"`},
+		{"- item", `"- item"`},
+		{"{a}", `"{a}"`},
+		{"'quoted'", `"'quoted'"`},
+		{"%TAG", `"%TAG"`},
+		{"key: value", `"key: value"`},
+		{"key:", `"key:"`},
+		{"value # comment", `"value # comment"`},
+		{" padded", `" padded"`},
+		{"padded ", `"padded "`},
+		{"two\nlines", `"two\nlines"`},
+		{"tab\there", `"tab\there"`},
+		{`say "hi": ok`, `"say \"hi\": ok"`},
+	} {
+		assert.Equal(t, yamlValue(tc.s), tc.want)
+	}
+}
+
+func TestMapToYAML(t *testing.T) {
+	got, err := mapToYAML(map[string]string{
+		"port":  "8080",
+		"host":  "web.example.com",
+		"debug": "false",
+		"empty": "",
+	}, 2)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		got,
+		`  debug: "false"
+  empty: ""
+  host: web.example.com
+  port: "8080"`,
+	)
+}
+
+func TestMapToYAMLTypedValues(t *testing.T) {
+	got, err := mapToYAML(map[string]interface{}{
+		"b":    true,
+		"f":    1.5,
+		"i":    3,
+		"null": nil,
+		"s":    "yes",
+		"key:": "x",
+	}, 0)
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		got,
+		`b: true
+f: 1.5
+i: 3
+"key:": x
+"null": null
+s: "yes"`,
+	)
+}
+
+func TestMapToYAMLLargeNumbers(t *testing.T) {
+	got, err := mapToYAML(map[string]interface{}{"a": 1000000.0, "b": float32(2.5e7)}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "  a: 1000000\n  b: 25000000")
+}
+
+func TestMapToYAMLEmpty(t *testing.T) {
+	got, err := mapToYAML(map[string]string{}, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "")
+}
+
+func TestMapToYAMLErrors(t *testing.T) {
+	_, err := mapToYAML([]string{"a"}, 2)
+	assert.ErrorContains(t, err, "mapToYAML requires a map with string keys, got []string")
+
+	_, err = mapToYAML(map[int]string{1: "a"}, 2)
+	assert.ErrorContains(t, err, "mapToYAML requires a map with string keys")
+
+	_, err = mapToYAML(map[string]string{}, -1)
+	assert.ErrorContains(t, err, "mapToYAML indent must not be negative")
+
+	_, err = mapToYAML(map[string]interface{}{"a": []interface{}{1}}, 2)
+	assert.ErrorContains(t, err, `mapToYAML key "a": value must be a scalar, got []interface {}`)
+}
+
+func TestYAMLBlock(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want string
+	}{
+		{"a\nb\n", "|\n  a\n  b"},
+		{"a\nb", "|-\n  a\n  b"},
+		{"a\nb\n\n", "|+\n  a\n  b\n"},
+		{"a\n\n\tb\n", "|\n  a\n\n  \tb"},
+		{"\na\n", "|\n\n  a"},
+		{"", "|-"},
+		{"\n", `"\n"`},
+		{"\n\n", `"\n\n"`},
+		{" leading\n", `" leading\n"`},
+		{"\n  leading\n", `"\n  leading\n"`},
+		{"a\r\nb\r\n", `"a\r\nb\r\n"`},
+	} {
+		got, err := yamlBlock(2, tc.s)
+		assert.Nil(t, err)
+		assert.Equal(t, got, tc.want)
+	}
+}
+
+func TestYAMLBlockIndent(t *testing.T) {
+	got, err := yamlBlock(4, "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n")
+	assert.Nil(t, err)
+	assert.Equal(
+		t,
+		got,
+		"|\n    -----BEGIN CERTIFICATE-----\n    MIIB\n    -----END CERTIFICATE-----",
+	)
+
+	_, err = yamlBlock(0, "a")
+	assert.ErrorContains(t, err, "yamlBlock indent must be positive, got 0")
+}
+
+func TestGetPath(t *testing.T) {
+	v := map[string]interface{}{
+		"db": map[string]interface{}{
+			"hosts": []interface{}{"a", map[interface{}]interface{}{"name": "b"}},
+			"port":  5432,
+		},
+	}
+
+	for _, tc := range []struct {
+		path string
+		want interface{}
+	}{
+		{"db.port", 5432},
+		{"db.hosts.0", "a"},
+		{"db.hosts.1.name", "b"},
+	} {
+		got, err := GetPath(v, tc.path)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, got, tc.want)
+	}
+
+	got, err := GetPath(v, "")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, v)
+
+	for _, path := range []string{"missing", "db.port.x", "db.hosts.2", "db.hosts.-1", "db.hosts.x"} {
+		_, err := GetPath(v, path)
+		assert.ErrorContains(t, err, fmt.Sprintf("no value at %q", path))
+	}
+}
+
+func TestYAMLGetAliases(t *testing.T) {
+	doc := `
+defaults: &defaults
+  host: db.example.com
+  port: 5432
+primary: *defaults
+hosts:
+  - &first web-1
+  - *first
+`
+	got, err := yamlGet("primary.host", doc)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "db.example.com")
+
+	got, err = yamlGet("hosts.1", doc)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "web-1")
+
+	_, err = yamlGet("x", "a: [")
+	assert.NonNil(t, err)
+}
+
+func TestToYAML(t *testing.T) {
+	got, err := toYAML(map[string]interface{}{
+		"name":  "web",
+		"port":  8080,
+		"on":    "yes",
+		"hosts": []interface{}{"a", "b"},
+		"db":    map[string]interface{}{"host": "db"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, got, "db:\n  host: db\nhosts:\n- a\n- b\nname: web\n\"on\": \"yes\"\nport: 8080")
+
+	got, err = toYAML("s")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "s")
+}
+
+func TestFromYAML(t *testing.T) {
+	got, err := fromYAML("a:\n  b: [1, x]\n2: two\n")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, map[string]interface{}{
+		"a": map[string]interface{}{"b": []interface{}{1, "x"}},
+		"2": "two",
+	})
+
+	got, err = fromYAML("a: [")
+	assert.Nil(t, got)
+	assert.ErrorContains(t, err, "fromYAML:")
+}
+
+func TestToYAMLFromYAML(t *testing.T) {
+	doc := "db:\n  host: db\n  port: 5432\nhosts:\n- a\n- b"
+	v, err := fromYAML(doc)
+	assert.Nil(t, err)
+
+	got, err := toYAML(v)
+	assert.Nil(t, err)
+	assert.Equal(t, got, doc)
+}
@@ -18,9 +18,16 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/turbinelabs/cli/command"
@@ -132,6 +139,7 @@ func TestRunRequiredEnvMissing(t *testing.T) {
 	defer finish()
 
 	mockOS.EXPECT().LookupEnv("BAR").Return("", false)
+	mockOS.EXPECT().Environ().Return(nil)
 
 	c := cmd()
 	r := c.Runner.(*runner)
@@ -144,6 +152,21 @@ func TestRunRequiredEnvMissing(t *testing.T) {
 	assert.Equal(t, got, c.Error(`template: :1:5: executing "" at <env "BAR">: error calling env: no value for $BAR in environment`))
 }
 
+func TestRunRequiredEnvMissingSuggestion(t *testing.T) {
+	mockOS, finish := mkMockOs(t, `foo{{env "BAR_HOST"}}`, nil)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BAR_HOST").Return("", false)
+	mockOS.EXPECT().Environ().Return([]string{"BAR_HOSTS=a", "BAZ_HOST=b", "PATH=/bin"})
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.Error(`template: :1:5: executing "" at <env "BAR_HOST">: error calling env: no value for $BAR_HOST in environment; did you mean BAR_HOSTS or BAZ_HOST?`))
+}
+
 func TestRunRequiredEnv(t *testing.T) {
 	out := &bytes.Buffer{}
 	mockOS, finish := mkMockOs(t, `foo{{env "BAR"}}`, out)
@@ -305,6 +328,7 @@ func TestRunRequiredEnvSplitMissing(t *testing.T) {
 	defer finish()
 
 	mockOS.EXPECT().LookupEnv("BARS").Return("", false)
+	mockOS.EXPECT().Environ().Return(nil)
 
 	c := cmd()
 	r := c.Runner.(*runner)
@@ -316,3 +340,1414 @@ func TestRunRequiredEnvSplitMissing(t *testing.T) {
 	got := r.Run(c, nil)
 	assert.Equal(t, got, c.Error(`template: :1:10: executing "" at <envSplit "BARS" ":">: error calling envSplit: no value for $BARS in environment`))
 }
+
+func TestRunEnvOrDataEnvWins(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"BAR": "data"}`)
+	defer removeData()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `foo{{envOrData "BAR"}}`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BAR").Return("env", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", data})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "fooenv")
+}
+
+func TestRunEnvOrDataFallback(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.yaml", "BAR: data\n")
+	defer removeData()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `foo{{envOrData "BAR"}}`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BAR").Return("", false)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", data})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "foodata")
+}
+
+func TestRunEnvOrDataMissing(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"BAZ": "data"}`)
+	defer removeData()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `foo{{envOrData "BAR"}}`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BAR").Return("", false)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", data})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "foo")
+}
+
+func TestRunEnvOrDataMissingStrict(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"BAZ": "data"}`)
+	defer removeData()
+
+	mockOS, finish := mkMockOs(t, `foo{{envOrData "BAR"}}`, nil)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BAR").Return("", false)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", data, "-strict"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.Error(`template: :1:5: executing "" at <envOrData "BAR">: error calling envOrData: no value for $BAR in environment or data file`))
+}
+
+func TestRunDataFileAsData(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"bar": {"baz": "qux"}}`)
+	defer removeData()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `foo{{.bar.baz}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", data})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "fooqux")
+}
+
+func TestRunBadDataFile(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{`)
+	defer removeData()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-data-file", data})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(
+		t,
+		got,
+		c.BadInput(fmt.Sprintf("could not parse data file %s: unexpected end of JSON input", data)),
+	)
+}
+
+func TestExecuteWithinMaxRenderTime(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse("foo{{.}}"))
+
+	out, err := execute(tmpl, "bar", time.Minute, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, out.String(), "foobar")
+}
+
+func TestExecuteExceedsMaxRenderTime(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	slow := func() string {
+		<-release
+		return "slow"
+	}
+	tmpl := template.Must(
+		template.New("").Funcs(template.FuncMap{"slow": slow}).Parse("foo{{slow}}"),
+	)
+
+	out, err := execute(tmpl, nil, 10*time.Millisecond, 0)
+	assert.Nil(t, out)
+	assert.ErrorContains(t, err, "rendering exceeded max render time of 10ms")
+}
+
+func TestRunMaxRenderTime(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "foo{{bar}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "bar=baz", "-max-render-time", "1m"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "foobaz")
+}
+
+func testRunAllSet(t *testing.T, env map[string]string, want string) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{if allSet "A" "B" "C"}}all{{else}}some{{end}}`,
+		out,
+	)
+	defer finish()
+
+	for _, key := range []string{"A", "B", "C"} {
+		value, ok := env[key]
+		mockOS.EXPECT().LookupEnv(key).Return(value, ok)
+		if !ok || value == "" {
+			break
+		}
+	}
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), want)
+}
+
+func TestRunAllSet(t *testing.T) {
+	testRunAllSet(t, map[string]string{"A": "a", "B": "b", "C": "c"}, "all")
+}
+
+func TestRunAllSetPartial(t *testing.T) {
+	testRunAllSet(t, map[string]string{"A": "a", "C": "c"}, "some")
+}
+
+func TestRunAllSetEmptyValue(t *testing.T) {
+	testRunAllSet(t, map[string]string{"A": "a", "B": "", "C": "c"}, "some")
+}
+
+func TestRunAllSetNone(t *testing.T) {
+	testRunAllSet(t, map[string]string{}, "some")
+}
+
+func TestRunRegexQuote(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `^{{env "HOST" | regexQuote}}$`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOST").Return("a.b+c*[d](e)?{f}|g^h$i\\", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), `^a\.b\+c\*\[d\]\(e\)\?\{f\}\|g\^h\$i\\$`)
+	assert.True(t, regexp.MustCompile(out.String()).MatchString("a.b+c*[d](e)?{f}|g^h$i\\"))
+}
+
+func TestRunChunk(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{range chunk 2 (envSplit "HOSTS" ",")}}[{{range .}}{{.}}{{end}}]{{end}}`,
+		out,
+	)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOSTS").Return("a,b,c", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "[ab][c]")
+}
+
+func TestRunCountFuncs(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{$v := env "BODY"}}{{countLines $v}} {{countWords $v}} {{countBytes $v}}`,
+		out,
+	)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BODY").Return("héllo wörld\nbye\n", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "2 3 18")
+}
+
+func testRunSeqNext(t *testing.T, args []string, want string) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{range envSplit "A" ","}}{{seqNext "a"}}{{end}}-{{seqNext "b"}}-{{range envSplit "A" ","}}{{seqNext "a"}}{{end}}`,
+		out,
+	)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("A").Return("x,y,z", true).Times(2)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse(args)
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), want)
+}
+
+func TestRunSeqNext(t *testing.T) {
+	testRunSeqNext(t, nil, "012-0-345")
+}
+
+func TestRunSeqNextBase(t *testing.T) {
+	testRunSeqNext(t, []string{"-seq-base", "5"}, "567-5-8910")
+}
+
+func TestRunSeqNextResetPerRender(t *testing.T) {
+	c := cmd()
+	r := c.Runner.(*runner)
+
+	r.resetRenderState(nil, nil, "")
+	assert.Equal(t, r.seqNext("a"), 0)
+	assert.Equal(t, r.seqNext("a"), 1)
+
+	r.resetRenderState(nil, nil, "")
+	assert.Equal(t, r.seqNext("a"), 0)
+}
+
+func TestRunToolVersionAndSourceFileStdin(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{toolVersion}} {{sourceFile}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), TbnPublicVersion+" stdin")
+}
+
+func TestRunToolVersionAndSourceFile(t *testing.T) {
+	in, removeIn := tempfile.Write(t, "{{toolVersion}} {{sourceFile}}")
+	defer removeIn()
+	out, removeOut := tempfile.Make(t)
+	defer removeOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in, "-out", out})
+	assert.Nil(t, err)
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	gotOut, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, string(gotOut), TbnPublicVersion+" "+in)
+}
+
+func TestRunMustMinLen(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{range mustMinLen 2 (envSplit "SEEDS" ",") "need 2 seeds"}}[{{.}}]{{end}}`,
+		out,
+	)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("SEEDS").Return("a,b", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "[a][b]")
+}
+
+func TestRunMustMinLenUnsatisfied(t *testing.T) {
+	mockOS, finish := mkMockOs(
+		t,
+		`{{range mustMinLen 2 (envSplit "SEEDS" ",") "need 2 seeds"}}[{{.}}]{{end}}`,
+		nil,
+	)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("SEEDS").Return("a", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.Error(`template: :1:8: executing "" at <mustMinLen 2 (envSplit "SEEDS" ",") "need 2 seeds">: error calling mustMinLen: need 2 seeds (need at least 2, got 1)`))
+}
+
+func TestExecuteWithinMaxOutputSize(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse("foo{{.}}"))
+
+	out, err := execute(tmpl, "bar", 0, 6)
+	assert.Nil(t, err)
+	assert.Equal(t, out.String(), "foobar")
+}
+
+func TestExecuteExceedsMaxOutputSize(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse("foo{{.}}"))
+
+	_, err := execute(tmpl, "bar", 0, 5)
+	assert.ErrorContains(t, err, "rendered output exceeds max output size of 5 bytes")
+
+	_, err = execute(tmpl, "bar", time.Minute, 5)
+	assert.ErrorContains(t, err, "rendered output exceeds max output size of 5 bytes")
+}
+
+func TestRunExceedsMaxOutputSize(t *testing.T) {
+	in, removeIn := tempfile.Write(t, "{{range envSplit \"A\" \",\"}}0123456789{{end}}")
+	defer removeIn()
+	out, removeOut := tempfile.Write(t, "original")
+	defer removeOut()
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().LookupEnv("A").Return("a,b,c", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-max-output-size", "25"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.Error("rendered output exceeds max output size of 25 bytes"))
+
+	gotOut, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, string(gotOut), "original")
+}
+
+func TestRunPercentVerbatim(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "log_format %s %d %% {{bar}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "bar=a%2Fb"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "log_format %s %d %% a%2Fb")
+}
+
+func TestRunOnParseErrorWarn(t *testing.T) {
+	out := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "foo{{bar", out)
+	defer finish()
+
+	mockOS.EXPECT().Stderr().Return(stderr)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-on-parse-error", "warn"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "foo{{bar")
+	assert.True(t, strings.HasPrefix(stderr.String(), "warning: template: :1: "))
+	assert.True(t, strings.HasSuffix(stderr.String(), "; passing input through unchanged\n"))
+}
+
+func TestRunOnParseErrorWarnExecutionError(t *testing.T) {
+	mockOS, finish := mkMockOs(t, `foo{{env "BAR"}}`, nil)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BAR").Return("", false)
+	mockOS.EXPECT().Environ().Return(nil)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-on-parse-error", "warn"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.Error(`template: :1:5: executing "" at <env "BAR">: error calling env: no value for $BAR in environment`))
+}
+
+func TestRunBadOnParseError(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-on-parse-error", "ignore"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`invalid --on-parse-error value "ignore"`))
+}
+
+func TestRunPlatform(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{goos}}/{{goarch}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.goos = "plan9"
+	r.goarch = "mips"
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "plan9/mips")
+}
+
+func TestPlatformDefault(t *testing.T) {
+	r := cmd().Runner.(*runner)
+	assert.Equal(t, r.runtimeOS(), runtime.GOOS)
+	assert.Equal(t, r.runtimeArch(), runtime.GOARCH)
+}
+
+func TestRunVarsFile(t *testing.T) {
+	vars, removeVars := writeNamedTempFile(t, "vars.yaml", "foo: file\nbar: file\n")
+	defer removeVars()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "{{foo}} {{bar}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars-file", vars, "-vars", "bar=cli"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "file cli")
+}
+
+func TestRunVarsFileIllegalName(t *testing.T) {
+	vars, removeVars := writeNamedTempFile(t, "vars.json", `{"a-b": "c"}`)
+	defer removeVars()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-vars-file", vars})
+	assert.Nil(t, err)
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`Invalid template variable name: "a-b"`))
+}
+
+func TestRunVarsFilePredefFunc(t *testing.T) {
+	vars, removeVars := writeNamedTempFile(t, "vars.json", `{"envOrDefault": "c"}`)
+	defer removeVars()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-vars-file", vars})
+	assert.Nil(t, err)
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`"envOrDefault" cannot be used as a variable name`))
+}
+
+func TestRunBadVarsFile(t *testing.T) {
+	vars, removeVars := writeNamedTempFile(t, "vars.json", `{`)
+	defer removeVars()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-vars-file", vars})
+	assert.Nil(t, err)
+	got := c.Runner.Run(c, nil)
+	assert.Equal(
+		t,
+		got,
+		c.BadInput(fmt.Sprintf("could not parse vars file %s: unexpected end of JSON input", vars)),
+	)
+}
+
+func TestRunVarsPrefix(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "{{.CLI.foo}} {{foo}} {{index .CLI \"bar\"}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "foo=FOO,bar=BAR", "-vars-prefix", "CLI"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "FOO FOO BAR")
+}
+
+func TestRunVarsPrefixWithDataFile(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"foo": "data"}`)
+	defer removeData()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "{{.foo}} {{.CLI.foo}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", data, "-vars", "foo=cli", "-vars-prefix", "CLI"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "data cli")
+	_, ok := r.data["CLI"]
+	assert.False(t, ok)
+}
+
+func TestRunVarsPrefixConflict(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"CLI": "data"}`)
+	defer removeData()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-data-file", data, "-vars-prefix", "CLI"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`vars prefix "CLI" conflicts with a key in the data file`))
+}
+
+func TestRunVarsPrefixInvalid(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-vars-prefix", "a.b"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`Invalid vars prefix: "a.b"`))
+}
+
+func TestRunContext(t *testing.T) {
+	vars, removeVars := writeNamedTempFile(
+		t,
+		"vars.yaml",
+		"name: file\nport: 8080\nhosts:\n- a\n- b\ndb:\n  host: db\n",
+	)
+	defer removeVars()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		"{{.name}}:{{.port}} {{range .hosts}}{{.}},{{end}} {{.db.host}} {{.stage}}",
+		out,
+	)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-context", "-vars-file", vars, "-vars", "name=cli,stage=prod"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "cli:8080 a,b, db prod")
+}
+
+func TestRunContextJSONNumbers(t *testing.T) {
+	vars, removeVars := writeNamedTempFile(t, "vars.json", `{"n": 1000000, "big": 12345678901234567, "f": 0.5, "db": {"port": 5432}}`)
+	defer removeVars()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "{{.n}} {{.big}} {{.f}} {{.db.port}} {{eq .n 1000000}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-context", "-vars-file", vars})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "1000000 12345678901234567 0.5 5432 true")
+}
+
+func TestRunContextWithDataFile(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"db": {"host": "data", "port": 5432}, "foo": "data"}`)
+	defer removeData()
+
+	vars, removeVars := writeNamedTempFile(t, "vars.json", `{"db": {"host": "vars"}}`)
+	defer removeVars()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "{{.foo}} {{.db.host}}:{{.db.port}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-context", "-data-file", data, "-vars-file", vars})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "data vars:5432")
+}
+
+func TestRunContextVarsNotFunctions(t *testing.T) {
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.context = true
+	r.vars.Strings = []string{"foo=bar"}
+
+	funcs, err := r.mkFuncMap()
+	assert.Nil(t, err)
+	assert.Nil(t, funcs["foo"])
+}
+
+func TestRunContextWithVarsPrefix(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-context", "-vars-prefix", "CLI"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--context and --vars-prefix may not be combined"))
+}
+
+func TestRunNow(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{now | date "2006-01-02"}} {{now | dateModify "24h" | unixEpoch}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.now = func() time.Time { return time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC) }
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "2018-03-04 1520226367")
+}
+
+func testRunPreservesMode(t *testing.T, mode os.FileMode) {
+	in, removeIn := tempfile.Write(t, "foo{{bar}}")
+	defer removeIn()
+	assert.Nil(t, os.Chmod(in, mode))
+	out, removeOut := tempfile.Make(t)
+	defer removeOut()
+	assert.Nil(t, os.Chmod(out, 0644))
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-vars", "bar=baz"})
+	assert.Nil(t, err)
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	info, err := os.Stat(out)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), mode)
+}
+
+func TestRunPreservesSecretMode(t *testing.T) {
+	testRunPreservesMode(t, 0600)
+}
+
+func TestRunPreservesExecutableMode(t *testing.T) {
+	testRunPreservesMode(t, 0755)
+}
+
+func TestRunSameFilePreservesMode(t *testing.T) {
+	in, removeIn := tempfile.Write(t, "foo{{bar}}")
+	defer removeIn()
+	defer os.Remove(in + ".bak")
+	assert.Nil(t, os.Chmod(in, 0750))
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in, "-out", in, "-vars", "bar=baz"})
+	assert.Nil(t, err)
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	for _, f := range []string{in, in + ".bak"} {
+		info, err := os.Stat(f)
+		assert.Nil(t, err)
+		assert.Equal(t, info.Mode().Perm(), os.FileMode(0750))
+	}
+}
+
+func TestFileModeStdin(t *testing.T) {
+	r := cmd().Runner.(*runner)
+	assert.Equal(t, r.fileMode(), os.FileMode(0644))
+}
+
+func mkAgedFile(t *testing.T, now time.Time, age time.Duration) (string, func()) {
+	f, remove := tempfile.Write(t, "aged")
+	mtime := now.Add(-age)
+	assert.Nil(t, os.Chtimes(f, mtime, mtime))
+	return f, remove
+}
+
+func TestFileAge(t *testing.T) {
+	now := time.Now()
+	f, remove := mkAgedFile(t, now, 2*time.Hour+500*time.Millisecond)
+	defer remove()
+
+	r := cmd().Runner.(*runner)
+	r.now = func() time.Time { return now }
+
+	age, err := r.fileAge(f)
+	assert.Nil(t, err)
+	assert.Equal(t, age, int64(7200))
+
+	remove()
+	_, err = r.fileAge(f)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileAgeExpandHome(t *testing.T) {
+	now := time.Now()
+	f, remove := mkAgedFile(t, now, time.Minute)
+	defer remove()
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().LookupEnv("HOME").Return(filepath.Dir(f), true).Times(2)
+
+	r := cmd().Runner.(*runner)
+	r.os = mockOS
+	r.now = func() time.Time { return now }
+
+	age, err := r.fileAge("~/" + filepath.Base(f))
+	assert.Nil(t, err)
+	assert.Equal(t, age, int64(60))
+
+	older, err := r.fileOlderThan("~/"+filepath.Base(f), "30s")
+	assert.Nil(t, err)
+	assert.True(t, older)
+}
+
+func TestFileOlderThan(t *testing.T) {
+	now := time.Now()
+	f, remove := mkAgedFile(t, now, 2*time.Hour)
+	defer remove()
+
+	r := cmd().Runner.(*runner)
+	r.now = func() time.Time { return now }
+
+	older, err := r.fileOlderThan(f, "1h")
+	assert.Nil(t, err)
+	assert.True(t, older)
+
+	older, err = r.fileOlderThan(f, "3h")
+	assert.Nil(t, err)
+	assert.False(t, older)
+
+	_, err = r.fileOlderThan(f, "soon")
+	assert.ErrorContains(t, err, "invalid duration")
+}
+
+func TestFileOlderThanMissing(t *testing.T) {
+	f, remove := tempfile.Make(t)
+	remove()
+
+	r := cmd().Runner.(*runner)
+
+	older, err := r.fileOlderThan(f, "1h")
+	assert.Nil(t, err)
+	assert.False(t, older)
+
+	r.strict = true
+	_, err = r.fileOlderThan(f, "1h")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunFileAge(t *testing.T) {
+	now := time.Now()
+	f, remove := mkAgedFile(t, now, time.Minute)
+	defer remove()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{fileAge "`+f+`"}} {{fileOlderThan "`+f+`" "30s"}}`,
+		out,
+	)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.now = func() time.Time { return now }
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "60 true")
+}
+
+func TestRunDelims(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{not a template}} [[env "FOO"]] [[- bar -]] !`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("FOO").Return("foo", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-delims", "[[,]]", "-vars", "bar=baz"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "{{not a template}} foobaz!")
+}
+
+func TestRunLeftRightDelims(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{not a template}} <%env "FOO"%> <%- bar -%> !`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("FOO").Return("foo", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-left-delim", "<%", "-right-delim", "%>", "-vars", "bar=baz"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "{{not a template}} foobaz!")
+}
+
+func TestRunLeftDelimOnly(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{bar}} [[bar}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-left-delim", "[[", "-vars", "bar=baz"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "{{bar}} baz")
+}
+
+func TestRunDelimsWithLeftDelim(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-delims", "[[,]]", "-right-delim", "]]"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--delims may not be combined with --left-delim or --right-delim"))
+}
+
+func TestRunDelimsStrict(t *testing.T) {
+	mockOS, finish := mkMockOs(t, `{{ignored}} [[missing]]`, nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-delims", "[[,]]", "-strict"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("undefined template variables: missing"))
+}
+
+func TestRunBadDelims(t *testing.T) {
+	for _, delims := range []string{"[[", "[[,]],", ",]]", "[[,", ","} {
+		c := cmd()
+		err := c.Flags.Parse([]string{"-delims", delims})
+		assert.Nil(t, err)
+
+		got := c.Runner.Run(c, nil)
+		assert.Equal(
+			t,
+			got,
+			c.BadInputf("--delims must be two non-empty delimiters separated by a comma, got %q", delims),
+		)
+	}
+}
+
+func TestRunStrictDelims(t *testing.T) {
+	mockOS, finish := mkMockOs(t, "[[.A]]\n[[.B]\n", nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-delims", "[[,]]", "-strict-delims"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(
+		t,
+		got,
+		c.BadInput(`unbalanced delimiters: 2 left, 1 right; first unmatched "[[" on line 2`),
+	)
+}
+
+func TestRunStringFuncs(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{env "HOST" | trim | toLower}} {{toUpper "up"}} {{env "HOST" | trim | replace "." "-"}} {{env "EMPTY" | default "def"}} {{default "def" "set"}}`,
+		out,
+	)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOST").Return("  Web.Example.COM\n", true).Times(2)
+	mockOS.EXPECT().LookupEnv("EMPTY").Return("", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "web.example.com UP Web-Example-COM def set")
+}
+
+func TestRunStringFuncsPredef(t *testing.T) {
+	for _, name := range []string{"toUpper", "toLower", "trim", "replace", "default"} {
+		c := cmd()
+		err := c.Flags.Parse([]string{"-vars", name + "=x"})
+		assert.Nil(t, err)
+		got := c.Runner.Run(c, nil)
+		assert.Equal(t, got, c.BadInputf("%q cannot be used as a variable name", name))
+	}
+}
+
+func TestRunFailedRenderPreservesOutput(t *testing.T) {
+	in, removeIn := tempfile.Write(t, `{{env "MISSING"}}`)
+	defer removeIn()
+
+	out, removeOut := tempfile.Write(t, "original")
+	defer removeOut()
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().LookupEnv("MISSING").Return("", false)
+	mockOS.EXPECT().Environ().Return(nil)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-in", in, "-out", out})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.NonNil(t, got)
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+
+	contents, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "original")
+}
+
+func TestRunReplaceOutputKeepsMode(t *testing.T) {
+	out, removeOut := tempfile.Write(t, "original")
+	defer removeOut()
+	assert.Nil(t, os.Chmod(out, 0600))
+
+	mockOS, finish := mkMockOs(t, "foo{{bar}}", nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-out", out, "-vars", "bar=baz"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	contents, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), "foobaz")
+
+	info, err := os.Stat(out)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+}
+
+func TestRunBaseEncode(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{baseEncode 1234567890 62}} {{baseDecode "kf12oi" 36}} {{seqNext "a"}}{{baseEncode (seqNext "a") 2}}`,
+		out,
+	)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "1ly7vk 1234567890 01")
+}
+
+func TestRunOnlyChangedSingleFile(t *testing.T) {
+	out, removeOut := tempfile.Write(t, "foobaz")
+	defer removeOut()
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	assert.Nil(t, os.Chtimes(out, past, past))
+
+	// nothing is written to STDERR outside batch mode
+	mockOS, finish := mkMockOs(t, "foo{{bar}}", nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-out", out, "-only-changed", "-vars", "bar=baz"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	info, err := os.Stat(out)
+	assert.Nil(t, err)
+	assert.True(t, info.ModTime().Equal(past))
+}
+
+func TestRunPreservesLiteralBytes(t *testing.T) {
+	in := "\xef\xbb\xbfa=1\r\nb={{foo}}\r\n\r\n\x00\xff\xfe tail\r\n"
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, in, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "\xef\xbb\xbfa=1\r\nb=bar\r\n\r\n\x00\xff\xfe tail\r\n")
+}
+
+func TestRunStripBOM(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "\xef\xbb\xbfa={{foo}}\r\n\xef\xbb\xbf", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "foo=bar", "-strip-bom"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "a=bar\r\n\xef\xbb\xbf")
+}
+
+func TestRunStripBOMWithoutBOM(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "a={{foo}}\r\n", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "foo=bar", "-strip-bom"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "a=bar\r\n")
+}
+
+func TestRunLookupYAMLAliases(t *testing.T) {
+	data, removeData := writeNamedTempFile(
+		t,
+		"data.yaml",
+		"defaults: &defaults\n  hosts: [a, b]\nprod: *defaults\n",
+	)
+	defer removeData()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{lookup "prod.hosts.1"}} {{index (lookup "prod") "hosts"}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", data})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "b [a b]")
+}
+
+func TestRunLookupNoDataFile(t *testing.T) {
+	mockOS, finish := mkMockOs(t, `{{lookup "a"}}`, nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+	assert.StringContains(t, got.Message, "lookup requires --data-file")
+}
+
+func TestRunMergeDataFiles(t *testing.T) {
+	defaults, removeDefaults := writeNamedTempFile(
+		t,
+		"defaults.json",
+		`{"db": {"host": "localhost", "port": 5432}, "stage": "dev"}`,
+	)
+	defer removeDefaults()
+
+	overrides, removeOverrides := writeNamedTempFile(t, "overrides.yaml", "db:\n  host: db.example.com\n")
+	defer removeOverrides()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{.db.host}}:{{.db.port}} {{.stage}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", defaults, "-data-file", overrides})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "db.example.com:5432 dev")
+}
+
+func TestRunInFDWithIn(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", "foo.tmpl", "-in-fd", "3"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--in-fd and --in may not be combined"))
+}
+
+func TestRunSkipEmpty(t *testing.T) {
+	out, removeOut := tempfile.Write(t, "stale")
+	defer removeOut()
+
+	stderr := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "{{if enabled}}feature: on{{end}}\n  \n", nil)
+	defer finish()
+	mockOS.EXPECT().Stderr().Return(stderr)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-out", out, "-skip-empty", "-vars", "enabled="})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, stderr.String(), "skipped empty output file "+out+"\n")
+	assertNoFile(t, out)
+}
+
+func TestRunSkipEmptyNoExistingFile(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+	out := filepath.Join(dir, "out.yaml")
+
+	stderr := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "", nil)
+	defer finish()
+	mockOS.EXPECT().Stderr().Return(stderr)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-out", out, "-skip-empty"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, stderr.String(), "skipped empty output file "+out+"\n")
+	assertNoFile(t, out)
+}
+
+func TestRunSkipEmptyWritesNonEmpty(t *testing.T) {
+	out, removeOut := tempfile.Write(t, "stale")
+	defer removeOut()
+
+	mockOS, finish := mkMockOs(t, "{{if enabled}}feature: on{{end}}\n", nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-out", out, "-skip-empty", "-vars", "enabled=true"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	bytes, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, string(bytes), "feature: on\n")
+}
+
+func TestRunSprig(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{"ab" | upper}} {{repeat 2 "cd"}} {{env "FOO"}} {{expandenv "$FOO"}} `+
+			// Sprig's definitions replace envtemplate's
+			`{{regexReplaceAll "a+" "baaad" "X"}} {{camelcase "app_db_host"}} {{default "d" 0}} {{(split "," "a,b")._1}}`,
+		out,
+	)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("FOO").Return("foo", true)
+	mockOS.EXPECT().ExpandEnv("$FOO").Return("foo")
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-sprig"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "AB cdcd foo foo bXd AppDbHost d b")
+}
+
+func TestRunWithoutSprig(t *testing.T) {
+	mockOS, finish := mkMockOs(t, `{{repeat 2 "cd"}}`, nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+	assert.StringContains(t, got.Message, `function "repeat" not defined`)
+}
+
+func TestRunEnvsubstMode(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `host=${HOST:-localhost} port=$PORT {{env "PORT"}}`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOST").Return("", false)
+	mockOS.EXPECT().LookupEnv("PORT").Return("8080", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-mode", "envsubst"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), `host=localhost port=8080 {{env "PORT"}}`)
+}
+
+func TestRunBadMode(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-mode", "m4"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput(`invalid --mode value "m4"`))
+}
+
+func TestRunEnvsubstModeLint(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-mode", "envsubst", "-lint"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--lint may not be combined with --mode=envsubst"))
+}
+
+func TestRunEnvsubstModeStrict(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-mode", "envsubst", "-strict"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--strict may not be combined with --mode=envsubst"))
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// templateErrorLocation matches the location prefix of text/template parse
+// and execution errors, e.g. "template: name:12:" or "template: name:12:5:".
+var templateErrorLocation = regexp.MustCompile(`^template: .*?:(\d+):(?:(\d+):)?`)
+
+// errorContext returns the lines of src surrounding the location reported by
+// a template error, with n lines on either side, and a caret marking the
+// error's column if known. It returns an empty string if the error carries
+// no location.
+func errorContext(src []byte, err error, n int) string {
+	if n < 0 || err == nil {
+		return ""
+	}
+
+	match := templateErrorLocation.FindStringSubmatch(err.Error())
+	if match == nil {
+		return ""
+	}
+
+	lineNum, _ := strconv.Atoi(match[1])
+	col := -1
+	if match[2] != "" {
+		col, _ = strconv.Atoi(match[2])
+	}
+
+	lines := strings.Split(string(src), "\n")
+	if lineNum < 1 || lineNum > len(lines) {
+		return ""
+	}
+
+	first := lineNum - n
+	if first < 1 {
+		first = 1
+	}
+	last := lineNum + n
+	if last > len(lines) {
+		last = len(lines)
+	}
+
+	width := len(strconv.Itoa(last))
+	buf := &bytes.Buffer{}
+	for i := first; i <= last; i++ {
+		line := lines[i-1]
+		fmt.Fprintf(buf, "%*d | %s\n", width, i, line)
+		if i == lineNum && col >= 0 && col <= len(line) {
+			fmt.Fprintf(buf, "%*s | %s^\n", width, "", caretPadding(line[:col]))
+		}
+	}
+	return buf.String()
+}
+
+// caretPadding returns whitespace that occupies the same width as prefix,
+// preserving tabs so that a following caret aligns with the source.
+func caretPadding(prefix string) string {
+	return strings.Map(
+		func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		},
+		prefix,
+	)
+}
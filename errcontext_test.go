@@ -0,0 +1,108 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+const errorContextSrc = "line1\nline2\nline3\n\tline4 {{x}}\nline5\nline6\nline7"
+
+func TestErrorContextWithColumn(t *testing.T) {
+	err := errors.New(`template: cfg:4:9: executing "cfg" at <x>: error`)
+	assert.Equal(
+		t,
+		errorContext([]byte(errorContextSrc), err, 2),
+		`2 | line2
+3 | line3
+4 | 	line4 {{x}}
+  | 	        ^
+5 | line5
+6 | line6
+`,
+	)
+}
+
+func TestErrorContextWithoutColumn(t *testing.T) {
+	err := errors.New(`template: :2: unexpected "}" in operand`)
+	assert.Equal(
+		t,
+		errorContext([]byte(errorContextSrc), err, 1),
+		`1 | line1
+2 | line2
+3 | line3
+`,
+	)
+}
+
+func TestErrorContextClampsToSource(t *testing.T) {
+	err := errors.New(`template: :7:0: executing "" at <x>: error`)
+	assert.Equal(
+		t,
+		errorContext([]byte(errorContextSrc), err, 5),
+		`2 | line2
+3 | line3
+4 | 	line4 {{x}}
+5 | line5
+6 | line6
+7 | line7
+  | ^
+`,
+	)
+}
+
+func TestErrorContextWidth(t *testing.T) {
+	src := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11"
+	err := errors.New(`template: :9: error`)
+	assert.Equal(t, errorContext([]byte(src), err, 1), " 8 | 8\n 9 | 9\n10 | 10\n")
+}
+
+func TestErrorContextNoLocation(t *testing.T) {
+	assert.Equal(t, errorContext([]byte(errorContextSrc), errors.New("boom"), 2), "")
+	assert.Equal(t, errorContext([]byte(errorContextSrc), nil, 2), "")
+	err := errors.New(`template: :99: error`)
+	assert.Equal(t, errorContext([]byte(errorContextSrc), err, 2), "")
+}
+
+func TestRunErrorContext(t *testing.T) {
+	stderr := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "foo\n{{env \"BAR\"}}\nbaz", nil)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("BAR").Return("", false)
+	mockOS.EXPECT().Environ().Return(nil)
+	mockOS.EXPECT().Stderr().Return(stderr)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-error-context", "1"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(
+		t,
+		got,
+		c.Error(`template: :2:2: executing "" at <env "BAR">: error calling env: no value for $BAR in environment`),
+	)
+	assert.Equal(t, stderr.String(), "1 | foo\n2 | {{env \"BAR\"}}\n  |   ^\n3 | baz\n")
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const defaultEtcdEndpoint = "http://127.0.0.1:2379"
+
+// etcdKV is a key and value returned by the etcd range API.
+type etcdKV struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// etcdGet returns the value of key in etcd. Each key is fetched at most
+// once.
+func (r *runner) etcdGet(key string) (string, error) {
+	if value, ok := r.etcdKeys[key]; ok {
+		return value, nil
+	}
+
+	kvs, err := r.etcdRange(key, "")
+	if err != nil {
+		return "", fmt.Errorf("etcdGet: %s", err)
+	}
+	if len(kvs) == 0 {
+		return "", fmt.Errorf("etcdGet: no key %q", key)
+	}
+
+	r.etcdKeys[key] = string(kvs[0].Value)
+	return string(kvs[0].Value), nil
+}
+
+// etcdPrefix returns the keys and values in etcd that start with prefix,
+// with prefix removed from the keys. Each prefix is fetched at most once.
+func (r *runner) etcdPrefix(prefix string) (map[string]string, error) {
+	if values, ok := r.etcdPrefixes[prefix]; ok {
+		return values, nil
+	}
+
+	kvs, err := r.etcdRange(prefix, prefixRangeEnd(prefix))
+	if err != nil {
+		return nil, fmt.Errorf("etcdPrefix: %s", err)
+	}
+
+	values := make(map[string]string, len(kvs))
+	for _, kv := range kvs {
+		values[strings.TrimPrefix(string(kv.Key), prefix)] = string(kv.Value)
+	}
+	r.etcdPrefixes[prefix] = values
+	return values, nil
+}
+
+// prefixRangeEnd returns the end of the range of keys starting with
+// prefix, as used by etcdctl.
+func prefixRangeEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	// every key is greater than or equal to the prefix
+	return "\x00"
+}
+
+// etcdRange returns the keys in [key, end), or key alone if end is empty,
+// from the first of the endpoints given by --etcd-endpoints or
+// $ETCDCTL_ENDPOINTS that responds.
+func (r *runner) etcdRange(key, end string) ([]etcdKV, error) {
+	in := map[string][]byte{"key": []byte(key)}
+	if end != "" {
+		in["range_end"] = []byte(end)
+	}
+	var out struct {
+		KVs []etcdKV `json:"kvs"`
+	}
+
+	var err error
+	for _, endpoint := range r.etcdEndpointList() {
+		if err = r.etcdCall(endpoint, "/v3/kv/range", in, &out); err == nil {
+			return out.KVs, nil
+		}
+	}
+	return nil, err
+}
+
+// etcdSetting returns the value of an --etcd-* flag, or if it is empty, of
+// the environment variable used by etcdctl for the same setting.
+func (r *runner) etcdSetting(value, envVar string) string {
+	if value == "" {
+		value, _ = r.os.LookupEnv(envVar)
+	}
+	return value
+}
+
+func (r *runner) etcdEndpointList() []string {
+	endpoints := r.etcdSetting(r.etcdEndpoints, "ETCDCTL_ENDPOINTS")
+	if endpoints == "" {
+		endpoints = defaultEtcdEndpoint
+	}
+
+	var list []string
+	for _, endpoint := range strings.Split(endpoints, ",") {
+		if endpoint = strings.TrimSpace(endpoint); endpoint == "" {
+			continue
+		}
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		list = append(list, strings.TrimRight(endpoint, "/"))
+	}
+	return list
+}
+
+// etcdCall posts the JSON encoding of in to path at endpoint, decoding the
+// response into out. If --etcd-user or $ETCDCTL_USER is set, the request is
+// authenticated with a token obtained from the endpoint.
+func (r *runner) etcdCall(endpoint, path string, in, out interface{}) error {
+	client, err := r.etcdHTTPClient()
+	if err != nil {
+		return err
+	}
+
+	token := ""
+	if user := r.etcdSetting(r.etcdUser, "ETCDCTL_USER"); user != "" {
+		if token, err = r.etcdAuthToken(client, endpoint, user); err != nil {
+			return err
+		}
+	}
+
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return getJSONWith(client, req, out)
+}
+
+// etcdAuthToken returns a token for user, given as "name:password".
+func (r *runner) etcdAuthToken(client *http.Client, endpoint, user string) (string, error) {
+	if token, ok := r.etcdTokens[endpoint]; ok {
+		return token, nil
+	}
+
+	name, password := user, ""
+	if i := strings.Index(name, ":"); i >= 0 {
+		name, password = name[:i], name[i+1:]
+	}
+	body, err := json.Marshal(map[string]string{"name": name, "password": password})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/v3/auth/authenticate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := getJSONWith(client, req, &resp); err != nil {
+		return "", err
+	}
+	r.etcdTokens[endpoint] = resp.Token
+	return resp.Token, nil
+}
+
+// etcdHTTPClient returns the client used for etcd requests, which trusts
+// the CA given by --etcd-cacert and presents the certificate given by
+// --etcd-cert and --etcd-key, if set.
+func (r *runner) etcdHTTPClient() (*http.Client, error) {
+	if r.etcdClient != nil {
+		return r.etcdClient, nil
+	}
+
+	caCert := r.etcdSetting(r.etcdCACert, "ETCDCTL_CACERT")
+	certFile := r.etcdSetting(r.etcdCert, "ETCDCTL_CERT")
+	keyFile := r.etcdSetting(r.etcdKey, "ETCDCTL_KEY")
+	if caCert == "" && certFile == "" && keyFile == "" {
+		r.etcdClient = r.httpClient
+		return r.etcdClient, nil
+	}
+
+	config := &tls.Config{}
+	if caCert != "" {
+		pem, err := ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		if err := addRootCAs(config, pem, caCert); err != nil {
+			return nil, err
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	r.etcdClient = newTLSClient(config)
+	return r.etcdClient, nil
+}
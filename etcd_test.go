@@ -0,0 +1,202 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// etcdHandler returns a handler for the etcd range and authenticate APIs,
+// which serves kv to requests authorized with token, if it is non-empty,
+// and counts the range requests it receives.
+func etcdHandler(t *testing.T, kv map[string]string, token string, requests *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v3/auth/authenticate":
+			var in struct {
+				Name     string
+				Password string
+			}
+			assert.Nil(t, json.NewDecoder(req.Body).Decode(&in))
+			if in.Name != "root" || in.Password != "pw" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": token})
+
+		case "/v3/kv/range":
+			*requests++
+			if token != "" && req.Header.Get("Authorization") != token {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			var in struct {
+				Key      []byte `json:"key"`
+				RangeEnd []byte `json:"range_end"`
+			}
+			assert.Nil(t, json.NewDecoder(req.Body).Decode(&in))
+
+			keys := []string{}
+			for k := range kv {
+				if k == string(in.Key) || (len(in.RangeEnd) > 0 && k >= string(in.Key) && k < string(in.RangeEnd)) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+
+			kvs := []etcdKV{}
+			for _, k := range keys {
+				kvs = append(kvs, etcdKV{[]byte(k), []byte(kv[k])})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"kvs": kvs})
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func TestPrefixRangeEnd(t *testing.T) {
+	assert.Equal(t, prefixRangeEnd("/a/"), "/a0")
+	assert.Equal(t, prefixRangeEnd("a\xff"), "b")
+	assert.Equal(t, prefixRangeEnd("\xff\xff"), "\x00")
+	assert.Equal(t, prefixRangeEnd(""), "\x00")
+}
+
+func TestEtcdGet(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(etcdHandler(t, map[string]string{"/web/max_conns": "100"}, "", &requests))
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{"ETCDCTL_ENDPOINTS": server.URL + "/"})
+	defer finish()
+
+	got, err := r.etcdGet("/web/max_conns")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "100")
+
+	got, err = r.etcdGet("/web/max_conns")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "100")
+
+	_, err = r.etcdGet("/web/missing")
+	assert.ErrorContains(t, err, `etcdGet: no key "/web/missing"`)
+
+	// fetched once for each key
+	assert.Equal(t, requests, 2)
+}
+
+func TestEtcdPrefix(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(etcdHandler(t, map[string]string{
+		"/web/env/STAGE":   "prod",
+		"/web/env/DB_HOST": "db.example.com",
+		"/web/env0":        "excluded",
+		"/web/max_conns":   "100",
+	}, "", &requests))
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, nil)
+	defer finish()
+	r.etcdEndpoints = strings.TrimPrefix(server.URL, "http://")
+
+	got, err := r.etcdPrefix("/web/env/")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, map[string]string{"STAGE": "prod", "DB_HOST": "db.example.com"})
+
+	got, err = r.etcdPrefix("/web/env/")
+	assert.Nil(t, err)
+	assert.Equal(t, len(got), 2)
+
+	got, err = r.etcdPrefix("/missing/")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, map[string]string{})
+
+	// fetched once for each prefix
+	assert.Equal(t, requests, 2)
+}
+
+func TestEtcdAuthAndFailover(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(etcdHandler(t, map[string]string{"a": "b"}, "tok", &requests))
+	defer server.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{"ETCDCTL_USER": "root:pw"})
+	defer finish()
+	r.etcdEndpoints = down.URL + ", " + server.URL
+
+	got, err := r.etcdGet("a")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "b")
+
+	r, finish = mkEnvRunner(t, nil)
+	defer finish()
+	r.etcdEndpoints = server.URL
+	r.etcdUser = "root:wrong"
+
+	_, err = r.etcdGet("a")
+	assert.ErrorContains(t, err, "etcdGet: POST /v3/auth/authenticate returned 401 Unauthorized")
+}
+
+func TestEtcdTLS(t *testing.T) {
+	requests := 0
+	server := httptest.NewTLSServer(etcdHandler(t, map[string]string{"a": "b"}, "", &requests))
+	defer server.Close()
+
+	caCert, removeCACert := writeNamedTempFile(
+		t,
+		"ca.pem",
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})),
+	)
+	defer removeCACert()
+
+	r, finish := mkEnvRunner(t, map[string]string{"ETCDCTL_CACERT": caCert})
+	defer finish()
+	r.etcdEndpoints = server.URL
+
+	got, err := r.etcdGet("a")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "b")
+
+	r, finish = mkEnvRunner(t, nil)
+	defer finish()
+	r.etcdEndpoints = server.URL
+	r.etcdCACert = "/nonexistent/ca.pem"
+
+	_, err = r.etcdGet("a")
+	assert.ErrorContains(t, err, "etcdGet: open /nonexistent/ca.pem")
+
+	r, finish = mkEnvRunner(t, nil)
+	defer finish()
+	r.etcdEndpoints = server.URL
+	r.etcdCert = "/nonexistent/cert.pem"
+
+	_, err = r.etcdGet("a")
+	assert.ErrorContains(t, err, "etcdGet: open /nonexistent/cert.pem")
+}
@@ -0,0 +1,35 @@
+//go:build windows || plan9
+// +build windows plan9
+
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "os"
+
+// execProcess is nil where a process cannot be replaced, so the command run
+// by exec or --exec-with-env is run as a child process.
+var execProcess func(argv0 string, argv []string, envv []string) error
+
+// relaySignals are passed on to a command that is run as a child process.
+var relaySignals = []os.Signal{os.Interrupt}
+
+// signalStatus reports that no process was killed by a signal, since the
+// platform does not report it.
+func signalStatus(state *os.ProcessState) (int, bool) {
+	return 0, false
+}
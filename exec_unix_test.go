@@ -0,0 +1,103 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestRunExecRelaysSignals(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+
+	pr, pw, err := os.Pipe()
+	assert.Nil(t, err)
+	defer pr.Close()
+	defer pw.Close()
+
+	mockOS, finish := mkMockOs(t, "", nil)
+	defer finish()
+	mockOS.EXPECT().Environ().Return([]string{"PATH=/bin:/usr/bin"})
+	mockOS.EXPECT().Stdout().Return(pw)
+	mockOS.EXPECT().Stderr().Return(pw)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.execProcess = nil
+	assert.Nil(t, c.Flags.Parse([]string{"-out", filepath.Join(dir, "out")}))
+
+	script := `trap 'kill $!; echo TERM; exit 0' TERM; sleep 10 >/dev/null 2>&1 & echo ready; wait $!`
+	done := make(chan command.CmdErr, 1)
+	go func() { done <- r.Run(c, []string{"exec", "sh", "-c", script}) }()
+
+	lines := bufio.NewReader(pr)
+	line, err := lines.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, line, "ready\n")
+
+	// received by the test process, which is envtemplate
+	assert.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+
+	line, err = lines.ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, line, "TERM\n")
+	assert.Equal(t, <-done, command.NoError())
+}
+
+func TestRunExecKilledBySignal(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+
+	stderr := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "", nil)
+	defer finish()
+	mockOS.EXPECT().Environ().Return([]string{"PATH=/bin:/usr/bin"})
+	mockOS.EXPECT().Stdout().Return(&bytes.Buffer{})
+	mockOS.EXPECT().Stderr().Return(stderr)
+	mockOS.EXPECT().Exit(128 + int(syscall.SIGKILL))
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.execProcess = nil
+	assert.Nil(t, c.Flags.Parse([]string{"-out", filepath.Join(dir, "out")}))
+
+	got := r.Run(c, []string{"exec", "sh", "-c", "kill -KILL $$"})
+	assert.Equal(t, got, command.CmdErr{Cmd: c, Code: 137})
+	assert.Equal(t, stderr.String(), "")
+}
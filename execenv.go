@@ -0,0 +1,254 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/turbinelabs/cli/command"
+)
+
+// envNamePattern matches the environment variable names accepted by
+// --exec-with-env.
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseDotenv parses in as lines of KEY=value pairs, returning them in
+// order. Blank lines and lines starting with # are ignored, and each line
+// may be prefixed with "export". Values may be enclosed in single quotes,
+// which are removed, or double quotes, within which Go escape sequences are
+// interpreted. A # preceded by whitespace after an unquoted value, or
+// following the closing quote of a quoted one, begins a comment.
+func parseDotenv(in []byte) ([]string, error) {
+	pairs := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(in))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "export ") {
+			line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected KEY=value, got %q", n, line)
+		}
+
+		key := strings.TrimSpace(line[:i])
+		if !envNamePattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: invalid environment variable name %q", n, key)
+		}
+
+		value := stripInlineComment(line[i+1:])
+		if quoted, rest, ok := splitQuoted(strings.TrimSpace(line[i+1:])); ok && (rest == "" || rest[0] == '#') {
+			if quoted[0] == '"' {
+				unquoted, err := strconv.Unquote(quoted)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid quoted value %s", n, quoted)
+				}
+				value = unquoted
+			} else {
+				value = quoted[1 : len(quoted)-1]
+			}
+		}
+
+		pairs = append(pairs, key+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// splitQuoted splits value, if it begins with a single or double quote, at
+// the matching closing quote, returning the quoted string, including its
+// quotes, and the trimmed remainder. Within double quotes, a backslash
+// escapes the following character. It returns false if value is not quoted
+// or the quote is not closed.
+func splitQuoted(value string) (string, string, bool) {
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return "", "", false
+	}
+
+	quote := value[0]
+	for i := 1; i < len(value); i++ {
+		switch {
+		case quote == '"' && value[i] == '\\':
+			i++
+		case value[i] == quote:
+			return value[:i+1], strings.TrimSpace(value[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripInlineComment returns value, trimmed, without any comment beginning
+// with a # preceded by whitespace.
+func stripInlineComment(value string) string {
+	for i := 1; i < len(value); i++ {
+		if value[i] == '#' && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return strings.TrimSpace(value)
+}
+
+// mergeEnviron returns environ with each of the KEY=value pairs in
+// overrides added, replacing any existing value for the same key.
+func mergeEnviron(environ, overrides []string) []string {
+	index := map[string]int{}
+	merged := make([]string, 0, len(environ)+len(overrides))
+	for _, kv := range append(append([]string{}, environ...), overrides...) {
+		key := kv
+		if i := strings.Index(kv, "="); i >= 0 {
+			key = kv[:i]
+		}
+		if i, ok := index[key]; ok {
+			merged[i] = kv
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, kv)
+	}
+	return merged
+}
+
+// exitStatuser is implemented by the process status types of all platforms.
+type exitStatuser interface {
+	ExitStatus() int
+}
+
+// childCommand is a command run once the templates are rendered.
+type childCommand struct {
+	args []string
+	env  []string
+}
+
+// execWithEnvCommand returns the command in args with the environment of the
+// process extended by the KEY=value pairs in rendered.
+func (r *runner) execWithEnvCommand(cmd *command.Cmd, args []string, rendered []byte) (*childCommand, command.CmdErr) {
+	pairs, err := parseDotenv(rendered)
+	if err != nil {
+		return nil, cmd.BadInputf("could not parse rendered environment: %s", err)
+	}
+	return &childCommand{args, mergeEnviron(r.os.Environ(), pairs)}, command.NoError()
+}
+
+// parseExec returns the command following an "exec" argument in args, and
+// whether the argument is present. A "--" separating exec from the command
+// is removed.
+func parseExec(args []string) ([]string, bool) {
+	if len(args) == 0 || args[0] != "exec" {
+		return nil, false
+	}
+	args = args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	return args, true
+}
+
+// exitStatusError is returned by runCommand when the command fails. It is
+// not reported as an error of envtemplate: Run exits with status without
+// printing a message, so that usage errors and --check failures cannot be
+// confused with the command's own exit status.
+type exitStatusError struct {
+	status int
+}
+
+func (e exitStatusError) Error() string {
+	return fmt.Sprintf("exited with status %d", e.status)
+}
+
+// runCommand runs r.child once all output is written and profiling has
+// stopped. Where the platform allows it, envtemplate is replaced by the
+// command, which inherits its process ID, standard streams, and signals.
+// Otherwise the command is run as a child process, with SIGHUP, SIGINT,
+// SIGQUIT, and SIGTERM relayed to it. If it fails, an exitStatusError with
+// its exit status, or 128+n if it was killed by signal n, is returned.
+func (r *runner) runCommand() error {
+	args := r.child.args
+	if r.execProcess != nil {
+		path, err := exec.LookPath(args[0])
+		if err != nil {
+			return err
+		}
+		// returns only on failure
+		return r.execProcess(path, args, r.child.env)
+	}
+
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = r.child.env
+	if r.in != "" || r.inFD >= 0 {
+		child.Stdin = r.os.Stdin()
+	}
+	child.Stdout = r.os.Stdout()
+	child.Stderr = r.os.Stderr()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, relaySignals...)
+	defer signal.Stop(signals)
+
+	if err := child.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				child.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := child.Wait()
+	close(done)
+
+	if status, ok := exitStatus(err); ok {
+		return exitStatusError{status}
+	}
+	return err
+}
+
+// exitStatus returns the exit status of a command that failed with err, or
+// 128+n if it was killed by signal n. It returns false if err does not
+// carry an exit status.
+func exitStatus(err error) (int, bool) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+	if status, ok := signalStatus(exitErr.ProcessState); ok {
+		return status, true
+	}
+	if status, ok := exitErr.Sys().(exitStatuser); ok && status.ExitStatus() > 0 {
+		return status.ExitStatus(), true
+	}
+	return 0, false
+}
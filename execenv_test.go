@@ -0,0 +1,337 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+func TestParseDotenv(t *testing.T) {
+	got, err := parseDotenv([]byte(`
+# comment
+A=1
+export B = two words
+C="quoted\tvalue"
+D='single $quoted'
+E=
+F=x=y
+`))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, []string{
+		"A=1",
+		"B=two words",
+		"C=quoted\tvalue",
+		"D=single $quoted",
+		"E=",
+		"F=x=y",
+	})
+}
+
+func TestParseDotenvInlineComments(t *testing.T) {
+	got, err := parseDotenv([]byte(`
+A=a #b
+B="x y" # tail
+C='x # y'	# tail
+D="a \" # b" #c
+E=# not a comment
+F=a#b
+G= # empty
+`))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, got, []string{
+		"A=a",
+		"B=x y",
+		"C=x # y",
+		`D=a " # b`,
+		"E=# not a comment",
+		"F=a#b",
+		"G=",
+	})
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	_, err := parseDotenv([]byte("A=1\nB\n"))
+	assert.ErrorContains(t, err, `line 2: expected KEY=value, got "B"`)
+
+	_, err = parseDotenv([]byte("1A=1\n"))
+	assert.ErrorContains(t, err, `line 1: invalid environment variable name "1A"`)
+
+	_, err = parseDotenv([]byte("A=\"\\x\"\n"))
+	assert.ErrorContains(t, err, "line 1: invalid quoted value")
+}
+
+func TestMergeEnviron(t *testing.T) {
+	got := mergeEnviron([]string{"A=1", "B=2"}, []string{"B=3", "C=4", "A=5"})
+	assert.DeepEqual(t, got, []string{"A=5", "B=3", "C=4"})
+}
+
+func mkExecWithEnvRunner(
+	t *testing.T,
+	in string,
+	stdout *bytes.Buffer,
+	args ...string,
+) (*command.Cmd, *tbnos.MockOS, func()) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	mockOS, finish := mkMockOs(t, in, nil)
+	mockOS.EXPECT().Environ().Return([]string{"PATH=/bin:/usr/bin", "FOO=env"})
+	mockOS.EXPECT().Stdout().Return(stdout)
+	mockOS.EXPECT().Stderr().Return(&bytes.Buffer{})
+
+	// run the command as a child process rather than replacing the test
+	c := cmd()
+	c.Runner.(*runner).os = mockOS
+	c.Runner.(*runner).execProcess = nil
+	assert.Nil(t, c.Flags.Parse(args))
+	return c, mockOS, finish
+}
+
+func TestRunExecWithEnv(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	c, _, finish := mkExecWithEnvRunner(
+		t,
+		"FOO={{foo}}\nBAR=\"{{foo}} bar\"\n",
+		stdout,
+		"-vars", "foo=rendered", "-allow-exec", "-exec-with-env",
+	)
+	defer finish()
+
+	got := c.Runner.Run(c, []string{"sh", "-c", `echo "$FOO/$BAR"`})
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, stdout.String(), "rendered/rendered bar\n")
+}
+
+func TestRunExecWithEnvExitStatus(t *testing.T) {
+	c, mockOS, finish := mkExecWithEnvRunner(t, "FOO=bar", &bytes.Buffer{}, "-allow-exec", "-exec-with-env")
+	defer finish()
+	mockOS.EXPECT().Exit(7)
+
+	got := c.Runner.Run(c, []string{"sh", "-c", "exit 7"})
+	assert.Equal(t, got, command.CmdErr{Cmd: c, Code: 7})
+}
+
+func TestRunExecWithEnvBadEnv(t *testing.T) {
+	mockOS, finish := mkMockOs(t, "not an assignment", nil)
+	defer finish()
+
+	c := cmd()
+	c.Runner.(*runner).os = mockOS
+	c.Runner.(*runner).execProcess = nil
+	assert.Nil(t, c.Flags.Parse([]string{"-allow-exec", "-exec-with-env"}))
+
+	got := c.Runner.Run(c, []string{"true"})
+	assert.Equal(
+		t,
+		got,
+		c.BadInput(`could not parse rendered environment: line 1: expected KEY=value, got "not an assignment"`),
+	)
+}
+
+func TestRunExecWithEnvRequiresAllowExec(t *testing.T) {
+	c := cmd()
+	assert.Nil(t, c.Flags.Parse([]string{"-exec-with-env"}))
+
+	got := c.Runner.Run(c, []string{"true"})
+	assert.Equal(t, got, c.BadInput("--exec-with-env requires --allow-exec"))
+}
+
+func TestRunExecWithEnvRequiresCommand(t *testing.T) {
+	c := cmd()
+	assert.Nil(t, c.Flags.Parse([]string{"-allow-exec", "-exec-with-env"}))
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--exec-with-env requires a command after --"))
+}
+
+func TestRunExecWithEnvWithOut(t *testing.T) {
+	c := cmd()
+	assert.Nil(t, c.Flags.Parse([]string{"-allow-exec", "-exec-with-env", "-out", "x"}))
+
+	got := c.Runner.Run(c, []string{"true"})
+	assert.Equal(t, got, c.BadInput("--exec-with-env may not be combined with --out or --lint"))
+}
+
+func TestParseExec(t *testing.T) {
+	got, ok := parseExec(nil)
+	assert.False(t, ok)
+
+	got, ok = parseExec([]string{"foo"})
+	assert.False(t, ok)
+
+	got, ok = parseExec([]string{"exec", "app", "--", "serve"})
+	assert.True(t, ok)
+	assert.DeepEqual(t, got, []string{"app", "--", "serve"})
+
+	got, ok = parseExec([]string{"exec", "--", "app", "serve"})
+	assert.True(t, ok)
+	assert.DeepEqual(t, got, []string{"app", "serve"})
+
+	got, ok = parseExec([]string{"exec", "--"})
+	assert.True(t, ok)
+	assert.Equal(t, len(got), 0)
+}
+
+func TestRunExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+	out := filepath.Join(dir, "app.conf")
+
+	stdout := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "port={{port}}\n", nil)
+	defer finish()
+	mockOS.EXPECT().Environ().Return([]string{"PATH=/bin:/usr/bin", "FOO=env"})
+	mockOS.EXPECT().Stdout().Return(stdout)
+	mockOS.EXPECT().Stderr().Return(&bytes.Buffer{})
+
+	c := cmd()
+	c.Runner.(*runner).os = mockOS
+	c.Runner.(*runner).execProcess = nil
+	assert.Nil(t, c.Flags.Parse([]string{"-out", out, "-vars", "port=8080"}))
+
+	got := c.Runner.Run(c, []string{"exec", "--", "sh", "-c", `cat "$1"; echo "$FOO"`, "sh", out})
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, stdout.String(), "port=8080\nenv\n")
+}
+
+func TestRunExecExitStatus(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+
+	// including the statuses of bad input and --check failures
+	for _, status := range []int{1, 2, int(checkDriftCode), 7} {
+		stderr := &bytes.Buffer{}
+		mockOS, finish := mkMockOs(t, "x", nil)
+		mockOS.EXPECT().Environ().Return([]string{"PATH=/bin:/usr/bin"})
+		mockOS.EXPECT().Stdout().Return(&bytes.Buffer{})
+		mockOS.EXPECT().Stderr().Return(stderr)
+		mockOS.EXPECT().Exit(status)
+
+		c := cmd()
+		c.Runner.(*runner).os = mockOS
+		c.Runner.(*runner).execProcess = nil
+		assert.Nil(t, c.Flags.Parse([]string{"-out", filepath.Join(dir, "out")}))
+
+		got := c.Runner.Run(c, []string{"exec", "sh", "-c", fmt.Sprintf("exit %d", status)})
+		assert.Equal(t, got, command.CmdErr{Cmd: c, Code: command.CmdErrCode(status)})
+		assert.Equal(t, stderr.String(), "")
+		finish()
+	}
+}
+
+func TestRunExecNotFound(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+
+	mockOS, finish := mkMockOs(t, "x", nil)
+	defer finish()
+	mockOS.EXPECT().Environ().Return([]string{"PATH=/bin:/usr/bin"})
+
+	c := cmd()
+	c.Runner.(*runner).os = mockOS
+	c.Runner.(*runner).execProcess = func(string, []string, []string) error {
+		t.Error("unexpected exec")
+		return nil
+	}
+	assert.Nil(t, c.Flags.Parse([]string{"-out", filepath.Join(dir, "out")}))
+
+	got := c.Runner.Run(c, []string{"exec", "no-such-command"})
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+	assert.StringContains(t, got.Message, "could not run no-such-command")
+}
+
+func TestRunExecReplacesProcess(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+	out := filepath.Join(dir, "app.conf")
+
+	mockOS, finish := mkMockOs(t, "port={{port}}\n", nil)
+	defer finish()
+	mockOS.EXPECT().Environ().Return([]string{"PATH=/bin:/usr/bin", "FOO=env"})
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.execProcess = func(argv0 string, argv []string, envv []string) error {
+		assert.Equal(t, argv0, sh)
+		assert.DeepEqual(t, argv, []string{"sh", "-c", "true"})
+		assert.DeepEqual(t, envv, []string{"PATH=/bin:/usr/bin", "FOO=env"})
+
+		// the output is complete before the command replaces envtemplate
+		assertFileContents(t, out, "port=8080\n")
+		return errors.New("exec failed")
+	}
+	assert.Nil(t, c.Flags.Parse([]string{"-out", out, "-vars", "port=8080"}))
+
+	got := r.Run(c, []string{"exec", "--", "sh", "-c", "true"})
+	assert.Equal(t, got, c.Error("could not run sh: exec failed"))
+}
+
+func TestRunExecRenderFailure(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+
+	mockOS, finish := mkMockOs(t, "{{", nil)
+	defer finish()
+
+	c := cmd()
+	c.Runner.(*runner).os = mockOS
+	c.Runner.(*runner).execProcess = nil
+	assert.Nil(t, c.Flags.Parse([]string{"-out", filepath.Join(dir, "out")}))
+
+	// the command is not run
+	got := c.Runner.Run(c, []string{"exec", "--", "false"})
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+}
+
+func TestRunExecRequiresCommand(t *testing.T) {
+	c := cmd()
+	got := c.Runner.Run(c, []string{"exec", "--"})
+	assert.Equal(t, got, c.BadInput("exec requires a command"))
+}
+
+func TestRunExecWithExecWithEnv(t *testing.T) {
+	c := cmd()
+	assert.Nil(t, c.Flags.Parse([]string{"-allow-exec", "-exec-with-env"}))
+
+	got := c.Runner.Run(c, []string{"exec", "true"})
+	assert.Equal(t, got, c.BadInput("--exec-with-env may not be combined with exec"))
+}
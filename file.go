@@ -0,0 +1,62 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+)
+
+// file returns the contents of the named file, resolved as for include.
+// It requires --allow-file-read.
+func (r *runner) file(path string) (string, error) {
+	contents, err := r.readFile(path)
+	if err != nil {
+		return "", fmt.Errorf("file: %s", err)
+	}
+	return contents, nil
+}
+
+// envOrFile returns the value of the environment variable key, if set, and
+// otherwise the contents of the named file, as for file.
+func (r *runner) envOrFile(key, path string) (string, error) {
+	if value, ok := r.os.LookupEnv(key); ok {
+		return value, nil
+	}
+
+	contents, err := r.readFile(path)
+	if err != nil {
+		return "", fmt.Errorf("envOrFile: $%s is not set and %s", key, err)
+	}
+	return contents, nil
+}
+
+func (r *runner) readFile(path string) (string, error) {
+	if !r.allowFileRead {
+		return "", fmt.Errorf("reading files requires --allow-file-read")
+	}
+
+	path, err := r.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(contents), nil
+}
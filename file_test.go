@@ -0,0 +1,106 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestFile(t *testing.T) {
+	path, remove := writeNamedTempFile(t, "db_password", "hunter2\n")
+	defer remove()
+
+	r, finish := mkEnvRunner(t, nil)
+	defer finish()
+	r.allowFileRead = true
+
+	got, err := r.file(path)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2\n")
+}
+
+func TestFileRelativeToInclude(t *testing.T) {
+	path, remove := writeNamedTempFile(t, "db_password", "hunter2")
+	defer remove()
+
+	r, finish := mkEnvRunner(t, nil)
+	defer finish()
+	r.allowFileRead = true
+	r.includes = []string{filepath.Join(filepath.Dir(path), "template.tmpl")}
+
+	got, err := r.file("db_password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+}
+
+func TestFileRequiresAllowFileRead(t *testing.T) {
+	path, remove := writeNamedTempFile(t, "db_password", "hunter2")
+	defer remove()
+
+	r, finish := mkEnvRunner(t, nil)
+	defer finish()
+
+	got, err := r.file(path)
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "file: reading files requires --allow-file-read")
+}
+
+func TestFileMissing(t *testing.T) {
+	path, remove := writeNamedTempFile(t, "db_password", "hunter2")
+	defer remove()
+
+	r, finish := mkEnvRunner(t, nil)
+	defer finish()
+	r.allowFileRead = true
+
+	_, err := r.file(path + ".missing")
+	assert.ErrorContains(t, err, "file: ")
+	assert.ErrorContains(t, err, "db_password.missing")
+}
+
+func TestEnvOrFileEnv(t *testing.T) {
+	r, finish := mkEnvRunner(t, map[string]string{"DB_PASSWORD": "from-env"})
+	defer finish()
+
+	got, err := r.envOrFile("DB_PASSWORD", "/does/not/exist")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "from-env")
+}
+
+func TestEnvOrFileFile(t *testing.T) {
+	path, remove := writeNamedTempFile(t, "db_password", "from-file")
+	defer remove()
+
+	r, finish := mkEnvRunner(t, nil)
+	defer finish()
+	r.allowFileRead = true
+
+	got, err := r.envOrFile("DB_PASSWORD", path)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "from-file")
+}
+
+func TestEnvOrFileRequiresAllowFileRead(t *testing.T) {
+	r, finish := mkEnvRunner(t, nil)
+	defer finish()
+
+	_, err := r.envOrFile("DB_PASSWORD", "/run/secrets/db_password")
+	assert.ErrorContains(t, err, "envOrFile: $DB_PASSWORD is not set and reading files requires --allow-file-read")
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/turbinelabs/envtemplate/envtemplate"
+)
+
+const (
+	defaultGCPSecretManagerURL = "https://secretmanager.googleapis.com"
+	defaultGCPTokenURL         = "https://oauth2.googleapis.com/token"
+	defaultGCEMetadataHost     = "metadata.google.internal"
+	gcpScope                   = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// gcpCredentials is the JSON credentials file used by Application Default
+// Credentials, for either a service account or a user.
+type gcpCredentials struct {
+	Type     string `json:"type"`
+	TokenURI string `json:"token_uri"`
+
+	// service_account
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+
+	// authorized_user
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// gcpSecret returns the payload of the GCP Secret Manager secret version
+// with the given resource name. If name does not include a version, the
+// latest version is used. Each secret version is fetched at most once.
+func (r *runner) gcpSecret(name string) (string, error) {
+	name = strings.Trim(name, "/")
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	if secret, ok := r.gcpSecrets[name]; ok {
+		return secret, nil
+	}
+
+	secret, err := r.accessGCPSecret(name)
+	if err != nil {
+		return "", fmt.Errorf("gcpSecret: %s", err)
+	}
+	r.gcpSecrets[name] = secret
+	return secret, nil
+}
+
+func (r *runner) accessGCPSecret(name string) (string, error) {
+	token, err := r.gcpAccessToken()
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.gcpSecretManagerURL+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Payload struct {
+			Data []byte `json:"data"`
+		} `json:"payload"`
+	}
+	if err := r.getJSON(req, &resp); err != nil {
+		return "", err
+	}
+	return string(resp.Payload.Data), nil
+}
+
+// gcpAccessToken returns an OAuth2 access token found using Application
+// Default Credentials: the credentials file named by
+// $GOOGLE_APPLICATION_CREDENTIALS, the file written by "gcloud auth
+// application-default login", or the GCE metadata server. The token is
+// found at most once.
+func (r *runner) gcpAccessToken() (string, error) {
+	if r.gcpToken == "" {
+		token, err := r.findGCPAccessToken()
+		if err != nil {
+			return "", err
+		}
+		r.gcpToken = token
+	}
+	return r.gcpToken, nil
+}
+
+func (r *runner) findGCPAccessToken() (string, error) {
+	if path, ok := r.os.LookupEnv("GOOGLE_APPLICATION_CREDENTIALS"); ok && path != "" {
+		return r.gcpFileToken(path)
+	}
+
+	if path := r.gcloudCredentialsPath(); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return r.gcpFileToken(path)
+		}
+	}
+
+	token, err := r.gceMetadataToken()
+	if err != nil {
+		return "", fmt.Errorf("no GCP credentials found: %s", err)
+	}
+	return token, nil
+}
+
+// gcloudCredentialsPath returns the path of the credentials file written by
+// gcloud, in $CLOUDSDK_CONFIG or ~/.config/gcloud.
+func (r *runner) gcloudCredentialsPath() string {
+	dir, ok := r.os.LookupEnv("CLOUDSDK_CONFIG")
+	if !ok || dir == "" {
+		var err error
+		if dir, err = envtemplate.ExpandHome("~/.config/gcloud", r.os); err != nil {
+			return ""
+		}
+	}
+	return filepath.Join(dir, "application_default_credentials.json")
+}
+
+func (r *runner) gcpFileToken(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	var creds gcpCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", fmt.Errorf("could not parse GCP credentials file %s: %s", path, err)
+	}
+
+	tokenURL := defaultGCPTokenURL
+	if creds.TokenURI != "" {
+		tokenURL = creds.TokenURI
+	}
+
+	form := url.Values{}
+	switch creds.Type {
+	case "service_account":
+		assertion, err := gcpJWT(creds, tokenURL, r.now().Unix())
+		if err != nil {
+			return "", fmt.Errorf("GCP credentials file %s: %s", path, err)
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+
+	default:
+		return "", fmt.Errorf("GCP credentials file %s has unsupported type %q", path, creds.Type)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r.getAccessToken(req)
+}
+
+// gceMetadataToken returns the token of the default service account of the
+// GCE instance or GKE workload, from the metadata server given by
+// $GCE_METADATA_HOST, if set.
+func (r *runner) gceMetadataToken() (string, error) {
+	host, ok := r.os.LookupEnv("GCE_METADATA_HOST")
+	if !ok || host == "" {
+		host = defaultGCEMetadataHost
+	}
+
+	req, err := http.NewRequest(
+		http.MethodGet,
+		"http://"+host+"/computeMetadata/v1/instance/service-accounts/default/token",
+		nil,
+	)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	ctx, cancel := context.WithTimeout(context.Background(), metadataTimeout)
+	defer cancel()
+	return r.getAccessToken(req.WithContext(ctx))
+}
+
+// gcpJWT returns a JWT, signed with the service account's private key, that
+// may be exchanged for an access token at aud.
+func gcpJWT(creds gcpCredentials, aud string, now int64) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("invalid private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return "", fmt.Errorf("invalid private key: %s", err)
+		}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("private key is not an RSA key")
+	}
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": gcpScope,
+		"aud":   aud,
+		"iat":   now,
+		"exp":   now + 3600,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// mkGCPServer returns a server acting as the OAuth2 token endpoint, the GCE
+// metadata server and Secret Manager, which serves the given secrets to
+// requests bearing a token it issued.
+func mkGCPServer(t *testing.T, key *rsa.PrivateKey, secrets map[string]string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		switch {
+		case req.URL.Path == "/token":
+			assert.Nil(t, req.ParseForm())
+			switch req.Form.Get("grant_type") {
+			case "urn:ietf:params:oauth:grant-type:jwt-bearer":
+				parts := strings.Split(req.Form.Get("assertion"), ".")
+				assert.Equal(t, len(parts), 3)
+				sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+				assert.Nil(t, err)
+				sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+				assert.Nil(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig))
+
+				claims, err := base64.RawURLEncoding.DecodeString(parts[1])
+				assert.Nil(t, err)
+				assert.StringContains(t, string(claims), `"iss":"sa@x.iam.gserviceaccount.com"`)
+				assert.StringContains(t, string(claims), `"scope":"`+gcpScope+`"`)
+				fmt.Fprint(w, `{"access_token": "sa-token", "expires_in": 3600}`)
+
+			case "refresh_token":
+				assert.Equal(t, req.Form.Get("refresh_token"), "refresh")
+				fmt.Fprint(w, `{"access_token": "user-token", "expires_in": 3600}`)
+
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+
+		case strings.HasPrefix(req.URL.Path, "/computeMetadata/"):
+			assert.Equal(t, req.Header.Get("Metadata-Flavor"), "Google")
+			fmt.Fprint(w, `{"access_token": "gce-token", "expires_in": 3600}`)
+
+		default:
+			switch req.Header.Get("Authorization") {
+			case "Bearer sa-token", "Bearer user-token", "Bearer gce-token":
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			secret, ok := secrets[req.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error": {"status": "NOT_FOUND"}}`)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"payload": map[string]interface{}{"data": []byte(secret)},
+			})
+		}
+	}))
+	return server, &requests
+}
+
+func mkGCPRunner(t *testing.T, server *httptest.Server, env map[string]string) (*runner, func()) {
+	r, finish := mkEnvRunner(t, env)
+	r.gcpSecretManagerURL = server.URL
+	return r, finish
+}
+
+func writeGCPCredentials(t *testing.T, creds map[string]string) (string, func()) {
+	data, err := json.Marshal(creds)
+	assert.Nil(t, err)
+	return writeNamedTempFile(t, "credentials.json", string(data))
+}
+
+func mkRSAKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.Nil(t, err)
+	return key
+}
+
+func TestGCPSecretServiceAccount(t *testing.T) {
+	key := mkRSAKey(t)
+	server, requests := mkGCPServer(t, key, map[string]string{
+		"/v1/projects/x/secrets/db/versions/latest:access": "hunter2",
+		"/v1/projects/x/secrets/db/versions/3:access":      "hunter1",
+	})
+	defer server.Close()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	creds, removeCreds := writeGCPCredentials(t, map[string]string{
+		"type":         "service_account",
+		"client_email": "sa@x.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    server.URL + "/token",
+	})
+	defer removeCreds()
+
+	r, finish := mkGCPRunner(t, server, map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": creds})
+	defer finish()
+
+	got, err := r.gcpSecret("projects/x/secrets/db/versions/latest")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	got, err = r.gcpSecret("projects/x/secrets/db")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	got, err = r.gcpSecret("/projects/x/secrets/db/versions/3")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter1")
+
+	// one token request, and one request for each secret version
+	assert.Equal(t, *requests, 3)
+}
+
+func TestGCPSecretPKCS1Key(t *testing.T) {
+	key := mkRSAKey(t)
+	server, _ := mkGCPServer(t, key, map[string]string{
+		"/v1/projects/x/secrets/db/versions/latest:access": "hunter2",
+	})
+	defer server.Close()
+
+	creds, removeCreds := writeGCPCredentials(t, map[string]string{
+		"type":         "service_account",
+		"client_email": "sa@x.iam.gserviceaccount.com",
+		"private_key": string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})),
+		"token_uri": server.URL + "/token",
+	})
+	defer removeCreds()
+
+	r, finish := mkGCPRunner(t, server, map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": creds})
+	defer finish()
+
+	got, err := r.gcpSecret("projects/x/secrets/db")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+}
+
+func TestGCPSecretAuthorizedUser(t *testing.T) {
+	server, _ := mkGCPServer(t, nil, map[string]string{
+		"/v1/projects/x/secrets/db/versions/latest:access": "hunter2",
+	})
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "envtemplate-gcloud")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	data, err := json.Marshal(map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "id",
+		"client_secret": "secret",
+		"refresh_token": "refresh",
+		"token_uri":     server.URL + "/token",
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "application_default_credentials.json"), data, 0600))
+
+	r, finish := mkGCPRunner(t, server, map[string]string{"CLOUDSDK_CONFIG": dir})
+	defer finish()
+
+	got, err := r.gcpSecret("projects/x/secrets/db")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+}
+
+func TestGCPSecretMetadata(t *testing.T) {
+	server, _ := mkGCPServer(t, nil, map[string]string{
+		"/v1/projects/x/secrets/db/versions/latest:access": "hunter2",
+	})
+	defer server.Close()
+
+	r, finish := mkGCPRunner(t, server, map[string]string{
+		"CLOUDSDK_CONFIG":   "/nonexistent",
+		"GCE_METADATA_HOST": strings.TrimPrefix(server.URL, "http://"),
+	})
+	defer finish()
+
+	got, err := r.gcpSecret("projects/x/secrets/db")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+}
+
+func TestGCPSecretErrors(t *testing.T) {
+	server, _ := mkGCPServer(t, nil, nil)
+	defer server.Close()
+
+	r, finish := mkGCPRunner(t, server, map[string]string{
+		"CLOUDSDK_CONFIG":   "/nonexistent",
+		"GCE_METADATA_HOST": strings.TrimPrefix(server.URL, "http://"),
+	})
+	defer finish()
+
+	_, err := r.gcpSecret("projects/x/secrets/missing")
+	assert.ErrorContains(
+		t,
+		err,
+		"gcpSecret: GET /v1/projects/x/secrets/missing/versions/latest:access returned 404 Not Found",
+	)
+
+	creds, removeCreds := writeGCPCredentials(t, map[string]string{"type": "external_account"})
+	defer removeCreds()
+
+	r, finish = mkGCPRunner(t, server, map[string]string{"GOOGLE_APPLICATION_CREDENTIALS": creds})
+	defer finish()
+
+	_, err = r.gcpSecret("projects/x/secrets/db")
+	assert.ErrorContains(t, err, `has unsupported type "external_account"`)
+}
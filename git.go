@@ -0,0 +1,171 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const detachedGitBranch = "HEAD"
+
+// gitHead returns the commit and branch checked out in the git working tree
+// containing dir, by reading the repository's files directly. When HEAD is
+// detached, the branch is reported as "HEAD", as git rev-parse does.
+func gitHead(dir string) (string, string, error) {
+	gitDir, err := findGitDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	head, err := ioutil.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return "", "", err
+	}
+
+	ref := strings.TrimSpace(string(head))
+	if !strings.HasPrefix(ref, "ref: ") {
+		return ref, detachedGitBranch, nil
+	}
+	ref = strings.TrimPrefix(ref, "ref: ")
+
+	commonDir, err := gitCommonDir(gitDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	commit, err := resolveGitRef(commonDir, ref)
+	if err != nil {
+		return "", "", err
+	}
+
+	return commit, strings.TrimPrefix(ref, "refs/heads/"), nil
+}
+
+// findGitDir searches dir and its parents for a .git directory. A .git file,
+// as used by submodules and worktrees, is followed to the directory it names.
+// For a worktree this is the per-worktree directory holding its HEAD; see
+// gitCommonDir for where its refs live.
+func findGitDir(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		path := filepath.Join(dir, ".git")
+		info, err := os.Stat(path)
+		if err == nil {
+			if info.IsDir() {
+				return path, nil
+			}
+
+			contents, err := ioutil.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			line := strings.TrimSpace(string(contents))
+			if !strings.HasPrefix(line, "gitdir: ") {
+				return "", fmt.Errorf("invalid gitdir file: %s", path)
+			}
+			gitDir := filepath.FromSlash(strings.TrimPrefix(line, "gitdir: "))
+			if !filepath.IsAbs(gitDir) {
+				gitDir = filepath.Join(dir, gitDir)
+			}
+			return gitDir, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", errors.New("not a git repository")
+		}
+		dir = parent
+	}
+}
+
+// gitCommonDir returns the directory holding the refs shared by gitDir. A
+// worktree's git directory names it in its commondir file, relative to
+// gitDir unless absolute; otherwise gitDir itself is returned.
+func gitCommonDir(gitDir string) (string, error) {
+	contents, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir"))
+	if os.IsNotExist(err) {
+		return gitDir, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	commonDir := filepath.FromSlash(strings.TrimSpace(string(contents)))
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	return commonDir, nil
+}
+
+// resolveGitRef returns the commit named by ref, consulting loose refs in
+// commonDir first and then its packed-refs.
+func resolveGitRef(commonDir, ref string) (string, error) {
+	loose, err := ioutil.ReadFile(filepath.Join(commonDir, filepath.FromSlash(ref)))
+	if err == nil {
+		return strings.TrimSpace(string(loose)), nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	packed, err := ioutil.ReadFile(filepath.Join(commonDir, "packed-refs"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(packed))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == ref {
+			return fields[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("cannot resolve git ref %s", ref)
+}
+
+// gitCommand runs git with the given arguments and returns its trimmed
+// output.
+func gitCommand(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), msg)
+		}
+		return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+)
+
+const (
+	testCommit       = "0123456789abcdef0123456789abcdef01234567"
+	testPackedCommit = "fedcba9876543210fedcba9876543210fedcba98"
+)
+
+// mkGitFixture creates a working tree containing a minimal .git directory
+// with the given HEAD, along with a subdirectory of the working tree. A
+// linked worktree, laid out as git worktree add does, is checked out on
+// the packed branch in the worktree directory.
+func mkGitFixture(t *testing.T, head string) (string, func()) {
+	root, err := ioutil.TempDir("", "envtemplate-git")
+	assert.Nil(t, err)
+
+	files := map[string]string{
+		".git/HEAD":             head + "\n",
+		".git/refs/heads/main":  testCommit + "\n",
+		".git/packed-refs":      "# pack-refs with: peeled fully-peeled sorted\n" + testPackedCommit + " refs/heads/packed\n",
+		"sub/dir/.keep":         "",
+		"worktree/nested/.keep": "",
+
+		".git/worktrees/worktree/HEAD":      "ref: refs/heads/packed\n",
+		".git/worktrees/worktree/commondir": "../..\n",
+	}
+	for name, contents := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0644))
+	}
+
+	gitdir := filepath.Join(root, ".git", "worktrees", "worktree")
+	assert.Nil(t, ioutil.WriteFile(
+		filepath.Join(root, "worktree", ".git"),
+		[]byte("gitdir: "+filepath.ToSlash(gitdir)+"\n"),
+		0644,
+	))
+
+	return root, func() { os.RemoveAll(root) }
+}
+
+func TestGitHeadBranch(t *testing.T) {
+	root, cleanup := mkGitFixture(t, "ref: refs/heads/main")
+	defer cleanup()
+
+	commit, branch, err := gitHead(filepath.Join(root, "sub", "dir"))
+	assert.Nil(t, err)
+	assert.Equal(t, commit, testCommit)
+	assert.Equal(t, branch, "main")
+}
+
+func TestGitHeadPackedBranch(t *testing.T) {
+	root, cleanup := mkGitFixture(t, "ref: refs/heads/packed")
+	defer cleanup()
+
+	commit, branch, err := gitHead(root)
+	assert.Nil(t, err)
+	assert.Equal(t, commit, testPackedCommit)
+	assert.Equal(t, branch, "packed")
+}
+
+func TestGitHeadDetached(t *testing.T) {
+	root, cleanup := mkGitFixture(t, testCommit)
+	defer cleanup()
+
+	commit, branch, err := gitHead(root)
+	assert.Nil(t, err)
+	assert.Equal(t, commit, testCommit)
+	assert.Equal(t, branch, "HEAD")
+}
+
+func TestGitHeadWorktree(t *testing.T) {
+	root, cleanup := mkGitFixture(t, "ref: refs/heads/main")
+	defer cleanup()
+
+	commit, branch, err := gitHead(filepath.Join(root, "worktree", "nested"))
+	assert.Nil(t, err)
+	assert.Equal(t, commit, testPackedCommit)
+	assert.Equal(t, branch, "packed")
+}
+
+func TestGitHeadUnresolvableRef(t *testing.T) {
+	root, cleanup := mkGitFixture(t, "ref: refs/heads/missing")
+	defer cleanup()
+
+	_, _, err := gitHead(root)
+	assert.ErrorContains(t, err, "cannot resolve git ref refs/heads/missing")
+}
+
+func TestGitHeadNotARepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envtemplate-git")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	_, _, err = gitHead(dir)
+	assert.ErrorContains(t, err, "not a git repository")
+}
+
+func TestRunGitFunctions(t *testing.T) {
+	root, cleanup := mkGitFixture(t, "ref: refs/heads/main")
+	defer cleanup()
+
+	wd, err := os.Getwd()
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chdir(filepath.Join(root, "sub")))
+	defer os.Chdir(wd)
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{gitBranch}}@{{gitCommit}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "main@"+testCommit)
+}
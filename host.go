@@ -0,0 +1,189 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// netInterface is a network interface and the IP addresses assigned to it.
+type netInterface struct {
+	name  string
+	flags net.Flags
+	ips   []net.IP
+}
+
+// privateNets are the IPv4 ranges reserved for private networks by RFC 1918,
+// and the IPv6 unique local range from RFC 4193.
+var privateNets = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+// sharedNet is the IPv4 range shared by carrier-grade NAT under RFC 6598.
+// Its addresses are not private, but not reachable from the internet either.
+var sharedNet = mustParseCIDRs("100.64.0.0/10")[0]
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// systemInterfaces returns the network interfaces of this machine.
+func systemInterfaces() ([]netInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]netInterface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, fmt.Errorf("interface %s: %s", iface.Name, err)
+		}
+
+		ni := netInterface{name: iface.Name, flags: iface.Flags}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				ni.ips = append(ni.ips, ipNet.IP)
+			}
+		}
+		result = append(result, ni)
+	}
+	return result, nil
+}
+
+// firstIP returns the first of ips for which match returns true, preferring
+// IPv4 addresses to IPv6 addresses.
+func firstIP(ips []net.IP, match func(net.IP) bool) net.IP {
+	var v6 net.IP
+	for _, ip := range ips {
+		if !match(ip) {
+			continue
+		}
+		if ip.To4() != nil {
+			return ip
+		}
+		if v6 == nil {
+			v6 = ip
+		}
+	}
+	return v6
+}
+
+// fqdn returns the fully qualified domain name of this machine, found by
+// resolving its hostname and looking up the names of the resulting
+// addresses. If no name can be found, the hostname is returned.
+func (r *runner) fqdn() (string, error) {
+	host, err := r.hostname()
+	if err != nil {
+		return "", fmt.Errorf("fqdn: %s", err)
+	}
+	if strings.Contains(host, ".") {
+		return host, nil
+	}
+
+	addrs, err := r.lookupHost(host)
+	if err != nil {
+		return host, nil
+	}
+	for _, addr := range addrs {
+		names, err := r.lookupAddr(addr)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			name = strings.TrimSuffix(name, ".")
+			if strings.HasPrefix(name, host+".") {
+				return name, nil
+			}
+		}
+	}
+	return host, nil
+}
+
+// interfaceIP returns the address of the named network interface, preferring
+// an IPv4 address.
+func (r *runner) interfaceIP(name string) (string, error) {
+	ifaces, err := r.netInterfaces()
+	if err != nil {
+		return "", fmt.Errorf("interfaceIP: %s", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.name != name {
+			continue
+		}
+		ip := firstIP(iface.ips, func(net.IP) bool { return true })
+		if ip == nil {
+			return "", fmt.Errorf("interfaceIP: interface %s has no addresses", name)
+		}
+		return ip.String(), nil
+	}
+	return "", fmt.Errorf("interfaceIP: no interface named %s", name)
+}
+
+// privateIP returns the first private address assigned to an interface that
+// is up and not a loopback interface, preferring an IPv4 address.
+func (r *runner) privateIP() (string, error) {
+	return r.findIP("privateIP", "private", isPrivateIP)
+}
+
+// publicIP returns the first global unicast address that is neither private
+// nor shared by carrier-grade NAT assigned to an interface that is up,
+// preferring an IPv4 address. Addresses provided by NAT, such as EC2 public
+// IPs, are not visible to it.
+func (r *runner) publicIP() (string, error) {
+	return r.findIP("publicIP", "public", func(ip net.IP) bool {
+		return ip.IsGlobalUnicast() && !isPrivateIP(ip) && !sharedNet.Contains(ip)
+	})
+}
+
+func (r *runner) findIP(name, kind string, match func(net.IP) bool) (string, error) {
+	ifaces, err := r.netInterfaces()
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", name, err)
+	}
+
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.flags&net.FlagUp == 0 || iface.flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ips = append(ips, iface.ips...)
+	}
+	if ip := firstIP(ips, match); ip != nil {
+		return ip.String(), nil
+	}
+	return "", fmt.Errorf("%s: no %s address found", name, kind)
+}
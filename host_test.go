@@ -0,0 +1,171 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func mkHostRunner(ifaces ...netInterface) *runner {
+	r := cmd().Runner.(*runner)
+	r.hostname = func() (string, error) { return "web1", nil }
+	r.lookupHost = func(host string) ([]string, error) {
+		if host != "web1" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"10.0.0.5", "10.0.0.6"}, nil
+	}
+	r.lookupAddr = func(addr string) ([]string, error) {
+		switch addr {
+		case "10.0.0.5":
+			return nil, errors.New("no such host")
+		case "10.0.0.6":
+			return []string{"localhost.", "web1.example.com."}, nil
+		}
+		return nil, nil
+	}
+	r.netInterfaces = func() ([]netInterface, error) { return ifaces, nil }
+	return r
+}
+
+func TestFQDN(t *testing.T) {
+	r := mkHostRunner()
+
+	got, err := r.fqdn()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "web1.example.com")
+
+	r.hostname = func() (string, error) { return "db1", nil }
+	got, err = r.fqdn()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "db1")
+
+	r.hostname = func() (string, error) { return "db1.example.com", nil }
+	got, err = r.fqdn()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "db1.example.com")
+
+	r.hostname = func() (string, error) { return "", errors.New("boom") }
+	_, err = r.fqdn()
+	assert.ErrorContains(t, err, "fqdn: boom")
+}
+
+var testInterfaces = []netInterface{
+	{
+		name:  "lo",
+		flags: net.FlagUp | net.FlagLoopback,
+		ips:   []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	},
+	{
+		name:  "eth0",
+		flags: net.FlagUp,
+		ips:   []net.IP{net.ParseIP("fe80::1"), net.ParseIP("192.168.1.10")},
+	},
+	{
+		name:  "eth1",
+		flags: net.FlagUp,
+		ips:   []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("203.0.113.7")},
+	},
+	{
+		name:  "eth2",
+		flags: 0,
+		ips:   []net.IP{net.ParseIP("10.1.1.1")},
+	},
+	{name: "tun0", flags: net.FlagUp},
+}
+
+func TestInterfaceIP(t *testing.T) {
+	r := mkHostRunner(testInterfaces...)
+
+	got, err := r.interfaceIP("eth0")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "192.168.1.10")
+
+	got, err = r.interfaceIP("lo")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "127.0.0.1")
+
+	_, err = r.interfaceIP("tun0")
+	assert.ErrorContains(t, err, "interfaceIP: interface tun0 has no addresses")
+
+	_, err = r.interfaceIP("wlan0")
+	assert.ErrorContains(t, err, "interfaceIP: no interface named wlan0")
+}
+
+func TestPrivatePublicIP(t *testing.T) {
+	r := mkHostRunner(testInterfaces...)
+
+	got, err := r.privateIP()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "192.168.1.10")
+
+	got, err = r.publicIP()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "203.0.113.7")
+
+	r = mkHostRunner(testInterfaces[0], testInterfaces[3])
+	_, err = r.privateIP()
+	assert.ErrorContains(t, err, "privateIP: no private address found")
+	_, err = r.publicIP()
+	assert.ErrorContains(t, err, "publicIP: no public address found")
+
+	r = mkHostRunner(netInterface{
+		name:  "eth0",
+		flags: net.FlagUp,
+		ips:   []net.IP{net.ParseIP("fd00::5"), net.ParseIP("2001:db8::1")},
+	})
+	got, err = r.privateIP()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "fd00::5")
+	got, err = r.publicIP()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "2001:db8::1")
+
+	// carrier-grade NAT addresses are neither private nor public
+	r = mkHostRunner(netInterface{
+		name:  "eth0",
+		flags: net.FlagUp,
+		ips:   []net.IP{net.ParseIP("100.64.0.1"), net.ParseIP("100.127.255.254"), net.ParseIP("100.128.0.1")},
+	})
+	_, err = r.privateIP()
+	assert.ErrorContains(t, err, "privateIP: no private address found")
+	got, err = r.publicIP()
+	assert.Nil(t, err)
+	assert.Equal(t, got, "100.128.0.1")
+}
+
+func TestInterfacesError(t *testing.T) {
+	r := mkHostRunner()
+	r.netInterfaces = func() ([]netInterface, error) { return nil, errors.New("boom") }
+
+	_, err := r.interfaceIP("eth0")
+	assert.ErrorContains(t, err, "interfaceIP: boom")
+	_, err = r.privateIP()
+	assert.ErrorContains(t, err, "privateIP: boom")
+}
+
+func TestSystemInterfaces(t *testing.T) {
+	ifaces, err := systemInterfaces()
+	assert.Nil(t, err)
+	for _, iface := range ifaces {
+		assert.NotEqual(t, iface.name, "")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// httpTimeout bounds each request made by template functions that fetch
+// values from remote services.
+const httpTimeout = 30 * time.Second
+
+// maxErrorBody is the maximum number of bytes of an unsuccessful response
+// body included in an error.
+const maxErrorBody = 512
+
+// httpError is returned by getJSON for responses other than 200 OK.
+type httpError struct {
+	method     string
+	path       string
+	status     string
+	statusCode int
+	body       []byte
+}
+
+func (e httpError) Error() string {
+	body := e.body
+	if len(body) > maxErrorBody {
+		body = body[:maxErrorBody]
+	}
+	return fmt.Sprintf(
+		"%s %s returned %s: %s",
+		e.method,
+		e.path,
+		e.status,
+		strings.TrimSpace(string(body)),
+	)
+}
+
+// fetch performs req and returns the response body. Responses other than
+// 200 OK are returned as httpErrors.
+func (r *runner) fetch(req *http.Request) ([]byte, error) {
+	return fetchWith(r.httpClient, req)
+}
+
+// getJSON performs req and decodes the JSON response body into v, as
+// described by fetch.
+func (r *runner) getJSON(req *http.Request, v interface{}) error {
+	return getJSONWith(r.httpClient, req, v)
+}
+
+// fetchWith is like fetch, but performs req with client.
+func fetchWith(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpError{
+			method:     req.Method,
+			path:       req.URL.Path,
+			status:     resp.Status,
+			statusCode: resp.StatusCode,
+			body:       body,
+		}
+	}
+	return body, nil
+}
+
+// getJSONWith is like getJSON, but performs req with client.
+func getJSONWith(client *http.Client, req *http.Request, v interface{}) error {
+	body, err := fetchWith(client, req)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s %s returned invalid JSON: %s", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// getAccessToken performs req and returns the access_token of the OAuth2
+// token response.
+func (r *runner) getAccessToken(req *http.Request) (string, error) {
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := r.getJSON(req, &resp); err != nil {
+		return "", err
+	}
+	if resp.AccessToken == "" {
+		return "", fmt.Errorf("%s %s returned no access token", req.Method, req.URL.Path)
+	}
+	return resp.AccessToken, nil
+}
+
+// newTLSClient returns a client for remote services that uses config.
+func newTLSClient(config *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout:   httpTimeout,
+		Transport: &http.Transport{TLSClientConfig: config},
+	}
+}
+
+// addRootCAs adds the PEM-encoded certificates read from source to the
+// certificate authorities trusted by config.
+func addRootCAs(config *tls.Config, pem []byte, source string) error {
+	if config.RootCAs == nil {
+		config.RootCAs = x509.NewCertPool()
+	}
+	if !config.RootCAs.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("no certificates found in %s", source)
+	}
+	return nil
+}
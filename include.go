@@ -0,0 +1,101 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/turbinelabs/envtemplate/envtemplate"
+)
+
+// include renders the named template file with the functions of the current
+// render and returns the result. The template is executed with data, if
+// given, and otherwise with the data of the current render. Relative paths
+// are resolved against the directory of the including file.
+func (r *runner) include(path string, data ...interface{}) (string, error) {
+	if len(data) > 1 {
+		return "", fmt.Errorf("include accepts at most one data argument, got %d", len(data))
+	}
+
+	path, err := r.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if cycle := r.includeCycle(path); cycle != nil {
+		return "", fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := r.newTemplate().Funcs(r.renderFuncs).Parse(string(src))
+	if err != nil {
+		return "", fmt.Errorf("include %s: %s", path, err)
+	}
+
+	var d interface{} = r.renderData
+	if len(data) > 0 {
+		d = data[0]
+	}
+
+	r.includes = append(r.includes, path)
+	defer func() { r.includes = r.includes[:len(r.includes)-1] }()
+
+	out := &bytes.Buffer{}
+	if err := tmpl.Execute(out, d); err != nil {
+		return "", fmt.Errorf("include %s: %s", path, err)
+	}
+	return out.String(), nil
+}
+
+// resolvePath expands a leading "~" in path and resolves a relative path
+// against the directory of the file being rendered.
+func (r *runner) resolvePath(path string) (string, error) {
+	path, err := envtemplate.ExpandHome(path, r.os)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) && len(r.includes) > 0 {
+		path = filepath.Join(filepath.Dir(r.includes[len(r.includes)-1]), path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// includeCycle returns the chain of includes from the first inclusion of
+// path through path itself, if path is already being rendered, and nil
+// otherwise.
+func (r *runner) includeCycle(path string) []string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+
+	for i, included := range r.includes {
+		if includedAbs, err := filepath.Abs(included); err == nil && includedAbs == abs {
+			cycle := append([]string{}, r.includes[i:]...)
+			return append(cycle, path)
+		}
+	}
+	return nil
+}
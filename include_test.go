@@ -0,0 +1,160 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestRunInclude(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{
+		"app.tmpl":              `{{include "common/header.tmpl"}}app={{foo}}`,
+		"common/header.tmpl":    `# {{include "copyright.tmpl"}} {{sourceFile}}` + "\n",
+		"common/copyright.tmpl": `(c) {{.year}}`,
+	})
+	defer cleanup()
+
+	data, removeData := writeNamedTempFile(t, "data.json", `{"year": 2018}`)
+	defer removeData()
+
+	out := filepath.Join(dir, "app.conf")
+
+	c := cmd()
+	err := c.Flags.Parse([]string{
+		"-in", filepath.Join(dir, "app.tmpl"),
+		"-out", out,
+		"-vars", "foo=bar",
+		"-data-file", data,
+	})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assertFileContents(t, out, "# (c) 2018 "+filepath.Join(dir, "app.tmpl")+"\napp=bar")
+}
+
+func TestRunIncludeParentDir(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{
+		"app/app.tmpl":       `{{include "../common/header.tmpl"}}app`,
+		"common/header.tmpl": "# header\n",
+	})
+	defer cleanup()
+
+	out := filepath.Join(dir, "app", "app.conf")
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", filepath.Join(dir, "app", "app.tmpl"), "-out", out})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assertFileContents(t, out, "# header\napp")
+}
+
+func TestRunIncludeData(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{
+		"app.tmpl":  `{{range $i, $v := .hosts}}{{include "host.tmpl" $v}}{{end}}`,
+		"host.tmpl": `[{{.}}]`,
+	})
+	defer cleanup()
+
+	data, removeData := writeNamedTempFile(t, "data.json", `{"hosts": ["a", "b"]}`)
+	defer removeData()
+
+	out := filepath.Join(dir, "app.conf")
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", filepath.Join(dir, "app.tmpl"), "-out", out, "-data-file", data})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assertFileContents(t, out, "[a][b]")
+}
+
+func TestRunIncludeStdin(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"header.tmpl": "header {{foo}}"})
+	defer cleanup()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, fmt.Sprintf(`{{include %q}}!`, filepath.Join(dir, "header.tmpl")), out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "header bar!")
+}
+
+func TestRunIncludeCycle(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{
+		"a.tmpl":     `{{include "sub/b.tmpl"}}`,
+		"sub/b.tmpl": `{{include "../a.tmpl"}}`,
+	})
+	defer cleanup()
+
+	a := filepath.Join(dir, "a.tmpl")
+	b := filepath.Join(dir, "sub", "b.tmpl")
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", a, "-out", filepath.Join(dir, "a.conf")})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+	assert.StringContains(t, got.Message, fmt.Sprintf("include cycle: %s -> %s -> %s", a, b, a))
+	assertNoFile(t, filepath.Join(dir, "a.conf"))
+}
+
+func TestRunIncludeSelf(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"a.tmpl": `{{include "a.tmpl"}}`})
+	defer cleanup()
+
+	a := filepath.Join(dir, "a.tmpl")
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", a, "-out", filepath.Join(dir, "a.conf")})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.StringContains(t, got.Message, fmt.Sprintf("include cycle: %s -> %s", a, a))
+}
+
+func TestRunIncludeMissing(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, map[string]string{"a.tmpl": `{{include "missing.tmpl"}}`})
+	defer cleanup()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", filepath.Join(dir, "a.tmpl"), "-out", filepath.Join(dir, "a.conf")})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+	assert.StringContains(t, got.Message, "missing.tmpl")
+}
@@ -0,0 +1,79 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+// mkInputFD returns a file descriptor from which contents can be read. The
+// descriptor is owned by the caller.
+func mkInputFD(t testing.TB, contents string) int {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("could not create pipe: %s", err)
+	}
+	defer pr.Close()
+
+	// duplicate the read end so that closing pr does not close fd
+	fd, err := syscall.Dup(int(pr.Fd()))
+	if err != nil {
+		pw.Close()
+		t.Fatalf("could not dup pipe: %s", err)
+	}
+
+	go func() {
+		pw.Write([]byte(contents))
+		pw.Close()
+	}()
+
+	return fd
+}
+
+func TestRunInFD(t *testing.T) {
+	fd := mkInputFD(t, "a={{foo}}")
+
+	out := &bytes.Buffer{}
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().Stdout().Return(out)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "foo=bar", "-in-fd", fmt.Sprint(fd)})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "a=bar")
+}
@@ -0,0 +1,309 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/turbinelabs/envtemplate/envtemplate"
+)
+
+const defaultK8sServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// k8sClient is a client for the Kubernetes API server.
+type k8sClient struct {
+	server string
+	token  string
+	client *http.Client
+}
+
+// kubeconfig is the subset of the kubeconfig file format used to connect
+// to the API server.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string      `yaml:"token"`
+			TokenFile             string      `yaml:"tokenFile"`
+			ClientCertificate     string      `yaml:"client-certificate"`
+			ClientCertificateData string      `yaml:"client-certificate-data"`
+			ClientKey             string      `yaml:"client-key"`
+			ClientKeyData         string      `yaml:"client-key-data"`
+			Exec                  interface{} `yaml:"exec"`
+			AuthProvider          interface{} `yaml:"auth-provider"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+// k8sSecret returns the decoded value of key in the named Secret in
+// namespace ns.
+func (r *runner) k8sSecret(ns, name, key string) (string, error) {
+	var secret struct {
+		Data map[string][]byte `json:"data"`
+	}
+	if err := r.getK8sObject("secrets", ns, name, &secret); err != nil {
+		return "", fmt.Errorf("k8sSecret: %s", err)
+	}
+
+	value, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("k8sSecret: no key %q in secret %s/%s", key, ns, name)
+	}
+	return string(value), nil
+}
+
+// k8sConfigMap returns the value of key in the named ConfigMap in
+// namespace ns.
+func (r *runner) k8sConfigMap(ns, name, key string) (string, error) {
+	var configMap struct {
+		Data       map[string]string `json:"data"`
+		BinaryData map[string][]byte `json:"binaryData"`
+	}
+	if err := r.getK8sObject("configmaps", ns, name, &configMap); err != nil {
+		return "", fmt.Errorf("k8sConfigMap: %s", err)
+	}
+
+	if value, ok := configMap.Data[key]; ok {
+		return value, nil
+	}
+	if value, ok := configMap.BinaryData[key]; ok {
+		return string(value), nil
+	}
+	return "", fmt.Errorf("k8sConfigMap: no key %q in config map %s/%s", key, ns, name)
+}
+
+// getK8sObject decodes the named object of the given resource type in
+// namespace ns into v. Each object is fetched at most once.
+func (r *runner) getK8sObject(resource, ns, name string, v interface{}) error {
+	path := "/api/v1/namespaces/" + url.PathEscape(ns) + "/" + resource + "/" + url.PathEscape(name)
+
+	body, ok := r.k8sObjects[path]
+	if !ok {
+		if r.k8s == nil {
+			client, err := r.newK8sClient()
+			if err != nil {
+				return err
+			}
+			r.k8s = client
+		}
+
+		req, err := http.NewRequest(http.MethodGet, r.k8s.server+path, nil)
+		if err != nil {
+			return err
+		}
+		if r.k8s.token != "" {
+			req.Header.Set("Authorization", "Bearer "+r.k8s.token)
+		}
+		req.Header.Set("Accept", "application/json")
+
+		if body, err = fetchWith(r.k8s.client, req); err != nil {
+			return err
+		}
+		r.k8sObjects[path] = body
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("GET %s returned invalid JSON: %s", path, err)
+	}
+	return nil
+}
+
+// newK8sClient returns a client configured by the kubeconfig file named by
+// $KUBECONFIG, by the service account of the pod when running in a
+// cluster, or by ~/.kube/config.
+func (r *runner) newK8sClient() (*k8sClient, error) {
+	if paths, ok := r.os.LookupEnv("KUBECONFIG"); ok && paths != "" {
+		for _, path := range filepath.SplitList(paths) {
+			if _, err := os.Stat(path); err == nil {
+				return r.kubeconfigClient(path)
+			}
+		}
+		return nil, fmt.Errorf("no file named by $KUBECONFIG exists")
+	}
+
+	if host, ok := r.os.LookupEnv("KUBERNETES_SERVICE_HOST"); ok && host != "" {
+		port, _ := r.os.LookupEnv("KUBERNETES_SERVICE_PORT")
+		return r.inClusterClient(host, port)
+	}
+
+	path, err := envtemplate.ExpandHome("~/.kube/config", r.os)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("not running in a cluster, and there is no ~/.kube/config")
+	}
+	return r.kubeconfigClient(path)
+}
+
+func (r *runner) inClusterClient(host, port string) (*k8sClient, error) {
+	if port == "" {
+		port = "443"
+	}
+
+	token, err := ioutil.ReadFile(filepath.Join(r.k8sServiceAccountDir, "token"))
+	if err != nil {
+		return nil, err
+	}
+
+	caFile := filepath.Join(r.k8sServiceAccountDir, "ca.crt")
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{}
+	if err := addRootCAs(config, ca, caFile); err != nil {
+		return nil, err
+	}
+
+	return &k8sClient{
+		server: "https://" + net.JoinHostPort(host, port),
+		token:  strings.TrimSpace(string(token)),
+		client: newTLSClient(config),
+	}, nil
+}
+
+func (r *runner) kubeconfigClient(path string) (*k8sClient, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("could not parse kubeconfig %s: %s", path, err)
+	}
+
+	// relative paths are relative to the kubeconfig file
+	dir := filepath.Dir(path)
+	readFile := func(name string) ([]byte, error) {
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(dir, name)
+		}
+		return ioutil.ReadFile(name)
+	}
+	// fields ending in -data are base64-encoded alternatives to file names
+	readData := func(data, name string) ([]byte, error) {
+		if data != "" {
+			return base64.StdEncoding.DecodeString(data)
+		}
+		if name != "" {
+			return readFile(name)
+		}
+		return nil, nil
+	}
+
+	var clusterName, userName string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == kc.CurrentContext {
+			clusterName, userName, found = c.Context.Cluster, c.Context.User, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig %s has no context %q", path, kc.CurrentContext)
+	}
+
+	client := &k8sClient{}
+	config := &tls.Config{}
+	found = false
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		found = true
+		client.server = strings.TrimRight(c.Cluster.Server, "/")
+		config.InsecureSkipVerify = c.Cluster.InsecureSkipTLSVerify
+		ca, err := readData(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: %s", path, err)
+		}
+		if ca != nil {
+			if err := addRootCAs(config, ca, "the certificate authority of cluster "+clusterName); err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: %s", path, err)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig %s has no cluster %q", path, clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if u.User.Exec != nil || u.User.AuthProvider != nil {
+			return nil, fmt.Errorf("kubeconfig %s: user %q uses an unsupported credential plugin", path, userName)
+		}
+
+		client.token = u.User.Token
+		if client.token == "" && u.User.TokenFile != "" {
+			token, err := readFile(u.User.TokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: %s", path, err)
+			}
+			client.token = strings.TrimSpace(string(token))
+		}
+
+		cert, err := readData(u.User.ClientCertificateData, u.User.ClientCertificate)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: %s", path, err)
+		}
+		key, err := readData(u.User.ClientKeyData, u.User.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig %s: %s", path, err)
+		}
+		if cert != nil || key != nil {
+			pair, err := tls.X509KeyPair(cert, key)
+			if err != nil {
+				return nil, fmt.Errorf("kubeconfig %s: %s", path, err)
+			}
+			config.Certificates = []tls.Certificate{pair}
+		}
+	}
+
+	client.client = newTLSClient(config)
+	return client, nil
+}
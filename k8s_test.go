@@ -0,0 +1,233 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// mkK8sServer returns an API server that serves a Secret and a ConfigMap
+// to requests bearing the token "sa-token", and a count of the requests it
+// has received.
+func mkK8sServer(t *testing.T) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("Authorization") != "Bearer sa-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/api/v1/namespaces/prod/secrets/db":
+			fmt.Fprint(w, `{"kind": "Secret", "data": {"password": "aHVudGVyMg=="}}`)
+		case "/api/v1/namespaces/prod/configmaps/web":
+			fmt.Fprint(w, `{"kind": "ConfigMap", "data": {"log_level": "info"}, "binaryData": {"blob": "YmluYXJ5"}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"kind": "Status", "reason": "NotFound"}`)
+		}
+	}))
+	return server, &requests
+}
+
+func k8sServerCA(server *httptest.Server) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+}
+
+func TestK8sInCluster(t *testing.T) {
+	server, requests := mkK8sServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "envtemplate-k8s")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("sa-token\n"), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ca.crt"), k8sServerCA(server), 0600))
+
+	u, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+	host, port, err := net.SplitHostPort(u.Host)
+	assert.Nil(t, err)
+
+	r, finish := mkEnvRunner(t, map[string]string{
+		"KUBERNETES_SERVICE_HOST": host,
+		"KUBERNETES_SERVICE_PORT": port,
+	})
+	defer finish()
+	r.k8sServiceAccountDir = dir
+
+	got, err := r.k8sSecret("prod", "db", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	got, err = r.k8sConfigMap("prod", "web", "log_level")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "info")
+
+	got, err = r.k8sConfigMap("prod", "web", "blob")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "binary")
+
+	_, err = r.k8sSecret("prod", "db", "user")
+	assert.ErrorContains(t, err, `k8sSecret: no key "user" in secret prod/db`)
+
+	_, err = r.k8sConfigMap("prod", "web", "missing")
+	assert.ErrorContains(t, err, `k8sConfigMap: no key "missing" in config map prod/web`)
+
+	_, err = r.k8sSecret("dev", "db", "password")
+	assert.ErrorContains(t, err, "k8sSecret: GET /api/v1/namespaces/dev/secrets/db returned 404 Not Found")
+
+	// fetched once for each object
+	assert.Equal(t, *requests, 3)
+}
+
+func writeKubeconfig(t *testing.T, dir, server, user string) string {
+	path := filepath.Join(dir, "config")
+	contents := `
+current-context: prod
+contexts:
+- name: dev
+  context: {cluster: dev, user: dev}
+- name: prod
+  context: {cluster: prod, user: prod}
+clusters:
+- name: prod
+  cluster:
+    server: ` + server + `
+    certificate-authority: ca.pem
+users:
+- name: prod
+  user:
+    ` + user + `
+`
+	assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+	return path
+}
+
+func TestK8sKubeconfig(t *testing.T) {
+	server, _ := mkK8sServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "envtemplate-k8s")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ca.pem"), k8sServerCA(server), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("sa-token"), 0600))
+
+	for _, user := range []string{"token: sa-token", "tokenFile: token"} {
+		path := writeKubeconfig(t, dir, server.URL+"/", user)
+
+		r, finish := mkEnvRunner(t, map[string]string{
+			"KUBECONFIG":              filepath.Join(dir, "missing") + string(filepath.ListSeparator) + path,
+			"KUBERNETES_SERVICE_HOST": "ignored",
+		})
+
+		got, err := r.k8sSecret("prod", "db", "password")
+		assert.Nil(t, err)
+		assert.Equal(t, got, "hunter2")
+		finish()
+	}
+}
+
+func TestK8sKubeconfigCAData(t *testing.T) {
+	server, _ := mkK8sServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "envtemplate-k8s")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	contents := fmt.Sprintf(
+		"current-context: c\ncontexts:\n- name: c\n  context: {cluster: c, user: u}\n"+
+			"clusters:\n- name: c\n  cluster: {server: %s, certificate-authority-data: %s}\n"+
+			"users:\n- name: u\n  user: {token: sa-token}\n",
+		server.URL,
+		base64.StdEncoding.EncodeToString(k8sServerCA(server)),
+	)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(contents), 0600))
+
+	r, finish := mkEnvRunner(t, map[string]string{"KUBECONFIG": path})
+	defer finish()
+
+	got, err := r.k8sConfigMap("prod", "web", "log_level")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "info")
+}
+
+func TestK8sKubeconfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envtemplate-k8s")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ca.pem"), []byte("not a certificate"), 0600))
+
+	path := writeKubeconfig(t, dir, "https://127.0.0.1:1", "exec: {command: aws}")
+	r, finish := mkEnvRunner(t, map[string]string{"KUBECONFIG": path})
+	defer finish()
+
+	_, err = r.k8sSecret("prod", "db", "password")
+	assert.ErrorContains(t, err, "k8sSecret: kubeconfig "+path+": no certificates found in")
+
+	assert.Nil(t, os.Remove(filepath.Join(dir, "ca.pem")))
+	r, finish = mkEnvRunner(t, map[string]string{"KUBECONFIG": path})
+	defer finish()
+
+	_, err = r.k8sSecret("prod", "db", "password")
+	assert.ErrorContains(t, err, "ca.pem: no such file or directory")
+
+	assert.Nil(t, ioutil.WriteFile(path, []byte("current-context: none\n"), 0600))
+	r, finish = mkEnvRunner(t, map[string]string{"KUBECONFIG": path})
+	defer finish()
+
+	_, err = r.k8sSecret("prod", "db", "password")
+	assert.ErrorContains(t, err, `kubeconfig `+path+` has no context "none"`)
+
+	r, finish = mkEnvRunner(t, map[string]string{"KUBECONFIG": filepath.Join(dir, "missing")})
+	defer finish()
+
+	_, err = r.k8sSecret("prod", "db", "password")
+	assert.ErrorContains(t, err, "k8sSecret: no file named by $KUBECONFIG exists")
+}
+
+func TestK8sKubeconfigCredentialPlugin(t *testing.T) {
+	server, _ := mkK8sServer(t)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "envtemplate-k8s")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "ca.pem"), k8sServerCA(server), 0600))
+
+	path := writeKubeconfig(t, dir, server.URL, "exec: {command: aws}")
+	r, finish := mkEnvRunner(t, map[string]string{"KUBECONFIG": path})
+	defer finish()
+
+	_, err = r.k8sSecret("prod", "db", "password")
+	assert.ErrorContains(t, err, `user "prod" uses an unsupported credential plugin`)
+}
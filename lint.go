@@ -0,0 +1,56 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// lintTemplate writes every function and variable name referenced by the
+// template in to STDOUT, marking those that are undefined, and fails if any
+// are. The template is not executed.
+func (r *runner) lintTemplate(in []byte, funcs template.FuncMap) error {
+	tmpl, err := parseLenient(r.newTemplate(), string(in), funcs)
+	if err != nil {
+		return inputError{err}
+	}
+
+	source := sourceName(r.source)
+	stdout := r.os.Stdout()
+
+	var undefined []string
+	for _, name := range referencedNames(tmpl) {
+		suffix := ""
+		if funcs[name] == nil && !builtinFuncs[name] {
+			undefined = append(undefined, name)
+			suffix = " (undefined)"
+		}
+		if _, err := fmt.Fprintf(stdout, "%s: %s%s\n", source, name, suffix); err != nil {
+			return err
+		}
+	}
+
+	if len(undefined) > 0 {
+		return inputError{fmt.Errorf(
+			"undefined template variables: %s",
+			strings.Join(undefined, ", "),
+		)}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	"github.com/turbinelabs/cli/command"
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestRunLint(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{env "A" | typo}} {{if missing}}{{foo}}{{else}}{{.x | another}}{{end}} {{printf "%s" nope}}`,
+		out,
+	)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-lint", "-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("undefined template variables: another, missing, nope, typo"))
+	assert.Equal(
+		t,
+		out.String(),
+		`stdin: another (undefined)
+stdin: env
+stdin: foo
+stdin: missing (undefined)
+stdin: nope (undefined)
+stdin: printf
+stdin: typo (undefined)
+`,
+	)
+}
+
+func TestRunLintClean(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{env "A"}}{{foo}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-lint", "-vars", "foo=bar"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "stdin: env\nstdin: foo\n")
+}
+
+func TestRunLintBatch(t *testing.T) {
+	in, cleanup := mkBatchDir(t, map[string]string{
+		"a.tmpl": "{{foo}}",
+		"b.tmpl": "{{bar}}",
+	})
+	defer cleanup()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-lint", "-keep-going", "-in", in, "-vars", "foo=x"})
+	assert.Nil(t, err)
+
+	ctrl := gomock.NewController(assert.Tracing(t))
+	defer ctrl.Finish()
+
+	out := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().Stdout().Return(out).Times(2)
+	mockOS.EXPECT().Stderr().Return(stderr)
+
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.Error("failed to render 1 of 2 files"))
+	assert.Equal(
+		t,
+		out.String(),
+		filepath.Join(in, "a.tmpl")+": foo\n"+filepath.Join(in, "b.tmpl")+": bar (undefined)\n",
+	)
+	assert.Equal(
+		t,
+		stderr.String(),
+		"error: "+filepath.Join(in, "b.tmpl")+": undefined template variables: bar\n",
+	)
+}
+
+func TestRunLintDiff(t *testing.T) {
+	c := cmd()
+	err := c.Flags.Parse([]string{"-lint", "-diff", "-out", "x"})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("--lint and --diff may not be combined"))
+}
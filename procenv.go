@@ -0,0 +1,61 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+const defaultProcRoot = "/proc"
+
+// procEnv returns the value of the named variable in the environment of the
+// process with the given PID. It requires --allow-proc.
+func (r *runner) procEnv(pid, name string) (string, error) {
+	if !r.allowProc {
+		return "", fmt.Errorf("procEnv requires --allow-proc")
+	}
+
+	if n, err := strconv.Atoi(pid); err != nil || n <= 0 {
+		return "", fmt.Errorf("invalid process ID %q", pid)
+	}
+
+	environ, err := readProcEnviron(r.procRoot, pid)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := lookupEnviron(environ, name)
+	if !ok {
+		return "", fmt.Errorf("no value for $%s in environment of process %s", name, pid)
+	}
+	return value, nil
+}
+
+// lookupEnviron returns the value of the named variable in environ, which is
+// a sequence of NUL-terminated name=value entries as found in
+// /proc/PID/environ.
+func lookupEnviron(environ []byte, name string) (string, bool) {
+	prefix := []byte(name + "=")
+	for _, entry := range bytes.Split(environ, []byte{0}) {
+		if bytes.HasPrefix(entry, prefix) {
+			return string(entry[len(prefix):]), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,28 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+)
+
+// readProcEnviron returns the contents of the environ file for the process
+// with the given PID beneath procRoot.
+func readProcEnviron(procRoot, pid string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(procRoot, pid, "environ"))
+}
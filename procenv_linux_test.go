@@ -0,0 +1,77 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+)
+
+func mkProcFixture(t *testing.T, pid, environ string) (string, func()) {
+	root, err := ioutil.TempDir("", "envtemplate-proc")
+	assert.Nil(t, err)
+
+	dir := filepath.Join(root, pid)
+	assert.Nil(t, os.Mkdir(dir, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "environ"), []byte(environ), 0644))
+
+	return root, func() { os.RemoveAll(root) }
+}
+
+func TestProcEnv(t *testing.T) {
+	root, cleanup := mkProcFixture(t, "123", "HOME=/root\x00TOKEN=secret\x00")
+	defer cleanup()
+
+	r := &runner{allowProc: true, procRoot: root}
+
+	got, err := r.procEnv("123", "TOKEN")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "secret")
+
+	_, err = r.procEnv("123", "MISSING")
+	assert.ErrorContains(t, err, "no value for $MISSING in environment of process 123")
+
+	_, err = r.procEnv("456", "TOKEN")
+	assert.NonNil(t, err)
+}
+
+func TestRunProcEnv(t *testing.T) {
+	root, cleanup := mkProcFixture(t, "123", "TOKEN=secret\x00")
+	defer cleanup()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `token: {{procEnv "123" "TOKEN"}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+	r.procRoot = root
+
+	err := c.Flags.Parse([]string{"-allow-proc"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "token: secret")
+}
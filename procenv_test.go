@@ -0,0 +1,58 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestLookupEnviron(t *testing.T) {
+	environ := []byte("A=1\x00AB=2\x00EMPTY=\x00C=x=y\x00")
+
+	for _, tc := range []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"A", "1", true},
+		{"AB", "2", true},
+		{"EMPTY", "", true},
+		{"C", "x=y", true},
+		{"B", "", false},
+		{"", "", false},
+	} {
+		value, ok := lookupEnviron(environ, tc.name)
+		assert.Equal(t, value, tc.value)
+		assert.Equal(t, ok, tc.ok)
+	}
+}
+
+func TestProcEnvNotAllowed(t *testing.T) {
+	r := &runner{procRoot: defaultProcRoot}
+	_, err := r.procEnv("1", "PATH")
+	assert.ErrorContains(t, err, "procEnv requires --allow-proc")
+}
+
+func TestProcEnvInvalidPID(t *testing.T) {
+	r := &runner{allowProc: true, procRoot: defaultProcRoot}
+	for _, pid := range []string{"", "0", "-1", "self", "1/../2"} {
+		_, err := r.procEnv(pid, "PATH")
+		assert.ErrorContains(t, err, "invalid process ID")
+	}
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+// profiles are gzip-compressed protocol buffers
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func TestRunProfiles(t *testing.T) {
+	cpu, removeCPU := tempfile.Make(t)
+	defer removeCPU()
+
+	mem, removeMem := tempfile.Make(t)
+	defer removeMem()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "foo{{bar}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars", "bar=baz", "-cpuprofile", cpu, "-memprofile", mem})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "foobaz")
+
+	for _, profile := range []string{cpu, mem} {
+		contents, err := ioutil.ReadFile(profile)
+		assert.Nil(t, err)
+		assert.True(t, bytes.HasPrefix(contents, gzipMagic))
+	}
+}
+
+func TestRunCPUProfileBadPath(t *testing.T) {
+	dir, cleanup := mkBatchDir(t, nil)
+	defer cleanup()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-cpuprofile", dir})
+	assert.Nil(t, err)
+
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+)
+
+const alphaNum = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// random returns the source of random bytes for the template functions: a
+// generator seeded with --seed if it is set, and otherwise crypto/rand.
+func (r *runner) random() io.Reader {
+	if r.rand == nil {
+		if r.seed != 0 {
+			r.rand = mathrand.New(mathrand.NewSource(r.seed))
+		} else {
+			r.rand = cryptorand.Reader
+		}
+	}
+	return r.rand
+}
+
+func (r *runner) randomBytes(name string, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("%s length must not be negative, got %d", name, n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r.random(), b); err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err)
+	}
+	return b, nil
+}
+
+// uuidv4 returns a random (version 4) UUID in its canonical form.
+func (r *runner) uuidv4() (string, error) {
+	b, err := r.randomBytes("uuidv4", 16)
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// randAlphaNum returns a random string of n ASCII letters and digits, each
+// chosen uniformly.
+func (r *runner) randAlphaNum(n int) (string, error) {
+	if n < 0 {
+		return "", fmt.Errorf("randAlphaNum length must not be negative, got %d", n)
+	}
+
+	// bytes at or above limit are discarded, so that each character is
+	// equally likely
+	const limit = 256 - 256%len(alphaNum)
+	result := make([]byte, 0, n)
+	for len(result) < n {
+		b, err := r.randomBytes("randAlphaNum", n-len(result))
+		if err != nil {
+			return "", err
+		}
+		for _, c := range b {
+			if int(c) < limit {
+				result = append(result, alphaNum[int(c)%len(alphaNum)])
+			}
+		}
+	}
+	return string(result), nil
+}
+
+// randBytesB64 returns n random bytes encoded as standard base64.
+func (r *runner) randBytesB64(n int) (string, error) {
+	b, err := r.randomBytes("randBytesB64", n)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
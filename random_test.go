@@ -0,0 +1,91 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+)
+
+const uuidv4Pattern = `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`
+
+func TestUUIDv4(t *testing.T) {
+	r := cmd().Runner.(*runner)
+
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		got, err := r.uuidv4()
+		assert.Nil(t, err)
+		assert.MatchesRegex(t, got, uuidv4Pattern)
+		assert.False(t, seen[got])
+		seen[got] = true
+	}
+}
+
+func TestRandAlphaNum(t *testing.T) {
+	r := cmd().Runner.(*runner)
+
+	for _, n := range []int{0, 1, 32, 500} {
+		got, err := r.randAlphaNum(n)
+		assert.Nil(t, err)
+		assert.Equal(t, len(got), n)
+		assert.MatchesRegex(t, got, `^[0-9A-Za-z]*$`)
+	}
+
+	got, err := r.randAlphaNum(-1)
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "randAlphaNum length must not be negative, got -1")
+}
+
+func TestRandBytesB64(t *testing.T) {
+	r := cmd().Runner.(*runner)
+
+	got, err := r.randBytesB64(32)
+	assert.Nil(t, err)
+	b, err := base64.StdEncoding.DecodeString(got)
+	assert.Nil(t, err)
+	assert.Equal(t, len(b), 32)
+
+	got, err = r.randBytesB64(-2)
+	assert.Equal(t, got, "")
+	assert.ErrorContains(t, err, "randBytesB64 length must not be negative, got -2")
+}
+
+func TestRandomSeed(t *testing.T) {
+	render := func(seed string) string {
+		out := &bytes.Buffer{}
+		mockOS, finish := mkMockOs(t, "{{uuidv4}} {{randAlphaNum 16}} {{randBytesB64 8}}", out)
+		defer finish()
+
+		c := cmd()
+		r := c.Runner.(*runner)
+		r.os = mockOS
+
+		assert.Nil(t, c.Flags.Parse([]string{"-seed", seed}))
+		assert.Equal(t, r.Run(c, nil), command.NoError())
+		return out.String()
+	}
+
+	first := render("42")
+	assert.MatchesRegex(t, first, `^[0-9a-f-]{36} [0-9A-Za-z]{16} [A-Za-z0-9+/]{11}=$`)
+	assert.Equal(t, render("42"), first)
+	assert.NotEqual(t, render("43"), first)
+}
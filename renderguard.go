@@ -0,0 +1,98 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"text/template"
+)
+
+// renderGuard guards the template functions of a render run with
+// --max-render-time. Template execution cannot be interrupted, so a render
+// that exceeds its time is abandoned, and may go on calling functions while
+// the next file is rendered. The functions of every render are therefore
+// serialized, and those of an abandoned render refuse to run, so that it
+// cannot change the state of the runner after it is abandoned.
+type renderGuard struct {
+	r      *runner
+	ctx    context.Context
+	funcs  template.FuncMap
+	data   interface{}
+	source string
+}
+
+// guardFuncs returns funcs wrapped by a renderGuard for a render of source
+// with data. The wrapped functions refuse to run once ctx is done.
+func (r *runner) guardFuncs(
+	ctx context.Context,
+	funcs template.FuncMap,
+	data interface{},
+	source string,
+) template.FuncMap {
+	g := &renderGuard{r: r, ctx: ctx, funcs: funcs, data: data, source: source}
+	guarded := make(template.FuncMap, len(funcs))
+	for name, fn := range funcs {
+		guarded[name] = g.wrap(name, fn)
+	}
+	return guarded
+}
+
+func (g *renderGuard) wrap(name string, fn interface{}) interface{} {
+	fnValue := reflect.ValueOf(fn)
+	fnType := fnValue.Type()
+	variadic := fnType.IsVariadic()
+
+	wrapper := func(args []reflect.Value) []reflect.Value {
+		g.r.funcMu.Lock()
+		defer g.r.funcMu.Unlock()
+
+		if g.ctx.Err() != nil {
+			return abandonedResults(fnType, name)
+		}
+		// the per-render state is reset by the first function called, once
+		// any function of an abandoned render has returned
+		if g.r.funcGuard != g {
+			g.r.funcGuard = g
+			g.r.resetRenderState(g.funcs, g.data, g.source)
+		}
+
+		if variadic {
+			return fnValue.CallSlice(args)
+		}
+		return fnValue.Call(args)
+	}
+
+	return reflect.MakeFunc(fnType, wrapper).Interface()
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// abandonedResults returns the zero values of the results of fnType, with
+// an error as the last result if it returns one.
+func abandonedResults(fnType reflect.Type, name string) []reflect.Value {
+	results := make([]reflect.Value, fnType.NumOut())
+	for i := range results {
+		results[i] = reflect.Zero(fnType.Out(i))
+	}
+	if n := len(results); n > 0 && fnType.Out(n-1) == errorType {
+		err := fmt.Errorf("%s: render abandoned after exceeding max render time", name)
+		results[n-1] = reflect.ValueOf(&err).Elem()
+	}
+	return results
+}
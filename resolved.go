@@ -0,0 +1,100 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"text/template"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+const redactedValue = "REDACTED"
+
+// resolvedSet records the environment variables and template variables
+// looked up while rendering, for --dump-resolved. Unset environment
+// variables are recorded with a nil value.
+type resolvedSet struct {
+	Env  map[string]*string `json:"env"`
+	Vars map[string]string  `json:"vars"`
+}
+
+func newResolvedSet() *resolvedSet {
+	return &resolvedSet{
+		Env:  map[string]*string{},
+		Vars: map[string]string{},
+	}
+}
+
+// redacted returns a copy of rs with every value replaced by a placeholder.
+// Unset environment variables remain nil.
+func (rs *resolvedSet) redacted() *resolvedSet {
+	redacted := newResolvedSet()
+	placeholder := redactedValue
+	for name, value := range rs.Env {
+		if value == nil {
+			redacted.Env[name] = nil
+		} else {
+			redacted.Env[name] = &placeholder
+		}
+	}
+	for name := range rs.Vars {
+		redacted.Vars[name] = redactedValue
+	}
+	return redacted
+}
+
+// write saves rs to filename as JSON. The file is created with mode 0600,
+// since it may contain secrets.
+func (rs *resolvedSet) write(filename string, redact bool) error {
+	if redact {
+		rs = rs.redacted()
+	}
+	bytes, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append(bytes, '\n'), 0600)
+}
+
+// trackingOS records the result of each environment variable lookup.
+type trackingOS struct {
+	tbnos.OS
+	resolved *resolvedSet
+}
+
+func (t trackingOS) LookupEnv(key string) (string, bool) {
+	value, ok := t.OS.LookupEnv(key)
+	if ok {
+		t.resolved.Env[key] = &value
+	} else {
+		t.resolved.Env[key] = nil
+	}
+	return value, ok
+}
+
+// trackVars replaces the functions for vars in funcs with ones that record
+// each variable that is used.
+func (rs *resolvedSet) trackVars(funcs template.FuncMap, vars map[string]string) {
+	for name, value := range vars {
+		name, value := name, value
+		funcs[name] = func() string {
+			rs.Vars[name] = value
+			return value
+		}
+	}
+}
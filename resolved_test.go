@@ -0,0 +1,94 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+func testRunDumpResolved(t *testing.T, redact bool, want string) {
+	dump, removeDump := tempfile.Make(t)
+	defer removeDump()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(
+		t,
+		`{{env "HOME"}} {{envOrDefault "MISSING" "def"}} {{foo}}`,
+		out,
+	)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("HOME").Return("/home/tbn", true)
+	mockOS.EXPECT().LookupEnv("MISSING").Return("", false)
+	mockOS.EXPECT().ExpandEnv("def").Return("def")
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	args := []string{"-vars", "foo=bar,unused=x", "-dump-resolved", dump}
+	if redact {
+		args = append(args, "-redact")
+	}
+	err := c.Flags.Parse(args)
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "/home/tbn def bar")
+
+	contents, err := ioutil.ReadFile(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), want)
+
+	info, err := os.Stat(dump)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+}
+
+func TestRunDumpResolved(t *testing.T) {
+	testRunDumpResolved(t, false, `{
+  "env": {
+    "HOME": "/home/tbn",
+    "MISSING": null
+  },
+  "vars": {
+    "foo": "bar"
+  }
+}
+`)
+}
+
+func TestRunDumpResolvedRedact(t *testing.T) {
+	testRunDumpResolved(t, true, `{
+  "env": {
+    "HOME": "REDACTED",
+    "MISSING": null
+  },
+  "vars": {
+    "foo": "REDACTED"
+  }
+}
+`)
+}
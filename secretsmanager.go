@@ -0,0 +1,82 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+var secretsManagerService = awsService{
+	name:         "secretsmanager",
+	endpointID:   "SECRETS_MANAGER",
+	targetPrefix: "secretsmanager",
+}
+
+// awsSecret returns the current value of the named AWS Secrets Manager
+// secret or, if key is given, the value of key in the secret, which must be
+// a JSON object. Each secret is fetched at most once.
+func (r *runner) awsSecret(name string, key ...string) (string, error) {
+	if len(key) > 1 {
+		return "", fmt.Errorf("awsSecret: expected at most one key argument, got %d", len(key))
+	}
+
+	secret, ok := r.awsSecrets[name]
+	if !ok {
+		var err error
+		if secret, err = r.getSecretValue(name); err != nil {
+			return "", fmt.Errorf("awsSecret: %s", err)
+		}
+		r.awsSecrets[name] = secret
+	}
+
+	if len(key) == 0 {
+		return secret, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", fmt.Errorf("awsSecret: secret %q is not a JSON object", name)
+	}
+	value, ok := values[key[0]]
+	if !ok {
+		return "", fmt.Errorf("awsSecret: no key %q in secret %q", key[0], name)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	bytes, err := json.Marshal(value)
+	return string(bytes), err
+}
+
+func (r *runner) getSecretValue(name string) (string, error) {
+	in := struct {
+		SecretId string
+	}{name}
+	var out struct {
+		SecretString *string
+		SecretBinary []byte
+	}
+	if err := r.awsCall(secretsManagerService, "GetSecretValue", in, &out); err != nil {
+		return "", err
+	}
+
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
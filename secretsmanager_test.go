@@ -0,0 +1,121 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// mkSecretsManagerServer returns a Secrets Manager server that serves the
+// given secrets, and a count of the requests it has received.
+func mkSecretsManagerServer(t *testing.T, secrets map[string]string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		assert.Equal(t, req.Header.Get("X-Amz-Target"), "secretsmanager.GetSecretValue")
+		assert.StringContains(t, req.Header.Get("Authorization"), "/eu-central-1/secretsmanager/aws4_request")
+
+		var in struct {
+			SecretId string
+		}
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&in))
+
+		secret, ok := secrets[in.SecretId]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type": "ResourceNotFoundException"}`)
+			return
+		}
+		fmt.Fprint(w, secret)
+	}))
+	return server, &requests
+}
+
+func mkSecretsManagerRunner(t *testing.T, server *httptest.Server) (*runner, func()) {
+	r, finish := mkEnvRunner(t, map[string]string{
+		"AWS_REGION":                       "us-west-2",
+		"AWS_ACCESS_KEY_ID":                "AKID",
+		"AWS_SECRET_ACCESS_KEY":            "secret",
+		"AWS_ENDPOINT_URL_SECRETS_MANAGER": server.URL,
+	})
+	r.awsRegion = "eu-central-1"
+	return r, finish
+}
+
+func TestAWSSecret(t *testing.T) {
+	server, requests := mkSecretsManagerServer(t, map[string]string{
+		"prod/db":    `{"SecretString": "{\"password\": \"hunter2\", \"port\": 5432}"}`,
+		"prod/token": `{"SecretString": "s3cr3t"}`,
+		"prod/cert":  `{"SecretBinary": "Y2VydA=="}`,
+	})
+	defer server.Close()
+
+	r, finish := mkSecretsManagerRunner(t, server)
+	defer finish()
+
+	got, err := r.awsSecret("prod/db", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	got, err = r.awsSecret("prod/db", "port")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "5432")
+
+	got, err = r.awsSecret("prod/db")
+	assert.Nil(t, err)
+	assert.Equal(t, got, `{"password": "hunter2", "port": 5432}`)
+
+	got, err = r.awsSecret("prod/token")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "s3cr3t")
+
+	got, err = r.awsSecret("prod/cert")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "cert")
+
+	// fetched once for each secret
+	assert.Equal(t, *requests, 3)
+}
+
+func TestAWSSecretErrors(t *testing.T) {
+	server, _ := mkSecretsManagerServer(t, map[string]string{
+		"prod/db":    `{"SecretString": "{\"password\": \"hunter2\"}"}`,
+		"prod/token": `{"SecretString": "s3cr3t"}`,
+	})
+	defer server.Close()
+
+	r, finish := mkSecretsManagerRunner(t, server)
+	defer finish()
+
+	_, err := r.awsSecret("prod/db", "user")
+	assert.ErrorContains(t, err, `awsSecret: no key "user" in secret "prod/db"`)
+
+	_, err = r.awsSecret("prod/token", "user")
+	assert.ErrorContains(t, err, `awsSecret: secret "prod/token" is not a JSON object`)
+
+	_, err = r.awsSecret("prod/db", "a", "b")
+	assert.ErrorContains(t, err, "awsSecret: expected at most one key argument, got 2")
+
+	_, err = r.awsSecret("prod/missing")
+	assert.ErrorContains(t, err, "awsSecret: POST / returned 400 Bad Request")
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/turbinelabs/cli/command"
+)
+
+// sopsCommand is the command used to decrypt SOPS-encrypted files.
+var sopsCommand = "sops"
+
+// isSOPSEncrypted returns true if obj, the top-level object of a JSON or
+// YAML file, contains the metadata added by SOPS when encrypting the file.
+func isSOPSEncrypted(obj map[string]interface{}) bool {
+	metadata, ok := obj["sops"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = metadata["mac"]
+	return ok
+}
+
+// sopsError is returned by sopsDecrypt when sops fails. envtemplate exits
+// with sops's exit status rather than reporting bad input.
+type sopsError struct {
+	error
+	status int
+}
+
+// varsCmdErr converts an error loading vars into a CmdErr. It is bad input
+// unless sops failed, in which case sops's exit status is used.
+func varsCmdErr(cmd *command.Cmd, err error) command.CmdErr {
+	if sopsErr, ok := err.(sopsError); ok {
+		return command.CmdErr{Cmd: cmd, Code: command.CmdErrCode(sopsErr.status), Message: err.Error()}
+	}
+	return cmd.BadInput(err)
+}
+
+// sopsDecrypt decrypts the named file by running sops, using the KMS, age,
+// or PGP keys it is configured with, and returns its top-level object. If
+// sops fails, a sopsError with its exit status is returned.
+func sopsDecrypt(filename string) (map[string]interface{}, error) {
+	stderr := &bytes.Buffer{}
+	cmd := exec.Command(sopsCommand, "--decrypt", "--output-type", "json", filename)
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		status, failed := exitStatus(err)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%s: %s", err, msg)
+		}
+		err = fmt.Errorf("could not decrypt %s with sops: %s", filename, err)
+		if failed {
+			return nil, sopsError{err, status}
+		}
+		return nil, err
+	}
+
+	data := map[string]interface{}{}
+	if err := unmarshalJSONInts(out, &data); err != nil {
+		return nil, fmt.Errorf("could not parse decrypted %s: %s", filename, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+)
+
+const sopsEncrypted = `{
+	"password": "ENC[AES256_GCM,data:xxxx,type:str]",
+	"port": "ENC[AES256_GCM,data:yyyy,type:int]",
+	"sops": {"mac": "ENC[AES256_GCM,data:zzzz,type:str]", "version": "3.8.1"}
+}`
+
+// mkFakeSOPS replaces sopsCommand with a script that decrypts the named
+// file to decrypted and rejects any other file.
+func mkFakeSOPS(t *testing.T, filename, decrypted string) func() {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	script, remove := writeNamedTempFile(
+		t,
+		"sops",
+		"#!/bin/sh\n"+
+			"if [ \"$*\" != \"--decrypt --output-type json "+filename+"\" ]; then\n"+
+			"  echo \"Error: no matching keys found\" >&2\n"+
+			"  exit 128\n"+
+			"fi\n"+
+			"cat <<'EOF'\n"+decrypted+"\nEOF\n",
+	)
+	assert.Nil(t, os.Chmod(script, 0755))
+
+	orig := sopsCommand
+	sopsCommand = script
+	return func() {
+		sopsCommand = orig
+		remove()
+	}
+}
+
+func TestIsSOPSEncrypted(t *testing.T) {
+	assert.True(t, isSOPSEncrypted(map[string]interface{}{
+		"a":    "ENC[...]",
+		"sops": map[string]interface{}{"mac": "ENC[...]"},
+	}))
+	assert.False(t, isSOPSEncrypted(map[string]interface{}{"sops": "a var named sops"}))
+	assert.False(t, isSOPSEncrypted(map[string]interface{}{"sops": map[string]interface{}{"x": 1}}))
+	assert.False(t, isSOPSEncrypted(map[string]interface{}{"a": "b"}))
+}
+
+func TestLoadVarsFileSOPS(t *testing.T) {
+	f, removeFile := writeNamedTempFile(t, "secrets.enc.json", sopsEncrypted)
+	defer removeFile()
+	defer mkFakeSOPS(t, f, `{"password": "hunter2", "port": 5432}`)()
+
+	vars, err := loadVarsFile(f, true)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, vars, map[string]string{"password": "hunter2", "port": "5432"})
+
+	vars, err = loadVarsFile(f, false)
+	assert.Nil(t, vars)
+	assert.ErrorContains(t, err, "vars file "+f+" is encrypted with SOPS; decrypting it requires --allow-exec")
+}
+
+func TestLoadVarsFileSOPSError(t *testing.T) {
+	f, removeFile := writeNamedTempFile(t, "secrets.enc.yaml", "a: ENC[x]\nsops:\n  mac: ENC[y]\n")
+	defer removeFile()
+	defer mkFakeSOPS(t, "other.yaml", "{}")()
+
+	vars, err := loadVarsFile(f, true)
+	assert.Nil(t, vars)
+	assert.ErrorContains(t, err, "could not decrypt "+f+" with sops: exit status 128: Error: no matching keys found")
+
+	sopsErr, ok := err.(sopsError)
+	assert.True(t, ok)
+	assert.Equal(t, sopsErr.status, 128)
+}
+
+func TestRunVarsFileSOPSError(t *testing.T) {
+	f, removeFile := writeNamedTempFile(t, "secrets.enc.json", sopsEncrypted)
+	defer removeFile()
+	defer mkFakeSOPS(t, "other.json", "{}")()
+
+	for _, context := range []bool{false, true} {
+		c := cmd()
+		args := []string{"-vars-file", f, "-allow-exec"}
+		if context {
+			args = append(args, "-context")
+		}
+		assert.Nil(t, c.Flags.Parse(args))
+
+		got := c.Runner.Run(c, nil)
+		assert.Equal(t, got, command.CmdErr{
+			Cmd:     c,
+			Code:    128,
+			Message: "could not decrypt " + f + " with sops: exit status 128: Error: no matching keys found",
+		})
+	}
+}
+
+func TestRunVarsFileSOPS(t *testing.T) {
+	f, removeFile := writeNamedTempFile(t, "secrets.enc.json", sopsEncrypted)
+	defer removeFile()
+	defer mkFakeSOPS(t, f, `{"password": "hunter2"}`)()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, "password={{password}}", out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-vars-file", f, "-allow-exec"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "password=hunter2")
+
+	contents, err := ioutil.ReadFile(f)
+	assert.Nil(t, err)
+	assert.Equal(t, string(contents), sopsEncrypted)
+}
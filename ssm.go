@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import "fmt"
+
+var ssmService = awsService{name: "ssm", endpointID: "SSM", targetPrefix: "AmazonSSM"}
+
+// ssmKey identifies a parameter fetched from SSM Parameter Store.
+type ssmKey struct {
+	path    string
+	decrypt bool
+}
+
+// ssm returns the value of the SSM Parameter Store parameter at path. If
+// decrypt is given and true, SecureString parameters are decrypted. Each
+// parameter is fetched at most once.
+func (r *runner) ssm(path string, decrypt ...bool) (string, error) {
+	value, err := r.getParameter(path, decrypt)
+	if err != nil {
+		return "", fmt.Errorf("ssm: %s", err)
+	}
+	return value, nil
+}
+
+// ssmOrDefault is like ssm, but returns defaultValue if the parameter does
+// not exist.
+func (r *runner) ssmOrDefault(path, defaultValue string, decrypt ...bool) (string, error) {
+	value, err := r.getParameter(path, decrypt)
+	if err != nil {
+		if awsErrorType(err) == "ParameterNotFound" {
+			return defaultValue, nil
+		}
+		return "", fmt.Errorf("ssmOrDefault: %s", err)
+	}
+	return value, nil
+}
+
+func (r *runner) getParameter(path string, decrypt []bool) (string, error) {
+	if len(decrypt) > 1 {
+		return "", fmt.Errorf("expected at most one decrypt argument, got %d", len(decrypt))
+	}
+
+	key := ssmKey{path, len(decrypt) == 1 && decrypt[0]}
+	if value, ok := r.ssmParams[key]; ok {
+		return value, nil
+	}
+
+	in := struct {
+		Name           string
+		WithDecryption bool
+	}{key.path, key.decrypt}
+	var out struct {
+		Parameter struct {
+			Value string
+		}
+	}
+	if err := r.awsCall(ssmService, "GetParameter", in, &out); err != nil {
+		return "", err
+	}
+
+	r.ssmParams[key] = out.Parameter.Value
+	return out.Parameter.Value, nil
+}
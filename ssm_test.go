@@ -0,0 +1,138 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/turbinelabs/test/assert"
+)
+
+// mkSSMServer returns an SSM server that serves the given parameters,
+// decrypting those whose values start with "encrypted:" only if requested,
+// and a count of the requests it has received.
+func mkSSMServer(t *testing.T, params map[string]string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		assert.Equal(t, req.Header.Get("X-Amz-Target"), "AmazonSSM.GetParameter")
+		assert.Equal(t, req.Header.Get("Content-Type"), "application/x-amz-json-1.1")
+		assert.True(t, strings.HasPrefix(
+			req.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKID/",
+		))
+		assert.StringContains(t, req.Header.Get("Authorization"), "/us-west-2/ssm/aws4_request")
+
+		var in struct {
+			Name           string
+			WithDecryption bool
+		}
+		assert.Nil(t, json.NewDecoder(req.Body).Decode(&in))
+
+		value, ok := params[in.Name]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type": "ParameterNotFound", "message": ""}`)
+			return
+		}
+		if in.WithDecryption {
+			value = strings.TrimPrefix(value, "encrypted:")
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"Parameter": map[string]interface{}{"Name": in.Name, "Value": value},
+		})
+	}))
+	return server, &requests
+}
+
+func mkSSMRunner(t *testing.T, server *httptest.Server) (*runner, func()) {
+	return mkEnvRunner(t, map[string]string{
+		"AWS_REGION":            "us-west-2",
+		"AWS_ACCESS_KEY_ID":     "AKID",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+		"AWS_ENDPOINT_URL_SSM":  server.URL,
+	})
+}
+
+func TestSSM(t *testing.T) {
+	server, requests := mkSSMServer(t, map[string]string{
+		"/prod/db/host":     "db.example.com",
+		"/prod/db/password": "encrypted:hunter2",
+	})
+	defer server.Close()
+
+	r, finish := mkSSMRunner(t, server)
+	defer finish()
+
+	got, err := r.ssm("/prod/db/host")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "db.example.com")
+
+	got, err = r.ssm("/prod/db/password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "encrypted:hunter2")
+
+	got, err = r.ssm("/prod/db/password", true)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	got, err = r.ssm("/prod/db/host")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "db.example.com")
+
+	// fetched once for each distinct parameter and decryption
+	assert.Equal(t, *requests, 3)
+}
+
+func TestSSMErrors(t *testing.T) {
+	server, _ := mkSSMServer(t, nil)
+	defer server.Close()
+
+	r, finish := mkSSMRunner(t, server)
+	defer finish()
+
+	_, err := r.ssm("/missing")
+	assert.ErrorContains(t, err, "ssm: POST / returned 400 Bad Request: {\"__type\": \"ParameterNotFound\"")
+
+	_, err = r.ssm("/missing", true, false)
+	assert.ErrorContains(t, err, "ssm: expected at most one decrypt argument, got 2")
+}
+
+func TestSSMOrDefault(t *testing.T) {
+	server, _ := mkSSMServer(t, map[string]string{"/prod/db/pool": "encrypted:20"})
+	defer server.Close()
+
+	r, finish := mkSSMRunner(t, server)
+	defer finish()
+
+	got, err := r.ssmOrDefault("/prod/db/pool", "10", true)
+	assert.Nil(t, err)
+	assert.Equal(t, got, "20")
+
+	got, err = r.ssmOrDefault("/prod/db/missing", "10")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "10")
+
+	server.Close()
+	_, err = r.ssmOrDefault("/prod/db/other", "10")
+	assert.ErrorContains(t, err, "ssmOrDefault: ")
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+var errNoStateFile = errors.New("no --state-file specified")
+
+// loadState reads key/value state from a JSON file written by a previous
+// invocation. A missing file yields empty state.
+func loadState(filename string) (map[string]string, error) {
+	state := map[string]string{}
+
+	bytes, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(bytes, &state); err != nil {
+		return nil, fmt.Errorf("could not parse state file %s: %s", filename, err)
+	}
+	return state, nil
+}
+
+// saveState writes key/value state as JSON. Since state may hold generated
+// secrets, the file is only readable by its owner.
+func saveState(filename string, state map[string]string) error {
+	bytes, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(bytes, '\n'), 0600)
+}
+
+func (r *runner) setState(key, value string) (string, error) {
+	if r.state == nil {
+		return "", errNoStateFile
+	}
+	if current, ok := r.state[key]; !ok || current != value {
+		r.state[key] = value
+		r.stateChanged = true
+	}
+	return "", nil
+}
+
+func (r *runner) getState(key string) (string, error) {
+	if r.state == nil {
+		return "", errNoStateFile
+	}
+	value, ok := r.state[key]
+	if !ok {
+		return "", fmt.Errorf("no value for %q in state file", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+func TestLoadStateMissingFile(t *testing.T) {
+	f, remove := tempfile.Make(t)
+	remove()
+
+	state, err := loadState(f)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, state, map[string]string{})
+}
+
+func TestLoadStateBadFile(t *testing.T) {
+	f, remove := tempfile.Write(t, "{")
+	defer remove()
+
+	state, err := loadState(f)
+	assert.Nil(t, state)
+	assert.ErrorContains(t, err, "could not parse state file")
+}
+
+func TestSaveAndLoadState(t *testing.T) {
+	f, remove := tempfile.Make(t)
+	defer remove()
+
+	assert.Nil(t, saveState(f, map[string]string{"a": "b"}))
+
+	info, err := os.Stat(f)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0600))
+
+	state, err := loadState(f)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, state, map[string]string{"a": "b"})
+}
+
+func runStateTemplate(t *testing.T, stateFile, tmpl string) (string, command.CmdErr) {
+	in, removeIn := tempfile.Write(t, tmpl)
+	defer removeIn()
+	out, removeOut := tempfile.Make(t)
+	defer removeOut()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-state-file", stateFile})
+	assert.Nil(t, err)
+	cmdErr := c.Runner.Run(c, nil)
+
+	gotOut, err := ioutil.ReadFile(out)
+	assert.Nil(t, err)
+	return string(gotOut), cmdErr
+}
+
+func TestRunStateAcrossInvocations(t *testing.T) {
+	stateFile, removeState := tempfile.Make(t)
+	removeState()
+	defer os.Remove(stateFile)
+
+	got, cmdErr := runStateTemplate(t, stateFile, `a{{setState "pw" "s3cr3t"}}b`)
+	assert.Equal(t, cmdErr, command.NoError())
+	assert.Equal(t, got, "ab")
+
+	got, cmdErr = runStateTemplate(t, stateFile, `pw={{getState "pw"}}`)
+	assert.Equal(t, cmdErr, command.NoError())
+	assert.Equal(t, got, "pw=s3cr3t")
+}
+
+func TestRunGetStateMissingKey(t *testing.T) {
+	stateFile, removeState := tempfile.Make(t)
+	removeState()
+	defer os.Remove(stateFile)
+
+	_, cmdErr := runStateTemplate(t, stateFile, `{{getState "pw"}}`)
+	assert.Equal(t, cmdErr.Message, `template: :1:2: executing "" at <getState "pw">: error calling getState: no value for "pw" in state file`)
+
+	_, err := os.Stat(stateFile)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRunStateWithoutStateFile(t *testing.T) {
+	c := cmd()
+	r := c.Runner.(*runner)
+
+	_, err := r.setState("a", "b")
+	assert.Equal(t, err, errNoStateFile)
+	_, err = r.getState("a")
+	assert.Equal(t, err, errNoStateFile)
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"regexp"
+	"sort"
+	"text/template"
+	"text/template/parse"
+)
+
+// undefinedFuncPattern matches the parse error produced when a template
+// references an undefined function.
+var undefinedFuncPattern = regexp.MustCompile(`function "(.+?)" not defined`)
+
+// builtinFuncs are the functions predefined by text/template.
+var builtinFuncs = map[string]bool{
+	"and":      true,
+	"call":     true,
+	"eq":       true,
+	"ge":       true,
+	"gt":       true,
+	"html":     true,
+	"index":    true,
+	"js":       true,
+	"le":       true,
+	"len":      true,
+	"lt":       true,
+	"ne":       true,
+	"not":      true,
+	"or":       true,
+	"print":    true,
+	"printf":   true,
+	"println":  true,
+	"slice":    true,
+	"urlquery": true,
+}
+
+// parseLenient parses src into a clone of base, like template.Parse, but
+// tolerates references to functions missing from funcs by defining
+// placeholders for them.
+func parseLenient(
+	base *template.Template,
+	src string,
+	funcs template.FuncMap,
+) (*template.Template, error) {
+	placeholders := template.FuncMap{}
+	for {
+		tmpl, err := template.Must(base.Clone()).Funcs(funcs).Funcs(placeholders).Parse(src)
+		if err == nil {
+			return tmpl, nil
+		}
+
+		match := undefinedFuncPattern.FindStringSubmatch(err.Error())
+		if match == nil || placeholders[match[1]] != nil {
+			return nil, err
+		}
+		placeholders[match[1]] = func() string { return "" }
+	}
+}
+
+// referencedNames returns the sorted names of all functions and variables
+// referenced by tmpl and the templates associated with it.
+func referencedNames(tmpl *template.Template) []string {
+	seen := map[string]bool{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walkIdentifiers(t.Tree.Root, func(name string) { seen[name] = true })
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// undefinedNames returns the sorted names referenced by tmpl that are
+// neither in funcs nor built into text/template.
+func undefinedNames(tmpl *template.Template, funcs template.FuncMap) []string {
+	undefined := []string{}
+	for _, name := range referencedNames(tmpl) {
+		if funcs[name] == nil && !builtinFuncs[name] {
+			undefined = append(undefined, name)
+		}
+	}
+	return undefined
+}
+
+func walkIdentifiers(node parse.Node, visit func(string)) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkIdentifiers(child, visit)
+		}
+
+	case *parse.ActionNode:
+		walkIdentifiers(n.Pipe, visit)
+
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			walkIdentifiers(cmd, visit)
+		}
+
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkIdentifiers(arg, visit)
+		}
+
+	case *parse.ChainNode:
+		walkIdentifiers(n.Node, visit)
+
+	case *parse.IdentifierNode:
+		visit(n.Ident)
+
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, visit)
+
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, visit)
+
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, visit)
+
+	case *parse.TemplateNode:
+		walkIdentifiers(n.Pipe, visit)
+	}
+}
+
+func walkBranch(n *parse.BranchNode, visit func(string)) {
+	walkIdentifiers(n.Pipe, visit)
+	walkIdentifiers(n.List, visit)
+	walkIdentifiers(n.ElseList, visit)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+)
+
+func TestParseLenient(t *testing.T) {
+	tmpl, err := parseLenient(template.New(""), `{{a}}{{if b}}{{c | d}}{{else}}{{a}}{{end}}`, template.FuncMap{"d": strings.ToUpper})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, referencedNames(tmpl), []string{"a", "b", "c", "d"})
+}
+
+func TestParseLenientSyntaxError(t *testing.T) {
+	tmpl, err := parseLenient(template.New(""), `{{a}}{{`, nil)
+	assert.Nil(t, tmpl)
+	assert.NonNil(t, err)
+}
+
+func TestReferencedNames(t *testing.T) {
+	src := `{{define "sub"}}{{x}}{{end}}` +
+		`{{range $i, $v := y}}{{with z}}{{template "sub" w}}{{end}}{{end}}` +
+		`{{(v).Field}}{{if eq 1 1}}{{len "u"}}{{end}}`
+	tmpl, err := parseLenient(template.New(""), src, nil)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, referencedNames(tmpl), []string{"eq", "len", "v", "w", "x", "y", "z"})
+}
+
+func TestUndefinedNames(t *testing.T) {
+	funcs := template.FuncMap{"a": strings.ToUpper}
+	tmpl, err := parseLenient(template.New(""), `{{a "x"}}{{b}}{{printf "%s" c}}{{b}}`, funcs)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, undefinedNames(tmpl, funcs), []string{"b", "c"})
+}
+
+func TestRunStrictUndefined(t *testing.T) {
+	mockOS, finish := mkMockOs(t, `{{dbport}}{{env "X" | dbhost}}{{dbport}}{{bar}}`, nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-strict", "-vars", "bar=baz"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, c.BadInput("undefined template variables: dbhost, dbport"))
+}
+
+func TestRunStrictDefined(t *testing.T) {
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{if eq bar "baz"}}{{env "X"}}{{end}}`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("X").Return("x", true)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-strict", "-vars", "bar=baz"})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "x")
+}
+
+func TestParseLenientDelims(t *testing.T) {
+	tmpl, err := parseLenient(template.New("").Delims("[[", "]]"), `{{a}}[[b]]`, nil)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, referencedNames(tmpl), []string{"b"})
+}
+
+func TestRunStrictMissingKey(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"db": {"host": "localhost"}}`)
+	defer removeData()
+
+	mockOS, finish := mkMockOs(t, `{{.db.host}}:{{.db.prot}}`, nil)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-strict", "-data-file", data})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got.Code, command.CmdErrCodeError)
+	assert.StringContains(t, got.Message, `map has no entry for key "prot"`)
+}
+
+func TestRunMissingKeyNotStrict(t *testing.T) {
+	data, removeData := writeNamedTempFile(t, "data.json", `{"db": {"host": "localhost"}}`)
+	defer removeData()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `{{.db.host}}:{{.db.prot}}`, out)
+	defer finish()
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	err := c.Flags.Parse([]string{"-data-file", data})
+	assert.Nil(t, err)
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "localhost:<no value>")
+}
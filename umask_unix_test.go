@@ -0,0 +1,72 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+	"github.com/turbinelabs/test/tempfile"
+)
+
+func TestUmask(t *testing.T) {
+	old := syscall.Umask(027)
+	defer syscall.Umask(old)
+
+	assert.Equal(t, umask(), os.FileMode(027))
+	assert.Equal(t, umask(), os.FileMode(027))
+}
+
+func testRunRespectUmask(t *testing.T, out string) {
+	old := syscall.Umask(027)
+	defer syscall.Umask(old)
+
+	in, removeIn := tempfile.Write(t, "foo{{bar}}")
+	defer removeIn()
+
+	c := cmd()
+	err := c.Flags.Parse([]string{"-in", in, "-out", out, "-vars", "bar=baz", "-respect-umask"})
+	assert.Nil(t, err)
+	got := c.Runner.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+
+	info, err := os.Stat(out)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Mode().Perm(), os.FileMode(0640))
+}
+
+func TestRunRespectUmask(t *testing.T) {
+	out, removeOut := tempfile.Make(t)
+	removeOut()
+	defer os.Remove(out)
+
+	testRunRespectUmask(t, out)
+}
+
+func TestRunRespectUmaskExistingFile(t *testing.T) {
+	out, removeOut := tempfile.Make(t)
+	defer removeOut()
+	assert.Nil(t, os.Chmod(out, 0600))
+
+	testRunRespectUmask(t, out)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/turbinelabs/envtemplate/envtemplate"
+)
+
+// vault returns the value of key in the Vault secret at path. The server
+// and token are given by $VAULT_ADDR and $VAULT_TOKEN, or the token saved
+// in ~/.vault-token by "vault login", and $VAULT_NAMESPACE, if set, selects
+// a namespace. Both version 1 and version 2 key/value secrets engines are
+// supported. Each secret is fetched at most once.
+func (r *runner) vault(path, key string) (string, error) {
+	secret, ok := r.vaultSecrets[path]
+	if !ok {
+		var err error
+		if secret, err = r.readVaultSecret(path); err != nil {
+			return "", fmt.Errorf("vault: %s", err)
+		}
+		r.vaultSecrets[path] = secret
+	}
+
+	value, ok := secret[key]
+	if !ok {
+		return "", fmt.Errorf("vault: no key %q in secret %q", key, path)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	bytes, err := json.Marshal(value)
+	return string(bytes), err
+}
+
+func (r *runner) readVaultSecret(path string) (map[string]interface{}, error) {
+	addr, ok := r.os.LookupEnv("VAULT_ADDR")
+	if !ok || addr == "" {
+		return nil, fmt.Errorf("$VAULT_ADDR is not set")
+	}
+
+	token, err := r.vaultToken()
+	if err != nil {
+		return nil, err
+	}
+
+	url := strings.TrimRight(addr, "/") + "/v1/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace, ok := r.os.LookupEnv("VAULT_NAMESPACE"); ok && namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+
+	var resp struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := r.getJSON(req, &resp); err != nil {
+		return nil, err
+	}
+
+	// version 2 of the key/value engine nests the secret with its metadata
+	if inner, ok := resp.Data["data"].(map[string]interface{}); ok {
+		if _, ok := resp.Data["metadata"]; ok {
+			return inner, nil
+		}
+	}
+	return resp.Data, nil
+}
+
+func (r *runner) vaultToken() (string, error) {
+	if token, ok := r.os.LookupEnv("VAULT_TOKEN"); ok && token != "" {
+		return token, nil
+	}
+
+	path, err := envtemplate.ExpandHome("~/.vault-token", r.os)
+	if err == nil {
+		if token, err := ioutil.ReadFile(path); err == nil {
+			return strings.TrimSpace(string(token)), nil
+		}
+	}
+	return "", fmt.Errorf("$VAULT_TOKEN is not set and there is no ~/.vault-token")
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2018 Turbine Labs, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/turbinelabs/cli/command"
+	"github.com/turbinelabs/test/assert"
+
+	tbnos "github.com/turbinelabs/nonstdlib/os"
+)
+
+// mkVaultServer returns a Vault server that serves secrets by path, and a
+// count of the requests it has received.
+func mkVaultServer(t *testing.T, secrets map[string]string) (*httptest.Server, *int) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		if req.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		if ns := req.Header.Get("X-Vault-Namespace"); ns != "" && ns != "team" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		secret, ok := secrets[req.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+		fmt.Fprint(w, secret)
+	}))
+	return server, &requests
+}
+
+// mkEnvRunner returns a runner whose environment contains only env.
+func mkEnvRunner(t *testing.T, env map[string]string) (*runner, func()) {
+	ctrl := gomock.NewController(assert.Tracing(t))
+	mockOS := tbnos.NewMockOS(ctrl)
+	mockOS.EXPECT().LookupEnv(gomock.Any()).DoAndReturn(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}).AnyTimes()
+
+	r := cmd().Runner.(*runner)
+	r.os = mockOS
+	return r, ctrl.Finish
+}
+
+func TestVaultKVv2(t *testing.T) {
+	server, requests := mkVaultServer(t, map[string]string{
+		"/v1/secret/data/db": `{"data": {"data": {"password": "hunter2", "port": 5432}, "metadata": {"version": 3}}}`,
+	})
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{"VAULT_ADDR": server.URL + "/", "VAULT_TOKEN": "s.token"})
+	defer finish()
+
+	got, err := r.vault("secret/data/db", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	got, err = r.vault("/secret/data/db", "port")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "5432")
+
+	got, err = r.vault("secret/data/db", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	// fetched once for each distinct path
+	assert.Equal(t, *requests, 2)
+}
+
+func TestVaultKVv1(t *testing.T) {
+	server, _ := mkVaultServer(t, map[string]string{
+		"/v1/secret/db": `{"data": {"password": "hunter2", "data": {"nested": true}}}`,
+	})
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{
+		"VAULT_ADDR":      server.URL,
+		"VAULT_TOKEN":     "s.token",
+		"VAULT_NAMESPACE": "team",
+	})
+	defer finish()
+
+	got, err := r.vault("secret/db", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+
+	got, err = r.vault("secret/db", "data")
+	assert.Nil(t, err)
+	assert.Equal(t, got, `{"nested":true}`)
+}
+
+func TestVaultErrors(t *testing.T) {
+	server, _ := mkVaultServer(t, map[string]string{
+		"/v1/secret/db": `{"data": {"password": "hunter2"}}`,
+		"/v1/bad":       `{"data":`,
+	})
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "s.token"})
+	defer finish()
+
+	_, err := r.vault("secret/db", "user")
+	assert.ErrorContains(t, err, `vault: no key "user" in secret "secret/db"`)
+
+	_, err = r.vault("secret/missing", "user")
+	assert.ErrorContains(t, err, "vault: GET /v1/secret/missing returned 404 Not Found: {\"errors\":[]}")
+
+	_, err = r.vault("bad", "user")
+	assert.ErrorContains(t, err, "vault: GET /v1/bad returned invalid JSON")
+}
+
+func TestVaultBadToken(t *testing.T) {
+	server, _ := mkVaultServer(t, nil)
+	defer server.Close()
+
+	r, finish := mkEnvRunner(t, map[string]string{"VAULT_ADDR": server.URL, "VAULT_TOKEN": "wrong"})
+	defer finish()
+
+	_, err := r.vault("secret/db", "password")
+	assert.ErrorContains(t, err, `returned 403 Forbidden: {"errors":["permission denied"]}`)
+}
+
+func TestVaultTokenFile(t *testing.T) {
+	server, _ := mkVaultServer(t, map[string]string{"/v1/secret/db": `{"data": {"password": "hunter2"}}`})
+	defer server.Close()
+
+	home, err := ioutil.TempDir("", "envtemplate-vault")
+	assert.Nil(t, err)
+	defer os.RemoveAll(home)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(home, ".vault-token"), []byte("s.token\n"), 0600))
+
+	r, finish := mkEnvRunner(t, map[string]string{"VAULT_ADDR": server.URL, "HOME": home})
+	defer finish()
+
+	got, err := r.vault("secret/db", "password")
+	assert.Nil(t, err)
+	assert.Equal(t, got, "hunter2")
+}
+
+func TestVaultNotConfigured(t *testing.T) {
+	r, finish := mkEnvRunner(t, map[string]string{"HOME": "/nonexistent"})
+	defer finish()
+
+	_, err := r.vault("secret/db", "password")
+	assert.ErrorContains(t, err, "vault: $VAULT_ADDR is not set")
+
+	r, finish = mkEnvRunner(t, map[string]string{"VAULT_ADDR": "http://127.0.0.1:1", "HOME": "/nonexistent"})
+	defer finish()
+
+	_, err = r.vault("secret/db", "password")
+	assert.ErrorContains(t, err, "vault: $VAULT_TOKEN is not set and there is no ~/.vault-token")
+}
+
+func TestRunVault(t *testing.T) {
+	server, _ := mkVaultServer(t, map[string]string{"/v1/secret/db": `{"data": {"password": "hunter2"}}`})
+	defer server.Close()
+
+	out := &bytes.Buffer{}
+	mockOS, finish := mkMockOs(t, `password: {{vault "secret/db" "password"}}`, out)
+	defer finish()
+
+	mockOS.EXPECT().LookupEnv("VAULT_ADDR").Return(server.URL, true)
+	mockOS.EXPECT().LookupEnv("VAULT_TOKEN").Return("s.token", true)
+	mockOS.EXPECT().LookupEnv("VAULT_NAMESPACE").Return("", false)
+
+	c := cmd()
+	r := c.Runner.(*runner)
+	r.os = mockOS
+
+	got := r.Run(c, nil)
+	assert.Equal(t, got, command.NoError())
+	assert.Equal(t, out.String(), "password: hunter2")
+}